@@ -10,6 +10,8 @@ import (
 var ClusterFlag = flag.NewFlagSet("cluster", flag.ExitOnError)
 
 var flHelp = ClusterFlag.Bool([]string{"h", "-help"}, false, "Print usage")
+var flStrict = ClusterFlag.Bool([]string{"-strict"}, true, "Fail on the unknown keys in the cluster files, which are ignored with warnings if false")
+var flOutput = ClusterFlag.String([]string{"o", "-output"}, OUTPUT_TEXT, "Output format of the results: text, json or yaml")
 
 func init() {
 
@@ -22,11 +24,19 @@ func init() {
 		help := "\nCommands:\n"
 
 		for _, command := range [][]string{
+			{"config", "Print the cluster files merged, with the profile applied"},
+			{"cost", "Sum the prices of the instance types of the machine groups"},
 			{"deploy", "Deploy the container to the whole cluster of machines"},
+			{"lock", "Show or break the deploy lock of the cluster"},
+			{"plan", "Show what deploy would change, without changing anything"},
 			{"resize", "Create or destroy machines as needed"},
+			{"rollback", "Redeploy a container group with a recorded revision"},
 			{"start", "Start specified containers and machines"},
 			{"stop", "Stop specified containers and machines"},
 			{"restart", "Restart specified containers and machines"},
+			{"status", "Show the desired and actual state of every group"},
+			{"validate", "Check the cluster file and report all the problems"},
+			{"watch", "Keep the machines and containers running as described"},
 		} {
 			help += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
 		}
@@ -6,15 +6,18 @@ import (
 	"reflect"
 	"strings"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/opts"
 	flag "github.com/docker/docker/pkg/mflag"
 	dcluster "github.com/weibocom/dockerf/cluster"
 	dcontext "github.com/weibocom/dockerf/cluster/context"
+	"github.com/weibocom/dockerf/dlog"
 )
 
 const (
 	DEFAULT_CLUSTER_FILE = "cluster.yml"
 	DEFAULT_PROFILE_FILE = "profile.yml"
+	DEFAULT_PRICE_FILE   = "prices.yml"
 )
 
 func GetClusterSubCmdFlags(name, signature, description string, exitOnError bool) *flag.FlagSet {
@@ -42,11 +45,16 @@ type ClusterCli struct {
 
 func (dcli *DockerfCli) CmdCluster(args ...string) error {
 	ClusterFlag.Parse(args)
+	dcluster.StrictDecoding = *flStrict
+	if err := initOutput(*flOutput); err != nil {
+		fmt.Printf("dockerf cluster: %s\n", err.Error())
+		os.Exit(1)
+	}
 	clusterCli := newClusterCli()
 	clusterCli.dockerfCli = dcli
 	if err := clusterCli.Cmd(ClusterFlag.Args()...); err != nil {
 		fmt.Printf("Command execute error: '%s'\n", err.Error())
-		os.Exit(0)
+		os.Exit(1)
 	}
 	return nil
 }
@@ -67,48 +75,374 @@ func (ccli *ClusterCli) Cmd(args ...string) error {
 	return ccli.CmdHelp()
 }
 
+// the cluster files, which are merged in order.
+func addFileFlag(fs *flag.FlagSet) opts.ListOpts {
+	files := opts.NewListOpts(nil)
+	fs.Var(&files, []string{"f", "-file"}, "Name of the Cluster yaml file(Default is PATH/cluster.yml), the later files override the earlier ones...")
+	return files
+}
+
+type deployFlags struct {
+	files         opts.ListOpts
+	mScaleIn      *bool
+	mScaleOut     *bool
+	cFilter       opts.ListOpts
+	cRemove       *bool
+	cScaleIn      *bool
+	cScaleOut     *bool
+	cStep         *int
+	profileFile   *string
+	activeProfile *string
+}
+
+func addDeployFlags(fs *flag.FlagSet) *deployFlags {
+	df := &deployFlags{}
+	df.files = addFileFlag(fs)
+
+	df.mScaleIn = fs.Bool([]string{"-m-scale-in"}, false, "Destroy extra num of machines, where extra-num is active machines minus necessaries in cluster.yml")
+	df.mScaleOut = fs.Bool([]string{"-m-scale-out"}, false, "Create extra num of machines, where extra-num is necessary machines minus actives in cluster.yml")
+
+	df.cFilter = opts.NewListOpts(nil)
+	fs.Var(&df.cFilter, []string{"-c-filter"}, "Filter containers to operate, basedd on conditions provided")
+	df.cRemove = fs.Bool([]string{"-c-rm"}, true, "Remove the stopped containers.")
+	df.cScaleIn = fs.Bool([]string{"-c-scale-in"}, false, "Stop extra num of containers, where extra-num is active machines minus necessaries in cluster.yml")
+	df.cScaleOut = fs.Bool([]string{"-c-scale-out"}, false, "Run extra num of container, where extra-num is necessary machines minus actives in cluster.yml")
+	df.cStep = fs.Int([]string{"-c-step-percent"}, 25, "Process the percent of total container simultaneously")
+	df.profileFile = fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	df.activeProfile = fs.String([]string{"-profile"}, "", "Active profile name.")
+	// flCForceRestart := fs.Bool([]string{"-c-force-restart"}, false, "Force restart an running container, when the image is eual with which configured in cluster.yml")
+	return df
+}
+
 func (ccli *ClusterCli) CmdDeploy(args ...string) error {
 	fs := GetClusterSubCmdFlags("deploy", " PATH", "Deploy all containers on the cluster, which dedcriped by yaml file at PATH", true)
-	flFile := fs.String([]string{"f", "-file"}, "", "Name of the Cluster yaml file(Default is PATH/cluster.yml)...")
+	df := addDeployFlags(fs)
 
-	flMScaleIn := fs.Bool([]string{"-m-scale-in"}, false, "Destroy extra num of machines, where extra-num is active machines minus necessaries in cluster.yml")
-	flMScaleOut := fs.Bool([]string{"-m-scale-out"}, false, "Create extra num of machines, where extra-num is necessary machines minus actives in cluster.yml")
+	fs.Parse(args)
 
-	flCFilter := opts.NewListOpts(nil)
-	fs.Var(&flCFilter, []string{"-c-filter"}, "Filter containers to operate, basedd on conditions provided")
-	flCRemove := fs.Bool([]string{"-c-rm"}, true, "Remove the stopped containers.")
-	flCScaleIn := fs.Bool([]string{"-c-scale-in"}, false, "Stop extra num of containers, where extra-num is active machines minus necessaries in cluster.yml")
-	flCScaleOut := fs.Bool([]string{"-c-scale-out"}, false, "Run extra num of container, where extra-num is necessary machines minus actives in cluster.yml")
-	flCStep := fs.Int([]string{"-c-step-percent"}, 25, "Process the percent of total container simultaneously")
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'deploy' requires 1 argument. \n")
+		os.Exit(1)
+	}
+
+	containerFilters := ccli.parseContainerFilters(df)
+
+	path := fs.Args()[0]
+	// all the problems of the cluster file are reported before anything is changed.
+	if report := validateCluster(df.files.GetAll(), path, *df.activeProfile, *df.profileFile); report.HasErrors() {
+		report.Print(dlog.Out)
+		fmt.Printf("dockerf cluster: the cluster is not deployed, fix the errors above and try again.\n")
+		os.Exit(1)
+	}
+	cluster := buildCluster(df.files.GetAll(), path, *df.activeProfile, *df.profileFile)
+
+	context, err := dcontext.NewClusterContext(*df.mScaleIn, *df.mScaleOut, *df.cScaleIn, *df.cScaleOut, *df.cRemove, containerFilters, *df.cStep, cluster)
+	if err != nil {
+		return exitWithError(err)
+	}
+	defer context.Close()
+
+	if err := context.Deploy(); err != nil {
+		context.Report().AddError(err)
+	}
+	return exitWithReport(context)
+}
+
+// writes a report with the error of a command failed before the cluster context is ready, and exits.
+func exitWithError(err error) error {
+	report := dcontext.NewDeployReport()
+	report.AddError(err)
+	if outErr := writeOutput(report); outErr != nil {
+		return outErr
+	}
+	os.Exit(report.ExitCode())
+	return nil
+}
+
+// writes the report, and exits with non-zero if anything failed.
+func exitWithReport(context *dcontext.ClusterContext) error {
+	if err := writeOutput(context.Report()); err != nil {
+		return err
+	}
+	if code := context.Report().ExitCode(); code != dcontext.EXIT_OK {
+		// the deferred functions are not run by os.Exit.
+		context.Close()
+		os.Exit(code)
+	}
+	return nil
+}
+
+// writes the report of the changes the context made, with the error of the command in it.
+func writeReport(context *dcontext.ClusterContext, err error) error {
+	if err != nil {
+		context.Report().AddError(err)
+	}
+	if outErr := writeOutput(context.Report()); outErr != nil {
+		return outErr
+	}
+	return err
+}
+
+func (ccli *ClusterCli) CmdPlan(args ...string) error {
+	fs := GetClusterSubCmdFlags("plan", " PATH", "Show the changes a deploy would make on the cluster described by yaml file at PATH, without changing anything", true)
+	df := addDeployFlags(fs)
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'plan' requires 1 argument. \n")
+		os.Exit(1)
+	}
+
+	containerFilters := ccli.parseContainerFilters(df)
+
+	path := fs.Args()[0]
+	cluster := buildCluster(df.files.GetAll(), path, *df.activeProfile, *df.profileFile)
+
+	context, err := dcontext.NewReadonlyClusterContext(*df.mScaleIn, *df.mScaleOut, *df.cScaleIn, *df.cScaleOut, *df.cRemove, containerFilters, cluster)
+	if err != nil {
+		return err
+	}
+	plan, err := context.Plan()
+	if err != nil {
+		return err
+	}
+	return writeOutput(plan)
+}
+
+func (ccli *ClusterCli) CmdValidate(args ...string) error {
+	fs := GetClusterSubCmdFlags("validate", " PATH", "Check the cluster described by yaml file at PATH and its profile, and report all the problems found", true)
+	flFiles := addFileFlag(fs)
 	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
 	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
-	// flCForceRestart := fs.Bool([]string{"-c-force-restart"}, false, "Force restart an running container, when the image is eual with which configured in cluster.yml")
 
 	fs.Parse(args)
 
 	if len(fs.Args()) != 1 {
-		fmt.Printf("dockerf cluster: 'deploy' requires 1 argument. \n")
+		fmt.Printf("dockerf cluster: 'validate' requires 1 argument. \n")
 		os.Exit(1)
 	}
 
-	filterLen := flCFilter.Len()
-	_, exists := flCFilter.GetMap()["group"]
-	if filterLen > 1 || (filterLen == 1 && !exists) {
-		if *flCScaleOut || *flCScaleIn {
-			fmt.Printf("Can not '--c-scale-in' and '-c-scale-out' while '--c-filter' set with several filters\n")
+	report := validateCluster(flFiles.GetAll(), fs.Args()[0], *flActiveProfile, *flProfileFile)
+	if err := writeOutput(report); err != nil {
+		return err
+	}
+	if report.HasErrors() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (ccli *ClusterCli) CmdConfig(args ...string) error {
+	fs := GetClusterSubCmdFlags("config", " PATH", "Print the cluster described by yaml files at PATH, with the files merged and the profile applied", true)
+	flFiles := addFileFlag(fs)
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'config' requires 1 argument. \n")
+		os.Exit(1)
+	}
+
+	files, profileFile := clusterFiles(flFiles.GetAll(), fs.Args()[0], *flProfileFile)
+	config, err := dcluster.LoadClusterConfig(files, *flActiveProfile, profileFile)
+	if err != nil {
+		exitOnClusterFileError(files, err)
+	}
+	return writeOutput(config)
+}
+
+func (ccli *ClusterCli) CmdStatus(args ...string) error {
+	fs := GetClusterSubCmdFlags("status", " PATH", "Show the desired and actual state of every group of the cluster described by yaml file at PATH", true)
+	flFiles := addFileFlag(fs)
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'status' requires 1 argument. \n")
+		os.Exit(1)
+	}
+
+	path := fs.Args()[0]
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	context, err := dcontext.NewReadonlyClusterContext(false, false, false, false, false, map[string]string{}, cluster)
+	if err != nil {
+		return err
+	}
+	status, err := context.Status()
+	if err != nil {
+		return err
+	}
+	return writeOutput(status)
+}
+
+func (ccli *ClusterCli) CmdCost(args ...string) error {
+	fs := GetClusterSubCmdFlags("cost", " PATH", "Sum the prices of the instance types the machine groups of the cluster described by yaml file at PATH are created with", true)
+	flFiles := addFileFlag(fs)
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+	flPriceFile := fs.String([]string{"-price-file"}, "", "Name of the yaml file with the price of every instance type(Default is PATH/prices.yml)")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'cost' requires 1 argument. \n")
+		os.Exit(1)
+	}
+
+	path := fs.Args()[0]
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	priceFile := *flPriceFile
+	if priceFile == "" {
+		priceFile = strings.TrimSuffix(path, "/") + "/" + DEFAULT_PRICE_FILE
+	}
+	prices, err := dcontext.LoadPriceTable(priceFile)
+	if err != nil {
+		return err
+	}
+	cost := dcontext.Cost(cluster, prices)
+	if err := writeOutput(cost); err != nil {
+		return err
+	}
+	if !cost.Complete() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func (ccli *ClusterCli) CmdWatch(args ...string) error {
+	fs := GetClusterSubCmdFlags("watch", " PATH", "Keep the cluster described by yaml file at PATH running as described: start or create the machines of every group up to its minnum, run the containers of every group up to its num, and register the services again, round by round until interrupted", true)
+	flFiles := addFileFlag(fs)
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+	flInterval := fs.Duration([]string{"-interval"}, dcontext.WATCH_INTERVAL, "Time between the rounds")
+	flMaxBackoff := fs.Duration([]string{"-max-backoff"}, dcontext.WATCH_MAX_BACKOFF, "Maximal time between the rounds, which is doubled after a failed round")
+	flRemove := fs.Bool([]string{"-c-rm"}, true, "Remove the stopped containers.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'watch' requires 1 argument. \n")
+		os.Exit(1)
+	}
+	if *flInterval <= 0 || *flMaxBackoff < *flInterval {
+		fmt.Printf("dockerf cluster: the interval must be positive, and the max backoff must be no less than the interval. \n")
+		os.Exit(1)
+	}
+
+	path := fs.Args()[0]
+	if report := validateCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile); report.HasErrors() {
+		report.Print(dlog.Out)
+		fmt.Printf("dockerf cluster: the cluster is not watched, fix the errors above and try again.\n")
+		os.Exit(1)
+	}
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	// the cluster must be deployed already, and only the machines and containers lost are brought back.
+	context, err := dcontext.NewReadonlyClusterContext(false, true, false, true, *flRemove, map[string]string{}, cluster)
+	if err != nil {
+		return err
+	}
+	context.Watch(*flInterval, *flMaxBackoff, func(report *dcontext.DeployReport) {
+		if !report.HasChanges() {
+			return
 		}
+		if err := writeOutput(report); err != nil {
+			log.Errorf("Failed to write the report of the watch. err:%s", err.Error())
+		}
+	})
+	return nil
+}
+
+func (ccli *ClusterCli) CmdStart(args ...string) error {
+	return ccli.operate("start", "Start the stopped containers and machines of the cluster described by yaml file at PATH", args...)
+}
+
+func (ccli *ClusterCli) CmdStop(args ...string) error {
+	return ccli.operate("stop", "Stop the running containers and machines of the cluster described by yaml file at PATH", args...)
+}
+
+func (ccli *ClusterCli) CmdRestart(args ...string) error {
+	return ccli.operate("restart", "Restart the containers and machines of the cluster described by yaml file at PATH", args...)
+}
+
+// start, stop or restart the filtered containers, or the machines of the groups if '--m-group' provided.
+func (ccli *ClusterCli) operate(name, description string, args ...string) error {
+	fs := GetClusterSubCmdFlags(name, " PATH", description, true)
+	flFiles := addFileFlag(fs)
+	flCFilter := opts.NewListOpts(nil)
+	fs.Var(&flCFilter, []string{"-c-filter"}, "Filter containers to operate, basedd on conditions provided. The service discovery containers are operated only if their group is named by 'group=GROUP'")
+	flMGroup := opts.NewListOpts(nil)
+	fs.Var(&flMGroup, []string{"-m-group"}, "Operate the machines of the group and the containers on them, instead of the filtered containers")
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: '%s' requires 1 argument. \n", name)
+		os.Exit(1)
 	}
 
 	containerFilters := ccli.resolveFilterParam(flCFilter)
-
-	ccli.checkContainerFilter(containerFilters, *flCScaleOut, *flCScaleIn)
+	if err := ccli.checkContainerFilter(containerFilters, false, false); err != nil {
+		fmt.Printf("dockerf cluster: %s. \n", err.Error())
+		os.Exit(1)
+	}
 
 	path := fs.Args()[0]
-	cluster := buildCluster(*flFile, path, *flActiveProfile, *flProfileFile)
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	context, err := dcontext.NewLockedClusterContext(false, false, false, false, false, containerFilters, 0, cluster)
+	if err != nil {
+		return err
+	}
+	defer context.Close()
+
+	if groups := flMGroup.GetAll(); len(groups) > 0 {
+		switch name {
+		case "start":
+			err = context.StartMachines(groups)
+		case "stop":
+			err = context.StopMachines(groups)
+		default:
+			err = context.RestartMachines(groups)
+		}
+		return writeReport(context, err)
+	}
+	switch name {
+	case "start":
+		err = context.StartContainers()
+	case "stop":
+		err = context.StopContainers()
+	default:
+		err = context.RestartContainers()
+	}
+	return writeReport(context, err)
+}
+
+func (ccli *ClusterCli) parseContainerFilters(df *deployFlags) map[string]string {
+	filterLen := df.cFilter.Len()
+	_, exists := df.cFilter.GetMap()["group"]
+	if filterLen > 1 || (filterLen == 1 && !exists) {
+		if *df.cScaleOut || *df.cScaleIn {
+			dlog.Printf("Can not '--c-scale-in' and '-c-scale-out' while '--c-filter' set with several filters\n")
+		}
+	}
 
-	context := dcontext.NewClusterContext(*flMScaleIn, *flMScaleOut, *flCScaleIn, *flCScaleOut, *flCRemove, containerFilters, *flCStep, cluster)
+	containerFilters := ccli.resolveFilterParam(df.cFilter)
 
-	return context.Deploy()
+	if err := ccli.checkContainerFilter(containerFilters, *df.cScaleOut, *df.cScaleIn); err != nil {
+		fmt.Printf("dockerf cluster: %s. \n", err.Error())
+		os.Exit(1)
+	}
+	return containerFilters
 }
 
 func (c *ClusterCli) resolveFilterParam(flCFilter opts.ListOpts) map[string]string {
@@ -122,27 +456,158 @@ func (c *ClusterCli) resolveFilterParam(flCFilter opts.ListOpts) map[string]stri
 			value := strings.TrimSpace(filter[index+1:])
 			filterMapResult[name] = value
 		} else {
-			fmt.Println(fmt.Sprintf("Ignore container filter options: %s", filter))
+			dlog.Println(fmt.Sprintf("Ignore container filter options: %s", filter))
 		}
 	}
 
 	return filterMapResult
 }
 
-func (c *ClusterCli) checkContainerFilter(filters map[string]string, flCScaleOut bool, flCScaleIn bool) {
+func (c *ClusterCli) checkContainerFilter(filters map[string]string, flCScaleOut bool, flCScaleIn bool) error {
 	filterLen := len(filters)
 	if filterLen > 0 {
 		if _, exist := filters["group"]; !exist {
-			panic("Container filter should contains group filter! ")
+			return fmt.Errorf("container filter should contains group filter, such as '--c-filter group=GROUP'")
 		}
 		if filterLen > 1 && (flCScaleOut || flCScaleIn) {
-			panic("Can not '--c-scale-in' and '-c-scale-out' while '--c-filter' set with several filters")
+			return fmt.Errorf("can not '--c-scale-in' and '--c-scale-out' while '--c-filter' set with several filters")
 		}
 	}
+	return nil
 }
 
-func (ccli *ClusterCli) resizeMachine(context *dcontext.ClusterContext, cluster *dcluster.Cluster, scaleIn, scaleOut bool) error {
-	return nil
+func (ccli *ClusterCli) CmdRollback(args ...string) error {
+	fs := GetClusterSubCmdFlags("rollback", " PATH", "Redeploy a container group of the cluster described by yaml file at PATH with the image, env and ports of a recorded revision", true)
+	flFiles := addFileFlag(fs)
+	flGroup := fs.String([]string{"-group"}, "", "The container group to roll back")
+	flRevision := fs.Int([]string{"-to-revision"}, 0, "The revision to roll back to. The one before the latest revision if not provided")
+	flList := fs.Bool([]string{"-list"}, false, "List the recorded revisions of the group, instead of rolling back")
+	flCRemove := fs.Bool([]string{"-c-rm"}, true, "Remove the stopped containers.")
+	flCStep := fs.Int([]string{"-c-step-percent"}, 25, "Process the percent of total container simultaneously")
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'rollback' requires 1 argument. \n")
+		os.Exit(1)
+	}
+	if *flGroup == "" {
+		fmt.Printf("dockerf cluster: 'rollback' requires '--group'. \n")
+		os.Exit(1)
+	}
+
+	path := fs.Args()[0]
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+	containerFilters := map[string]string{"group": *flGroup}
+
+	if *flList {
+		context, err := dcontext.NewReadonlyClusterContext(false, false, false, false, false, containerFilters, cluster)
+		if err != nil {
+			return err
+		}
+		history, err := context.History(*flGroup)
+		if err != nil {
+			return err
+		}
+		return writeOutput(history)
+	}
+
+	// only the group is redeployed, so neither the master nor the service discovery groups are touched.
+	context, err := dcontext.NewLockedClusterContext(false, false, false, false, *flCRemove, containerFilters, *flCStep, cluster)
+	if err != nil {
+		return exitWithError(err)
+	}
+	defer context.Close()
+	if err := context.Rollback(*flGroup, *flRevision); err != nil {
+		context.Report().AddError(err)
+	}
+	return exitWithReport(context)
+}
+
+func (ccli *ClusterCli) CmdLock(args ...string) error {
+	fs := GetClusterSubCmdFlags("lock", " status|break PATH", "Show or break the deploy lock of the cluster described by yaml file at PATH", true)
+	flFiles := addFileFlag(fs)
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 2 {
+		fmt.Printf("dockerf cluster: 'lock' requires 2 arguments. \n")
+		os.Exit(1)
+	}
+	action := fs.Args()[0]
+	if action != "status" && action != "break" {
+		fmt.Printf("dockerf cluster: '%s' is not a lock command, 'status' or 'break' expected. \n", action)
+		os.Exit(1)
+	}
+
+	path := fs.Args()[1]
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	context, err := dcontext.NewReadonlyClusterContext(false, false, false, false, false, map[string]string{}, cluster)
+	if err != nil {
+		return err
+	}
+	if action == "break" {
+		broken, err := context.BreakLock()
+		if err != nil {
+			return err
+		}
+		if broken.Locked {
+			fmt.Printf("The lock held by %s@%s is broken.\n", broken.Holder.Owner, broken.Holder.Host)
+		}
+	}
+	status, err := context.LockStatus()
+	if err != nil {
+		return err
+	}
+	return writeOutput(status)
+}
+
+func (ccli *ClusterCli) CmdResize(args ...string) error {
+	fs := GetClusterSubCmdFlags("resize", " PATH", "Create or destroy machines of the cluster described by yaml file at PATH, as needed", true)
+	flFiles := addFileFlag(fs)
+	flGroup := fs.String([]string{"-group"}, "", "The machine group to resize. All groups are resized into their 'minnum' and 'maxnum' if not provided")
+	flNum := fs.Int([]string{"-num"}, -1, "The num of running machines the group is resized to")
+	flForce := fs.Bool([]string{"-force"}, false, "Resize the group even if '--num' is out of its 'minnum' and 'maxnum'")
+	flProfileFile := fs.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := fs.String([]string{"-profile"}, "", "Active profile name.")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 1 {
+		fmt.Printf("dockerf cluster: 'resize' requires 1 argument. \n")
+		os.Exit(1)
+	}
+	if *flGroup != "" && *flNum < 0 {
+		fmt.Printf("dockerf cluster: 'resize' requires '--num' while '--group' provided. \n")
+		os.Exit(1)
+	}
+
+	path := fs.Args()[0]
+	if report := validateCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile); report.HasErrors() {
+		report.Print(dlog.Out)
+		fmt.Printf("dockerf cluster: the cluster is not resized, fix the errors above and try again.\n")
+		os.Exit(1)
+	}
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	context, err := dcontext.NewLockedClusterContext(false, false, false, false, false, map[string]string{}, 0, cluster)
+	if err != nil {
+		return err
+	}
+	defer context.Close()
+	return writeReport(context, ccli.resizeMachine(context, *flGroup, *flNum, *flForce))
+}
+
+func (ccli *ClusterCli) resizeMachine(context *dcontext.ClusterContext, group string, num int, force bool) error {
+	if group == "" {
+		return context.ResizeMachines()
+	}
+	return context.ResizeMachineGroup(group, num, force)
 }
 
 func (ccli *ClusterCli) CmdHelp(args ...string) error {
@@ -173,29 +638,49 @@ func (ccli *ClusterCli) getMethod(args ...string) (func(...string) error, bool)
 	return method.Interface().(func(...string) error), true
 }
 
-func buildCluster(name, path, profile, profileFileName string) *dcluster.Cluster {
-	fileName := name
-	if fileName == "" {
-		fileName = DEFAULT_CLUSTER_FILE
+// the cluster files and the profile file of the cluster at path.
+func clusterFiles(names []string, path, profileFileName string) ([]string, string) {
+	if len(names) == 0 {
+		names = []string{DEFAULT_CLUSTER_FILE}
 	}
 	if profileFileName == "" {
 		profileFileName = DEFAULT_PROFILE_FILE
 	}
-	file := ""
+	files := []string{}
 	seperator := "/"
-	if strings.HasSuffix(path, seperator) {
-		file = path + fileName
+	for _, fileName := range names {
+		if strings.HasSuffix(path, seperator) {
+			files = append(files, path+fileName)
+		} else {
+			files = append(files, path+seperator+fileName)
+		}
+	}
+	return files, profileFileName
+}
+
+func exitOnClusterFileError(files []string, err error) {
+	if os.IsNotExist(err) {
+		fmt.Printf("Cannot locate Clusterfile: '%s'\n", strings.Join(files, "', '"))
 	} else {
-		file = path + seperator + fileName
+		fmt.Printf("Read Clusterfile '%s' error: '%s'\n", strings.Join(files, "', '"), err.Error())
 	}
-	cluster, err := dcluster.NewCluster(file, profile, profileFileName)
+	os.Exit(1)
+}
+
+func buildCluster(names []string, path, profile, profileFileName string) *dcluster.Cluster {
+	files, profileFileName := clusterFiles(names, path, profileFileName)
+	cluster, err := dcluster.NewClusterFromFiles(files, profile, profileFileName)
 	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Printf("Cannot locate Clusterfile: '%s'\n", file)
-		} else {
-			fmt.Printf("Read Clusterfile '%s' error: '%s'\n", file, err.Error())
-		}
-		os.Exit(1)
+		exitOnClusterFileError(files, err)
 	}
 	return cluster
 }
+
+func validateCluster(names []string, path, profile, profileFileName string) *dcluster.ValidationReport {
+	files, profileFileName := clusterFiles(names, path, profileFileName)
+	report, err := dcluster.Validate(files, profile, profileFileName)
+	if err != nil {
+		exitOnClusterFileError(files, err)
+	}
+	return report
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/weibocom/dockerf/cluster/context"
+)
+
+func (cli *DockerfCli) CmdMachine(args ...string) error {
+	help := "Usage: dockerf machine COMMAND [args]\n\nManage the machines of a cluster.\n\nCommands:\n"
+	for _, command := range [][]string{
+		{"cordon", "Take a machine out of the scheduling"},
+		{"drain", "Move all the running containers off a machine"},
+		{"uncordon", "Put a cordoned machine back into the scheduling"},
+	} {
+		help += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
+	}
+	help += "\nRun 'dockerf machine COMMAND --help' for more information on a command."
+	fmt.Fprintf(cli.out, "%s\n", help)
+	return nil
+}
+
+func (cli *DockerfCli) CmdMachineDrain(args ...string) error {
+	cmd := cli.Subcmd("machine drain", "NAME PATH", "Move all the running containers off the machine NAME to the other machines of their groups, in the cluster described by yaml file at PATH. Each container is stopped once its replacement passes the health check and is registered. The machine is cordoned, and kept cordoned after the drain.", true)
+	flFiles := addFileFlag(cmd)
+	flProfileFile := cmd.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := cmd.String([]string{"-profile"}, "", "Active profile name.")
+	flForce := cmd.Bool([]string{"-force"}, false, "Stop the containers of the groups not in the cluster file, which can not be replaced")
+	flOutput := cmd.String([]string{"o", "-output"}, OUTPUT_TEXT, "Output format of the results: text, json or yaml")
+	cmd.Parse(args)
+
+	if len(cmd.Args()) != 2 {
+		fmt.Fprintf(cli.err, "dockerf: 'machine drain' requires 2 arguments.\n")
+		os.Exit(1)
+	}
+	if err := initOutput(*flOutput); err != nil {
+		fmt.Fprintf(cli.err, "dockerf machine drain: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	name, path := cmd.Args()[0], cmd.Args()[1]
+	cluster := buildCluster(flFiles.GetAll(), path, *flActiveProfile, *flProfileFile)
+
+	context, err := dcontext.NewLockedClusterContext(false, false, false, false, false, map[string]string{}, 0, cluster)
+	if err != nil {
+		return err
+	}
+	defer context.Close()
+	if err := context.DrainMachine(name, *flForce); err != nil {
+		context.Report().AddError(err)
+	}
+	return exitWithReport(context)
+}
+
+func (cli *DockerfCli) CmdMachineCordon(args ...string) error {
+	cmd := cli.Subcmd("machine cordon", "NAME PATH", "Take the machine NAME out of the scheduling of the cluster described by yaml file at PATH. No new container runs on it, and the running ones are kept.", true)
+	flFiles := addFileFlag(cmd)
+	flProfileFile := cmd.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := cmd.String([]string{"-profile"}, "", "Active profile name.")
+	flReason := cmd.String([]string{"-reason"}, "", "Why the machine is cordoned, such as a kernel upgrade.")
+	flOutput := cmd.String([]string{"o", "-output"}, OUTPUT_TEXT, "Output format of the results: text, json or yaml")
+	cmd.Parse(args)
+
+	return cli.cordon("cordon", cmd.Args(), flFiles.GetAll(), *flActiveProfile, *flProfileFile, *flOutput, func(context *dcontext.ClusterContext, name string) error {
+		return context.Cordon(name, *flReason)
+	})
+}
+
+func (cli *DockerfCli) CmdMachineUncordon(args ...string) error {
+	cmd := cli.Subcmd("machine uncordon", "NAME PATH", "Put the cordoned machine NAME back into the scheduling of the cluster described by yaml file at PATH.", true)
+	flFiles := addFileFlag(cmd)
+	flProfileFile := cmd.String([]string{"--profile-file"}, "", "Name of the profile yaml file(Default is PATH/profile.yml)... ")
+	flActiveProfile := cmd.String([]string{"-profile"}, "", "Active profile name.")
+	flOutput := cmd.String([]string{"o", "-output"}, OUTPUT_TEXT, "Output format of the results: text, json or yaml")
+	cmd.Parse(args)
+
+	return cli.cordon("uncordon", cmd.Args(), flFiles.GetAll(), *flActiveProfile, *flProfileFile, *flOutput, func(context *dcontext.ClusterContext, name string) error {
+		return context.Uncordon(name)
+	})
+}
+
+// cordon or uncordon the machine, and list the cordoned machines then. The error is reported like drain.
+func (cli *DockerfCli) cordon(command string, args, files []string, activeProfile, profileFile, output string, action func(context *dcontext.ClusterContext, name string) error) error {
+	if len(args) != 2 {
+		fmt.Fprintf(cli.err, "dockerf: 'machine %s' requires 2 arguments.\n", command)
+		os.Exit(1)
+	}
+	if err := initOutput(output); err != nil {
+		fmt.Fprintf(cli.err, "dockerf machine %s: %s\n", command, err.Error())
+		os.Exit(1)
+	}
+
+	name, path := args[0], args[1]
+	cluster := buildCluster(files, path, activeProfile, profileFile)
+
+	context, err := dcontext.NewLockedClusterContext(false, false, false, false, false, map[string]string{}, 0, cluster)
+	if err != nil {
+		return err
+	}
+	defer context.Close()
+	if err := action(context, name); err != nil {
+		context.Report().AddError(err)
+		return exitWithReport(context)
+	}
+	return writeOutput(context.Cordons())
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func (cli *DockerfCli) CmdSecret(args ...string) error {
+	help := "Usage: dockerf secret COMMAND [args]\n\nManage the encrypted values in the cluster files and the profile files.\n\nCommands:\n"
+	for _, command := range [][]string{
+		{"encrypt", "Encrypt a value, which can be put in the cluster files"},
+		{"decrypt", "Decrypt an encrypted value"},
+		{"rotate", "Re-encrypt all the encrypted values in files with a new key"},
+	} {
+		help += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
+	}
+	help += "\nRun 'dockerf secret COMMAND --help' for more information on a command."
+	fmt.Fprintf(cli.out, "%s\n", help)
+	return nil
+}
+
+// the value in the arguments, or the first line of the stdin, so the value is not left in the shell history.
+func (cli *DockerfCli) readSecretValue(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	line, err := bufio.NewReader(cli.in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("Failed to read the value from stdin: %s", err.Error())
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (cli *DockerfCli) CmdSecretEncrypt(args ...string) error {
+	cmd := cli.Subcmd("secret encrypt", "[VALUE]", "Encrypt the VALUE, or the line read from stdin, with the secret key. A key is generated if there is none.", true)
+	flKeyFile := cmd.String([]string{"k", "-key-file"}, "", "The secret key file(Default is $"+dcluster.SECRET_KEY_ENV+", $"+dcluster.SECRET_KEY_FILE_ENV+" or ~/"+dcluster.DEFAULT_SECRET_KEY_FILE+")")
+	cmd.Parse(args)
+
+	key, err := dcluster.LoadSecretKey(*flKeyFile)
+	if os.IsNotExist(err) {
+		file := *flKeyFile
+		if file == "" {
+			file = dcluster.SecretKeyFile()
+		}
+		if key, err = dcluster.GenerateSecretKey(); err != nil {
+			return err
+		}
+		if err := key.Save(file); err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.err, "A new secret key is generated at %s, keep it safe and out of git.\n", file)
+	} else if err != nil {
+		return err
+	}
+
+	value, err := cli.readSecretValue(cmd.Args())
+	if err != nil {
+		return err
+	}
+	encrypted, err := key.Encrypt(value)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cli.out, encrypted)
+	return nil
+}
+
+func (cli *DockerfCli) CmdSecretDecrypt(args ...string) error {
+	cmd := cli.Subcmd("secret decrypt", "[VALUE]", "Decrypt the encrypted VALUE, or the line read from stdin, with the secret key.", true)
+	flKeyFile := cmd.String([]string{"k", "-key-file"}, "", "The secret key file(Default is $"+dcluster.SECRET_KEY_ENV+", $"+dcluster.SECRET_KEY_FILE_ENV+" or ~/"+dcluster.DEFAULT_SECRET_KEY_FILE+")")
+	cmd.Parse(args)
+
+	key, err := dcluster.LoadSecretKey(*flKeyFile)
+	if err != nil {
+		return err
+	}
+	encrypted, err := cli.readSecretValue(cmd.Args())
+	if err != nil {
+		return err
+	}
+	value, err := key.Decrypt(strings.TrimSpace(encrypted))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cli.out, value)
+	return nil
+}
+
+func (cli *DockerfCli) CmdSecretRotate(args ...string) error {
+	cmd := cli.Subcmd("secret rotate", "FILE [FILE...]", "Re-encrypt all the encrypted values in the FILEs with the new key. The new key is generated if its file does not exist.", true)
+	flKeyFile := cmd.String([]string{"k", "-key-file"}, "", "The current secret key file(Default is $"+dcluster.SECRET_KEY_ENV+", $"+dcluster.SECRET_KEY_FILE_ENV+" or ~/"+dcluster.DEFAULT_SECRET_KEY_FILE+")")
+	flNewKeyFile := cmd.String([]string{"-new-key-file"}, "", "The new secret key file")
+	cmd.Parse(args)
+
+	if *flNewKeyFile == "" || len(cmd.Args()) == 0 {
+		fmt.Fprintf(cli.err, "dockerf secret: 'rotate' requires --new-key-file and at least 1 file.\n")
+		os.Exit(1)
+	}
+
+	oldKey, err := dcluster.LoadSecretKey(*flKeyFile)
+	if err != nil {
+		return err
+	}
+	newKey, err := dcluster.LoadSecretKey(*flNewKeyFile)
+	generated := false
+	if os.IsNotExist(err) {
+		if newKey, err = dcluster.GenerateSecretKey(); err != nil {
+			return err
+		}
+		generated = true
+	} else if err != nil {
+		return err
+	}
+	if string(newKey) == string(oldKey) {
+		return fmt.Errorf("The new key in %s is the same as the current one", *flNewKeyFile)
+	}
+
+	// all the files are re-encrypted before any is written, so a broken value leaves them untouched.
+	contents := map[string]string{}
+	for _, file := range cmd.Args() {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		content, n, err := dcluster.ReplaceEncrypted(string(b), func(encrypted string) (string, error) {
+			value, err := oldKey.Decrypt(encrypted)
+			if err != nil {
+				return "", err
+			}
+			return newKey.Encrypt(value)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		contents[file] = content
+		fmt.Fprintf(cli.out, "%d value(s) re-encrypted in %s\n", n, file)
+	}
+	if generated {
+		if err := newKey.Save(*flNewKeyFile); err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.out, "A new secret key is generated at %s\n", *flNewKeyFile)
+	}
+	for _, file := range cmd.Args() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, []byte(contents[file]), info.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	"github.com/weibocom/dockerf/dlog"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+	OUTPUT_YAML = "yaml"
+)
+
+type printable interface {
+	Print(w io.Writer)
+}
+
+var (
+	outputFormat = OUTPUT_TEXT
+	// where the results are written. The progress messages are written to dlog.Out.
+	documentOut io.Writer = os.Stdout
+)
+
+// json and yaml documents are written to stdout, and the progress messages to stderr,
+// so the documents can be parsed by other programs.
+func initOutput(format string) error {
+	switch format {
+	case OUTPUT_TEXT:
+	case OUTPUT_JSON, OUTPUT_YAML:
+		dlog.Out = os.Stderr
+	default:
+		return fmt.Errorf("'%s' is not a valid output format, 'text', 'json' or 'yaml' expected.", format)
+	}
+	outputFormat = format
+	return nil
+}
+
+// the secrets decrypted from the cluster files are masked in all the documents.
+func writeOutput(doc printable) error {
+	var out []byte
+	switch outputFormat {
+	case OUTPUT_JSON:
+		b, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return err
+		}
+		out = append(b, '\n')
+	case OUTPUT_YAML:
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		out = b
+	default:
+		buf := &bytes.Buffer{}
+		doc.Print(buf)
+		out = buf.Bytes()
+	}
+	fmt.Fprint(documentOut, dcluster.MaskSecrets(string(out)))
+	return nil
+}
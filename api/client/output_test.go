@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/weibocom/dockerf/cluster/context"
+	"github.com/weibocom/dockerf/dlog"
+	"gopkg.in/yaml.v2"
+)
+
+func TestInitOutput(t *testing.T) {
+	defer func() {
+		outputFormat = OUTPUT_TEXT
+		dlog.Out = os.Stdout
+	}()
+	tests := []struct {
+		format   string
+		progress *os.File
+		valid    bool
+	}{
+		{OUTPUT_TEXT, os.Stdout, true},
+		{OUTPUT_JSON, os.Stderr, true},
+		{OUTPUT_YAML, os.Stderr, true},
+		{"xml", os.Stdout, false},
+	}
+	for _, test := range tests {
+		outputFormat = OUTPUT_TEXT
+		dlog.Out = os.Stdout
+		err := initOutput(test.format)
+		if (err == nil) != test.valid {
+			t.Errorf("format %s: expected valid %v, but got error %v", test.format, test.valid, err)
+			continue
+		}
+		if dlog.Out != test.progress {
+			t.Errorf("format %s: expected the progress written to %s, but got %v", test.format, test.progress.Name(), dlog.Out)
+		}
+		if test.valid && outputFormat != test.format {
+			t.Errorf("format %s: expected the output format set, but got %s", test.format, outputFormat)
+		}
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	defer func() {
+		outputFormat = OUTPUT_TEXT
+		documentOut = os.Stdout
+	}()
+	report := context.NewDeployReport()
+	report.AddError(errors.New("Failed to load containers."))
+
+	for _, format := range []string{OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_YAML} {
+		buf := &bytes.Buffer{}
+		documentOut = buf
+		outputFormat = format
+		if err := writeOutput(report); err != nil {
+			t.Errorf("format %s: failed to write the report: %s", format, err.Error())
+			continue
+		}
+		decoded := context.NewDeployReport()
+		switch format {
+		case OUTPUT_JSON:
+			if err := json.Unmarshal(buf.Bytes(), decoded); err != nil {
+				t.Errorf("The json report is expected to be parsed, but got %s:\n%s", err.Error(), buf.String())
+			}
+		case OUTPUT_YAML:
+			if err := yaml.Unmarshal(buf.Bytes(), decoded); err != nil {
+				t.Errorf("The yaml report is expected to be parsed, but got %s:\n%s", err.Error(), buf.String())
+			}
+		default:
+			if !strings.Contains(buf.String(), "error: Failed to load containers.") {
+				t.Errorf("The text report is expected to print the error, but got:\n%s", buf.String())
+			}
+			continue
+		}
+		if len(decoded.Errors) != 1 || decoded.Errors[0] != "Failed to load containers." {
+			t.Errorf("format %s: the error is expected in the report, but got %+v", format, decoded.Errors)
+		}
+	}
+}
@@ -8,9 +8,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 
-	"errors"
 	"os"
 	"regexp"
+	"sort"
+	"time"
 
 	dutils "github.com/weibocom/dockerf/utils"
 	"gopkg.in/yaml.v2"
@@ -33,6 +34,7 @@ type MachineDescription struct {
 	DriverOpts []string
 	Cloud      string
 	Group      string
+	Labels     map[string]string // the engine labels of the machines, matched by the placement of the containers
 }
 
 func (md *MachineDescription) GetCpu() int {
@@ -42,26 +44,28 @@ func (md *MachineDescription) GetCpu() int {
 	return md.Cpu
 }
 
-func (md *MachineDescription) GetMemInBytes() int {
+// the memory of the machines in bytes, 512m if not given.
+func (md *MachineDescription) GetMemInBytes() (int64, error) {
 	if md.Memory == "" {
-		return 512 * 1024 * 1024 // default is 512m
+		return 512 * 1024 * 1024, nil // default is 512m
 	}
-	if bytes, err := dutils.ParseCapacity(md.Memory); err != nil {
-		panic(fmt.Sprintf("'%s' is not a valid memory option.", md.Memory))
-	} else {
-		return bytes
+	bytes, err := dutils.ParseCapacity(md.Memory)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a valid memory of machine group '%s'.", md.Memory, md.Group)
 	}
+	return int64(bytes), nil
 }
 
-func (md *MachineDescription) GetDiskCapacityInBytes() int {
+// the disk capacity of the machines in bytes, 20g if not given.
+func (md *MachineDescription) GetDiskCapacityInBytes() (int64, error) {
 	if md.Disk.Capacity == "" {
-		return 20 * 1024 * 1024 * 1024 // default is 10gb
+		return 20 * 1024 * 1024 * 1024, nil // default is 20gb
 	}
-	if bytes, err := dutils.ParseCapacity(md.Disk.Capacity); err != nil {
-		panic(fmt.Sprintf("'%s' is not a valid ssd capacity option.", md.Disk.Capacity))
-	} else {
-		return bytes
+	bytes, err := dutils.ParseCapacity(md.Disk.Capacity)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a valid disk capacity of machine group '%s'.", md.Disk.Capacity, md.Group)
 	}
+	return int64(bytes), nil
 }
 
 type CloudDrivers map[string]CloudDriverDescription
@@ -83,6 +87,20 @@ type MachineCluster struct {
 	Topology MachineTopology
 }
 
+// the cloud driver the machines of the group are created by, the default one if the group has no cloud. Empty if
+// neither is given.
+func (mc *MachineCluster) GetDriverName(md *MachineDescription) string {
+	if md.Cloud != "" {
+		return md.Cloud
+	}
+	for name, driver := range mc.Cloud {
+		if driver.Default {
+			return name
+		}
+	}
+	return ""
+}
+
 func (cds *CloudDrivers) SurportedDrivers() []string {
 	names := []string{}
 	for name, _ := range *cds {
@@ -110,7 +128,77 @@ const (
 	ContainerDescription_TYPE_SD = 1
 	ContainerDescription_TYPE_BZ = 2
 	MultiPort_Separator          = "|"
-	CONFIG_PLACEHOLDER_PATTERN   = "\\$\\{(\\w+)\\}"
+	CONFIG_PLACEHOLDER_PATTERN   = "\\$\\{(env:)?(\\w+)(:-([^}]*))?\\}" // ${key}, ${key:-default}, ${env:NAME} or ${env:NAME:-default}
+	PROFILE_EXTENDS_KEY          = "extends"
+)
+
+const (
+	DEFAULT_HEALTH_CHECK_TIMEOUT  = 5 * time.Second
+	DEFAULT_HEALTH_CHECK_INTERVAL = 5 * time.Second
+	DEFAULT_HEALTH_CHECK_RETRIES  = 3
+)
+
+// HealthCheck is how a container is checked after it runs. One of HTTP, TCP and Cmd is expected.
+type HealthCheck struct {
+	HTTP        string // the path requested on the port, such as '/health'
+	Port        int    // the container port the http path is requested on, the service port if not given
+	TCP         int    // the container port to connect
+	Cmd         string // the command executed in the container
+	Timeout     string
+	Interval    string
+	Retries     int
+	MaxFailures int `yaml:"max-failures"` // the deploy is aborted once so many containers of the group failed
+}
+
+func (hc *HealthCheck) Enabled() bool {
+	return hc.HTTP != "" || hc.TCP > 0 || hc.Cmd != ""
+}
+
+func parseDuration(d string, defaultDuration time.Duration) (time.Duration, error) {
+	if d == "" {
+		return defaultDuration, nil
+	}
+	return time.ParseDuration(d)
+}
+
+func (hc *HealthCheck) GetTimeout() (time.Duration, error) {
+	return parseDuration(hc.Timeout, DEFAULT_HEALTH_CHECK_TIMEOUT)
+}
+
+func (hc *HealthCheck) GetInterval() (time.Duration, error) {
+	return parseDuration(hc.Interval, DEFAULT_HEALTH_CHECK_INTERVAL)
+}
+
+func (hc *HealthCheck) GetRetries() int {
+	if hc.Retries <= 0 {
+		return DEFAULT_HEALTH_CHECK_RETRIES
+	}
+	return hc.Retries
+}
+
+// the failed containers a rolling deploy of the group is aborted at, 0 for never.
+// A group without health check is never aborted, as before.
+func (hc *HealthCheck) GetMaxFailures() int {
+	if !hc.Enabled() {
+		return 0
+	}
+	if hc.MaxFailures <= 0 {
+		return 1
+	}
+	return hc.MaxFailures
+}
+
+const (
+	HOOK_POLICY_IGNORE   = "ignore" // a failed hook is logged, and the operation goes on
+	HOOK_POLICY_ABORT    = "abort"  // a failed hook aborts the operation of the container
+	DEFAULT_HOOK_TIMEOUT = 30 * time.Second
+)
+
+const (
+	RESTART_POLICY_NO             = "no" // the containers are not restarted by docker, the default
+	RESTART_POLICY_ON_FAILURE     = "on-failure"
+	RESTART_POLICY_ALWAYS         = "always"
+	RESTART_POLICY_UNLESS_STOPPED = "unless-stopped"
 )
 
 type ContainerDescription struct {
@@ -118,20 +206,318 @@ type ContainerDescription struct {
 	Image           string
 	PreStop         string
 	PostStart       string
+	HookTimeout     string `yaml:"hook-timeout"`
+	HookPolicy      string `yaml:"hook-policy"`
 	URL             string
 	Port            string
+	Ports           []PortDescription // more ports besides Port
 	Deps            []string
-	ServiceDiscover string
-	Restart         bool
+	ServiceDiscover string // the service discover the first port is registered with
+	Restart         bool   // the containers are restarted on deploy
+	RestartPolicy   string `yaml:"restart-policy"` // how docker restarts the containers: no, on-failure[:N], always or unless-stopped
 	Machine         string
 	PortBinding     PortBinding
+	PortBindings    []PortBinding `yaml:"-"` // the bindings of all the ports, the first is PortBinding
 	Volums          []string
+	Volumes         []string // the alias of Volums
 	Group           string
 	Env             []string
+	HealthCheck     HealthCheck
+	Memory          string // such as 512m, the memory is not limited if empty
+	MemorySwap      string `yaml:"memory-swap"` // the memory plus swap, -1 means the swap is not limited
+	CpuShares       int    `yaml:"cpu-shares"`  // the relative weight of cpu, 1024 is the default of docker
+	Cpuset          string // the cpus the containers run on, such as 0-2 or 0,1
+	Command         Command
+	Entrypoint      Command
+	Labels          map[string]string
+	Hostname        string
+	User            string
+	WorkDir         string
+	Privileged      bool
+	CapAdd          []string `yaml:"cap-add"`
+	CapDrop         []string `yaml:"cap-drop"`
+	Ulimits         []string // such as nofile=1024:2048, or nproc=512 for the same soft and hard limits
+	ExtraHosts      []string `yaml:"extra-hosts"` // such as db:10.0.0.2
+	Placement       Placement
 	DepLevel        int
 	Type            int
 }
 
+// Placement is the rules of the machines the containers of a group run on.
+type Placement struct {
+	Spread        bool              // spread the containers evenly across the machines of the group
+	MaxPerMachine int               `yaml:"max-per-machine"` // at most so many containers of the group on a machine, unlimited if 0
+	AntiAffinity  []string          `yaml:"anti-affinity"`   // the groups whose containers never share a machine with the ones of the group
+	Labels        map[string]string // the labels the machines must have
+	Region        string            // the region the machines must be in
+}
+
+// IsSet tells whether any rule is set. The containers are placed by swarm without rules.
+func (p *Placement) IsSet() bool {
+	return p.Spread || p.MaxPerMachine > 0 || len(p.AntiAffinity) > 0 || len(p.Labels) > 0 || p.Region != ""
+}
+
+// Matches tells whether the machines of the group satisfy the labels and the region of the placement.
+func (p *Placement) Matches(md *MachineDescription) error {
+	if p.Region != "" && p.Region != md.Region {
+		return fmt.Errorf("machine group '%s' is in region '%s', but '%s' is required", md.Group, md.Region, p.Region)
+	}
+	keys := []string{}
+	for k := range p.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if md.Labels[k] != p.Labels[k] {
+			return fmt.Errorf("machine group '%s' has no label %s=%s", md.Group, k, p.Labels[k])
+		}
+	}
+	return nil
+}
+
+// PortDescription is a port of the containers in the style of the port of the group, such as 8000~8100:8080/tcp,
+// and the service discover it is registered with.
+type PortDescription struct {
+	Port            string
+	Protocol        string // overrides the protocol in the port
+	ServiceDiscover string
+}
+
+// a port is the port string only, or a map with the protocol and the service discover.
+func (pd *PortDescription) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	port := ""
+	if err := unmarshal(&port); err == nil {
+		pd.Port = port
+		return nil
+	}
+	type plain PortDescription
+	return unmarshal((*plain)(pd))
+}
+
+// the port string with the protocol overridden.
+func (pd *PortDescription) spec() string {
+	if pd.Protocol == "" {
+		return pd.Port
+	}
+	cp := ContainerPort(pd.Port)
+	return cp.buildContainerPort(pd.Protocol, cp.GetContainerPort(), cp.GetHostPort())
+}
+
+// GetPorts returns the port of the group followed by the ports. The first port is registered with
+// the service discover of the group if it chooses none.
+func (cd *ContainerDescription) GetPorts() []PortDescription {
+	ports := []PortDescription{}
+	if cd.Port != "" {
+		ports = append(ports, PortDescription{Port: cd.Port})
+	}
+	ports = append(ports, cd.Ports...)
+	if len(ports) > 0 && ports[0].ServiceDiscover == "" {
+		ports[0].ServiceDiscover = cd.ServiceDiscover
+	}
+	return ports
+}
+
+// ParsePorts parses the bindings of all the ports, the first one is the PortBinding.
+func (cd *ContainerDescription) ParsePorts() error {
+	ports := cd.GetPorts()
+	if len(ports) == 0 {
+		return fmt.Errorf("No port found for container group '%s', 'port' or 'ports' expected", cd.Group)
+	}
+	bindings := []PortBinding{}
+	for _, p := range ports {
+		binding := PortBinding{}
+		if err := binding.Parse(p.spec()); err != nil {
+			return err
+		}
+		binding.ServiceDiscover = p.ServiceDiscover
+		bindings = append(bindings, binding)
+	}
+	cd.PortBinding = bindings[0]
+	cd.PortBindings = bindings
+	return nil
+}
+
+// GetServiceDiscovers returns the service discovers the ports are registered with.
+func (cd *ContainerDescription) GetServiceDiscovers() []string {
+	sds := []string{}
+	seen := map[string]bool{}
+	for _, p := range cd.GetPorts() {
+		if p.ServiceDiscover != "" && !seen[p.ServiceDiscover] {
+			seen[p.ServiceDiscover] = true
+			sds = append(sds, p.ServiceDiscover)
+		}
+	}
+	return sds
+}
+
+// Command is a command line split like the shell does, or a list of the arguments.
+type Command []string
+
+func (c *Command) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	args := []string{}
+	if err := unmarshal(&args); err == nil {
+		*c = args
+		return nil
+	}
+	line := ""
+	if err := unmarshal(&line); err != nil {
+		return err
+	}
+	args, err := SplitCommand(line)
+	if err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// SplitCommand splits the command line into the arguments, with the quotes and the escapes like the shell.
+func SplitCommand(line string) ([]string, error) {
+	args := []string{}
+	arg := ""
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg += string(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg += string(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg)
+				arg, inArg = "", false
+			}
+		default:
+			arg += string(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("The quote or the escape is not closed in command: %s", line)
+	}
+	if inArg {
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// Ulimit is a resource limit of the processes in the containers.
+type Ulimit struct {
+	Name string
+	Soft uint64
+	Hard uint64
+}
+
+// parse the ulimit such as nofile=1024:2048, or nproc=512 for the same soft and hard limits.
+func ParseUlimit(ulimit string) (Ulimit, error) {
+	parts := strings.SplitN(ulimit, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return Ulimit{}, fmt.Errorf("'%s' is not a valid ulimit, such as nofile=1024:2048 expected", ulimit)
+	}
+	limits := strings.SplitN(parts[1], ":", 2)
+	soft, err := strconv.ParseUint(strings.TrimSpace(limits[0]), 10, 64)
+	if err != nil {
+		return Ulimit{}, fmt.Errorf("'%s' is not a valid ulimit, such as nofile=1024:2048 expected", ulimit)
+	}
+	hard := soft
+	if len(limits) == 2 {
+		if hard, err = strconv.ParseUint(strings.TrimSpace(limits[1]), 10, 64); err != nil {
+			return Ulimit{}, fmt.Errorf("'%s' is not a valid ulimit, such as nofile=1024:2048 expected", ulimit)
+		}
+	}
+	if soft > hard {
+		return Ulimit{}, fmt.Errorf("The soft limit is greater than the hard limit in ulimit '%s'", ulimit)
+	}
+	return Ulimit{Name: strings.TrimSpace(parts[0]), Soft: soft, Hard: hard}, nil
+}
+
+func (cd *ContainerDescription) GetUlimits() ([]Ulimit, error) {
+	ulimits := []Ulimit{}
+	for _, u := range cd.Ulimits {
+		ulimit, err := ParseUlimit(u)
+		if err != nil {
+			return nil, err
+		}
+		ulimits = append(ulimits, ulimit)
+	}
+	return ulimits, nil
+}
+
+func parseLimit(capacity string) (int64, error) {
+	if capacity == "" {
+		return 0, nil
+	}
+	bytes, err := dutils.ParseCapacity(capacity)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a valid capacity", capacity)
+	}
+	return int64(bytes), nil
+}
+
+// the memory limit in bytes, 0 if not limited.
+func (cd *ContainerDescription) GetMemInBytes() (int64, error) {
+	return parseLimit(cd.Memory)
+}
+
+// the memory plus swap limit in bytes, 0 if not limited.
+func (cd *ContainerDescription) GetMemorySwapInBytes() (int64, error) {
+	if strings.TrimSpace(cd.MemorySwap) == "-1" {
+		return -1, nil
+	}
+	return parseLimit(cd.MemorySwap)
+}
+
+func (cd *ContainerDescription) GetHookTimeout() (time.Duration, error) {
+	return parseDuration(cd.HookTimeout, DEFAULT_HOOK_TIMEOUT)
+}
+
+func (cd *ContainerDescription) GetHookPolicy() string {
+	if cd.HookPolicy == "" {
+		return HOOK_POLICY_IGNORE
+	}
+	return cd.HookPolicy
+}
+
+// GetRestartPolicy returns the name of the restart policy, and the max retries of on-failure, 0 if unlimited.
+func (cd *ContainerDescription) GetRestartPolicy() (string, int, error) {
+	policy := strings.TrimSpace(cd.RestartPolicy)
+	if policy == "" {
+		return RESTART_POLICY_NO, 0, nil
+	}
+	parts := strings.SplitN(policy, ":", 2)
+	name := parts[0]
+	switch name {
+	case RESTART_POLICY_NO, RESTART_POLICY_ALWAYS, RESTART_POLICY_UNLESS_STOPPED:
+		if len(parts) == 2 {
+			return "", 0, fmt.Errorf("The max retries is only allowed for '%s', but found in '%s'", RESTART_POLICY_ON_FAILURE, policy)
+		}
+		return name, 0, nil
+	case RESTART_POLICY_ON_FAILURE:
+		if len(parts) == 1 {
+			return name, 0, nil
+		}
+		maxTry, err := strconv.Atoi(parts[1])
+		if err != nil || maxTry < 0 {
+			return "", 0, fmt.Errorf("'%s' is not a valid max retries of restart policy '%s'", parts[1], policy)
+		}
+		return name, maxTry, nil
+	}
+	return "", 0, fmt.Errorf("'%s' is not a valid restart policy, one of %s, %s[:N], %s and %s expected", policy, RESTART_POLICY_NO, RESTART_POLICY_ON_FAILURE, RESTART_POLICY_ALWAYS, RESTART_POLICY_UNLESS_STOPPED)
+}
+
 type SortContainerDescriptionDescByLevel []ContainerDescription
 
 func (s SortContainerDescriptionDescByLevel) Len() int {
@@ -192,10 +578,6 @@ type ServiceDiscoverDiscription map[string]string
 
 type Profile map[string]string
 
-func (p *Profile) lenth() int {
-	return len(map[string]string(*p))
-}
-
 type Cluster struct {
 	ClusterBy   string // such as swarm
 	Master      string
@@ -208,6 +590,9 @@ type Cluster struct {
 
 	ServiceDiscover map[string]ServiceDiscoverDiscription
 	ConsulCluster   ConsulDescription
+
+	// the profile applied to the cluster file, empty if no profile file found.
+	ActiveProfile string `yaml:"-"`
 }
 
 type ClusterProfiles struct {
@@ -219,45 +604,89 @@ func (p *ClusterProfiles) findProfile(profileName string) (Profile, error) {
 	if profileName != "" {
 		p.ActiveProfile = profileName
 	}
+	return p.resolveProfile(p.ActiveProfile, []string{})
+}
 
-	if profile, exist := p.Profiles[p.ActiveProfile]; !exist {
-		return nil, errors.New(fmt.Sprintf("Fail to find profile %s in config files, please check again... ", p.ActiveProfile))
-	} else {
-		return profile, nil
+// resolve the profile with the values of the profiles it extends, which are overridden by its own.
+func (p *ClusterProfiles) resolveProfile(profileName string, extended []string) (Profile, error) {
+	profile, exist := p.Profiles[profileName]
+	if !exist {
+		if len(extended) > 0 {
+			return nil, fmt.Errorf("Fail to find profile %s extended by profile %s, please check again... ", profileName, extended[len(extended)-1])
+		}
+		return nil, fmt.Errorf("Fail to find profile %s in config files, please check again... ", profileName)
 	}
+	for _, name := range extended {
+		if name == profileName {
+			return nil, fmt.Errorf("Profile %s extends itself: %s -> %s", profileName, strings.Join(extended, " -> "), profileName)
+		}
+	}
+	resolved := Profile{}
+	if base := profile[PROFILE_EXTENDS_KEY]; base != "" {
+		values, err := p.resolveProfile(base, append(extended, profileName))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			resolved[key] = value
+		}
+	}
+	for key, value := range profile {
+		if key != PROFILE_EXTENDS_KEY {
+			resolved[key] = value
+		}
+	}
+	return resolved, nil
 }
 
 func NewCluster(configFilePos, profileName, profileFileName string) (*Cluster, error) {
+	return NewClusterFromFiles([]string{configFilePos}, profileName, profileFileName)
+}
 
-	clusterProfiles, exist, err := resolveProfileFile(profileFileName)
+// NewClusterFromFiles builds the cluster from the cluster files merged in order,
+// the groups in the later files override the ones of the same names in the earlier files.
+func NewClusterFromFiles(configFiles []string, profileName, profileFileName string) (*Cluster, error) {
+	profile, activeProfile, err := loadProfile(profileName, profileFileName)
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := ioutil.ReadFile(configFilePos)
+	report := &ValidationReport{}
+	merged, err := newConfigLoader(report, profile, activeProfile).load(configFiles)
 	if err != nil {
 		return nil, err
 	}
-	if exist {
-		profile, err := clusterProfiles.findProfile(profileName)
-		if err != nil {
-			return nil, err
-		}
-		log.Debugf("Use profile %+v", profile)
-		b = []byte(applyProfile(profile, string(b)))
+	if err := report.err(); err != nil {
+		return nil, err
 	}
 
-	c := &Cluster{}
-	err = yaml.Unmarshal(b, c)
+	c, err := decodeCluster(merged)
 	if err != nil {
 		return nil, err
 	}
 
-	c.replaceClusterConfigInfo()
+	if err := c.replaceClusterConfigInfo(); err != nil {
+		return nil, err
+	}
+	c.ActiveProfile = activeProfile
 
 	return c, nil
 }
 
+// the active profile and its name. The profile is nil if no profile file is found.
+func loadProfile(profileName, profileFileName string) (Profile, string, error) {
+	clusterProfiles, exist, err := resolveProfileFile(profileFileName)
+	if err != nil || !exist {
+		return nil, "", err
+	}
+	profile, err := clusterProfiles.findProfile(profileName)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Debugf("Use profile %+v", profile)
+	return profile, clusterProfiles.ActiveProfile, nil
+}
+
 func resolveProfileFile(profileFileName string) (*ClusterProfiles, bool, error) {
 	clusterProfiles := &ClusterProfiles{}
 	b, err := ioutil.ReadFile(profileFileName)
@@ -268,6 +697,9 @@ func resolveProfileFile(profileFileName string) (*ClusterProfiles, bool, error)
 			return nil, true, err
 		}
 	}
+	if err := checkUnknownKeys(profileFileName, string(b), clusterProfiles); err != nil {
+		return nil, true, err
+	}
 	err = yaml.Unmarshal(b, clusterProfiles)
 	if err != nil {
 		return nil, true, err
@@ -275,31 +707,115 @@ func resolveProfileFile(profileFileName string) (*ClusterProfiles, bool, error)
 	return clusterProfiles, true, nil
 }
 
-func applyProfile(profile Profile, configContent string) string {
-	if profile.lenth() <= 0 {
-		return configContent
+// the value of the placeholder, from the profile, the environment variables or the default in it.
+// A nil profile means no profile file is found.
+func resolvePlaceholder(profile Profile, profileName string, placeholder []string) (string, error) {
+	isEnv, key, hasDefault, defaultValue := placeholder[1] != "", placeholder[2], placeholder[3] != "", placeholder[4]
+	if isEnv {
+		if value, exist := os.LookupEnv(key); exist {
+			return value, nil
+		}
+	} else if value, exist := profile[key]; exist {
+		return value, nil
 	}
+	switch {
+	case hasDefault:
+		return defaultValue, nil
+	case isEnv:
+		return "", fmt.Errorf("environment variable '%s' of placeholder '%s' is not set", key, placeholder[0])
+	case profile == nil:
+		return "", fmt.Errorf("placeholder '%s' is not resolved, no profile file is found", placeholder[0])
+	default:
+		return "", fmt.Errorf("placeholder '%s' is not defined in profile '%s'", placeholder[0], profileName)
+	}
+}
 
-	reg := regexp.MustCompile(CONFIG_PLACEHOLDER_PATTERN)
-	return reg.ReplaceAllStringFunc(configContent, func(b string) string {
-		key := reg.ReplaceAllString(b, "${1}")
-		if value, exist := profile[key]; exist {
-			return value
-		} else {
-			panic(fmt.Sprintf("Fail to apply profile , because a config item named %s is not well configured..,", key))
+// the value is quoted if it is not a plain yaml scalar, such as ': ', ' #' or a leading '*' in it.
+func needsQuote(value string) bool {
+	if value == "" {
+		return false
+	}
+	return strings.TrimSpace(value) != value ||
+		strings.ContainsAny(value, "\n\t") ||
+		strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.HasSuffix(value, ":") ||
+		strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`", rune(value[0]))
+}
+
+func escapeDoubleQuoted(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t").Replace(value)
+}
+
+// escape the value substituted at the position of the line, so the line is still decoded as it looks like.
+func escapeValue(line string, pos int, placeholder, value string) (string, error) {
+	before, after := line[:pos], line[pos+len(placeholder):]
+	switch {
+	case strings.Count(before, "\"")%2 == 1:
+		return escapeDoubleQuoted(value), nil
+	case strings.Count(before, "'")%2 == 1:
+		if strings.ContainsAny(value, "\n") {
+			return "", fmt.Errorf("the multi-line value of placeholder '%s' can not be in a single-quoted string", placeholder)
+		}
+		return strings.Replace(value, "'", "''", -1), nil
+	case !needsQuote(value):
+		return value, nil
+	case placeholderValuePattern.MatchString(before) && strings.TrimSpace(strings.SplitN(after, " #", 2)[0]) == "":
+		// the placeholder is the whole value.
+		return "\"" + escapeDoubleQuoted(value) + "\"", nil
+	default:
+		return "", fmt.Errorf("the value of placeholder '%s' has yaml special characters, make the placeholder the whole value, or quote it", placeholder)
+	}
+}
+
+var placeholderValuePattern = regexp.MustCompile(`^\s*(-\s+)*([^\s#'"][^:#]*:\s+)?$`)
+
+// substitute the matches of the pattern in the line with the values resolved.
+// The matches not resolved are left as they are, and reported to onError.
+func substituteLine(line string, reg *regexp.Regexp, resolve func(match []string) (string, error), onError func(err error)) string {
+	result := ""
+	last := 0
+	for _, idx := range reg.FindAllStringSubmatchIndex(line, -1) {
+		match := []string{}
+		for i := 0; i < len(idx); i += 2 {
+			if idx[i] < 0 {
+				match = append(match, "")
+			} else {
+				match = append(match, line[idx[i]:idx[i+1]])
+			}
 		}
-	})
+		value, err := resolve(match)
+		if err == nil {
+			value, err = escapeValue(line, idx[0], match[0], value)
+		}
+		if err != nil {
+			onError(err)
+			value = match[0]
+		}
+		result += line[last:idx[0]] + value
+		last = idx[1]
+	}
+	return result + line[last:]
+}
+
+// substitute the placeholders in the line, and decrypt the encrypted values then, in the line or from the profile.
+func applyProfileLine(profile Profile, profileName string, line string, onError func(err error)) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return line
+	}
+	line = substituteLine(line, regexp.MustCompile(CONFIG_PLACEHOLDER_PATTERN), func(placeholder []string) (string, error) {
+		return resolvePlaceholder(profile, profileName, placeholder)
+	}, onError)
+	return substituteLine(line, encryptedPattern, func(encrypted []string) (string, error) {
+		return decryptSecret(encrypted[0])
+	}, onError)
 }
 
 func (cluster *Cluster) parsePortBindings() error {
 	for group, description := range cluster.Container.Topology {
-		binding := PortBinding{}
-		if err := binding.Parse(description.Port); err != nil {
+		if err := description.ParsePorts(); err != nil {
 			return err
 		}
-		description.PortBinding = binding
 		cluster.Container.Topology[group] = description
-		log.Debugf("Port binding parsed. group: %s, binding:%+v\n", description.Group, binding)
+		log.Debugf("Port binding parsed. group: %s, bindings:%+v\n", description.Group, description.PortBindings)
 	}
 	return nil
 }
@@ -314,23 +830,8 @@ func (cluster *Cluster) parseMultiPort(cd ContainerDescription) []ContainerDescr
 		ports := strings.Split(hostport, MultiPort_Separator)
 		for _, p := range ports {
 			newHostPort := ContainerPort(port).buildContainerPort(protocol, containerPort, p)
-			newContainerDescription := ContainerDescription{
-				Num:             cd.Num,
-				Image:           cd.Image,
-				PreStop:         cd.PreStop,
-				PostStart:       cd.PostStart,
-				URL:             cd.URL,
-				Port:            newHostPort,
-				Deps:            cd.Deps,
-				ServiceDiscover: cd.ServiceDiscover,
-				Restart:         cd.Restart,
-				Machine:         cd.Machine,
-				Volums:          cd.Volums,
-				Group:           cd.Group,
-				Env:             cd.Env,
-				DepLevel:        cd.DepLevel,
-				Type:            cd.Type,
-			}
+			newContainerDescription := cd
+			newContainerDescription.Port = newHostPort
 			cds = append(cds, newContainerDescription)
 		}
 		return cds
@@ -338,30 +839,39 @@ func (cluster *Cluster) parseMultiPort(cd ContainerDescription) []ContainerDescr
 	return []ContainerDescription{cd}
 }
 
-func (cluster *Cluster) replaceClusterConfigInfo() {
-	cluster.replaceContainerConfigInfo()
+func (cluster *Cluster) replaceClusterConfigInfo() error {
+	return cluster.replaceContainerConfigInfo()
 }
 
-func (cluster *Cluster) replaceContainerConfigInfo() {
+func (cluster *Cluster) replaceContainerConfigInfo() error {
 	replacedContainerInfo := ContainerCluster{}
 	replacedTopology := ContainerTopology{}
 	for _, containerInfo := range cluster.Container.Topology {
+		containerInfo.Volums = append(containerInfo.Volums, containerInfo.Volumes...)
+		containerInfo.Volumes = nil
 		replacedTopology = append(replacedTopology, cluster.parseMultiPort(containerInfo)...)
 	}
 	replacedContainerInfo.Topology = replacedTopology
 	cluster.Container = replacedContainerInfo
 
 	if err := cluster.parsePortBindings(); err != nil {
-		log.Fatal("Fail to parse port binding info, please check config file... ")
+		return fmt.Errorf("Fail to parse port binding info, please check config file... %s", err.Error())
 	}
 
 	for index, containerInfo := range cluster.Container.Topology {
 		cluster.Container.Topology[index] = cluster.replaceContainerPlaceholder(containerInfo)
 	}
+	return nil
 }
 
 func (cluster *Cluster) replaceContainerPlaceholder(cd ContainerDescription) ContainerDescription {
 	cd.URL = strings.Replace(cd.URL, "{port}", strconv.Itoa(cd.PortBinding.GetHostPort()), -1)
 	cd.Group = strings.Replace(cd.Group, "{port}", strconv.Itoa(cd.PortBinding.GetHostPort()), -1)
+	// the groups expanded from the same one share the slice.
+	antiAffinity := []string{}
+	for _, group := range cd.Placement.AntiAffinity {
+		antiAffinity = append(antiAffinity, strings.Replace(group, "{port}", strconv.Itoa(cd.PortBinding.GetHostPort()), -1))
+	}
+	cd.Placement.AntiAffinity = antiAffinity
 	return cd
 }
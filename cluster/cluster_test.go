@@ -2,8 +2,12 @@ package cluster
 
 import (
 	// "fmt"
-	"github.com/weibocom/dockerf/cluster"
+	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 // func TestNewCluster(t *testing.T) {
@@ -29,10 +33,346 @@ func TestCheckAndApplyProfile(t *testing.T) {
 	file := "../cluster.aliyun.usertag.multiprofile.yml"
 	profile := "../profile.yml"
 
-	cluster, err := cluster.NewCluster(file, "", profile)
+	cluster, err := NewCluster(file, "", profile)
 
 	if err != nil {
 		t.Errorf("Parse Cluster Failed:%s\n", err.Error())
 	}
 	t.Logf("Cluster Parsed:\n%+v", cluster)
 }
+
+func TestResolveProfile(t *testing.T) {
+	profiles := &ClusterProfiles{
+		ActiveProfile: "test",
+		Profiles: map[string]Profile{
+			"production": {"master": "usertag-master-1", "num": "2"},
+			"test":       {"extends": "production", "master": "usertag-master-2"},
+			"dev":        {"extends": "test", "num": "1"},
+			"loop-a":     {"extends": "loop-b"},
+			"loop-b":     {"extends": "loop-a"},
+			"orphan":     {"extends": "missing"},
+		},
+	}
+	tests := []struct {
+		name     string
+		expected Profile
+		valid    bool
+	}{
+		{"production", Profile{"master": "usertag-master-1", "num": "2"}, true},
+		{"test", Profile{"master": "usertag-master-2", "num": "2"}, true},
+		{"dev", Profile{"master": "usertag-master-2", "num": "1"}, true},
+		{"loop-a", nil, false},
+		{"orphan", nil, false},
+		{"missing", nil, false},
+	}
+	for _, test := range tests {
+		profile, err := profiles.resolveProfile(test.name, []string{})
+		if (err == nil) != test.valid {
+			t.Errorf("profile %s: expected valid %v, but got error %v", test.name, test.valid, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(profile, test.expected) {
+			t.Errorf("profile %s: expected %v, but got %v", test.name, test.expected, profile)
+		}
+	}
+}
+
+func TestApplyProfileLine(t *testing.T) {
+	os.Setenv("DOCKERF_TEST_REGISTRY", "registry.test.com")
+	os.Unsetenv("DOCKERF_TEST_UNSET")
+	defer os.Unsetenv("DOCKERF_TEST_REGISTRY")
+
+	profile := Profile{
+		"master":  "usertag-master-1",
+		"command": "nginx -g 'daemon off;'",
+		"comment": "a: b # c",
+	}
+	tests := []struct {
+		line     string
+		expected string
+		valid    bool
+	}{
+		{`master: ${master}`, `master: usertag-master-1`, true},
+		{`num: ${num:-3}`, `num: 3`, true},
+		{`image: ${env:DOCKERF_TEST_REGISTRY}/nginx`, `image: registry.test.com/nginx`, true},
+		{`image: ${env:DOCKERF_TEST_UNSET:-hub}/nginx`, `image: hub/nginx`, true},
+		{`# master: ${undefined}`, `# master: ${undefined}`, true},
+		{`command: ${command}`, `command: nginx -g 'daemon off;'`, true},
+		{`comment: ${comment}`, `comment: "a: b # c"`, true},
+		{`  - ${comment}`, `  - "a: b # c"`, true},
+		{`comment: "${comment} and ${master}"`, `comment: "a: b # c and usertag-master-1"`, true},
+		{`comment: '${command}'`, `comment: 'nginx -g ''daemon off;'''`, true},
+		{`comment: see ${comment}`, `comment: see ${comment}`, false},
+		{`image: ${env:DOCKERF_TEST_UNSET}`, `image: ${env:DOCKERF_TEST_UNSET}`, false},
+		{`num: ${num}`, `num: ${num}`, false},
+	}
+	for _, test := range tests {
+		errs := []error{}
+		line := applyProfileLine(profile, "test", test.line, func(err error) {
+			errs = append(errs, err)
+		})
+		if line != test.expected {
+			t.Errorf("'%s' is expected to be '%s', but got '%s'", test.line, test.expected, line)
+		}
+		if (len(errs) == 0) != test.valid {
+			t.Errorf("'%s': expected valid %v, but got errors %v", test.line, test.valid, errs)
+		}
+	}
+}
+
+func TestContainerLimits(t *testing.T) {
+	tests := []struct {
+		memory     string
+		memorySwap string
+		mem        int64
+		swap       int64
+		valid      bool
+	}{
+		{"", "", 0, 0, true},
+		{"256m", "512m", 256 * 1024 * 1024, 512 * 1024 * 1024, true},
+		{"1g", "-1", 1024 * 1024 * 1024, -1, true},
+		{"256x", "", 0, 0, false},
+		{"256m", "lots", 256 * 1024 * 1024, 0, false},
+	}
+	for _, test := range tests {
+		cd := ContainerDescription{Memory: test.memory, MemorySwap: test.memorySwap}
+		mem, memErr := cd.GetMemInBytes()
+		swap, swapErr := cd.GetMemorySwapInBytes()
+		if valid := memErr == nil && swapErr == nil; valid != test.valid {
+			t.Errorf("memory '%s', memory-swap '%s': expected valid %v, but got memory error %v, memory-swap error %v", test.memory, test.memorySwap, test.valid, memErr, swapErr)
+		}
+		if memErr == nil && mem != test.mem {
+			t.Errorf("memory '%s': expected %d bytes, but got %d", test.memory, test.mem, mem)
+		}
+		if swapErr == nil && swap != test.swap {
+			t.Errorf("memory-swap '%s': expected %d bytes, but got %d", test.memorySwap, test.swap, swap)
+		}
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+		valid    bool
+	}{
+		{``, []string{}, true},
+		{`nginx`, []string{"nginx"}, true},
+		{`  nginx  -g   x `, []string{"nginx", "-g", "x"}, true},
+		{`nginx -g "daemon off;"`, []string{"nginx", "-g", "daemon off;"}, true},
+		{`sh -c 'echo "$HOME"'`, []string{"sh", "-c", `echo "$HOME"`}, true},
+		{`echo a\ b c\"d`, []string{"echo", "a b", `c"d`}, true},
+		{`echo 'a\b'`, []string{"echo", `a\b`}, true},
+		{`echo "" ''`, []string{"echo", "", ""}, true},
+		{`echo a"b c"d`, []string{"echo", "ab cd"}, true},
+		{`echo "not closed`, nil, false},
+		{`echo \`, nil, false},
+	}
+	for _, test := range tests {
+		args, err := SplitCommand(test.line)
+		if (err == nil) != test.valid {
+			t.Errorf("'%s': expected valid %v, but got error %v", test.line, test.valid, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("'%s' is expected to be split into %q, but got %q", test.line, test.expected, args)
+		}
+	}
+}
+
+func TestParseUlimit(t *testing.T) {
+	tests := []struct {
+		ulimit   string
+		expected Ulimit
+		valid    bool
+	}{
+		{"nofile=1024:2048", Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}, true},
+		{"nproc=512", Ulimit{Name: "nproc", Soft: 512, Hard: 512}, true},
+		{" nofile = 1024 : 2048 ", Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}, true},
+		{"nofile=2048:1024", Ulimit{}, false},
+		{"nofile", Ulimit{}, false},
+		{"=1024", Ulimit{}, false},
+		{"nofile=many", Ulimit{}, false},
+		{"nofile=1024:many", Ulimit{}, false},
+		{"nofile=-1", Ulimit{}, false},
+	}
+	for _, test := range tests {
+		ulimit, err := ParseUlimit(test.ulimit)
+		if (err == nil) != test.valid {
+			t.Errorf("'%s': expected valid %v, but got error %v", test.ulimit, test.valid, err)
+			continue
+		}
+		if err == nil && ulimit != test.expected {
+			t.Errorf("'%s' is expected to be parsed as %+v, but got %+v", test.ulimit, test.expected, ulimit)
+		}
+	}
+}
+
+func TestUnmarshalCommand(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected Command
+	}{
+		{`command: nginx -g "daemon off;"`, Command{"nginx", "-g", "daemon off;"}},
+		{`command: [nginx, -g, "daemon off;"]`, Command{"nginx", "-g", "daemon off;"}},
+		{`entrypoint: /entrypoint.sh`, nil},
+	}
+	for _, test := range tests {
+		cd := ContainerDescription{}
+		if err := yaml.Unmarshal([]byte(test.content), &cd); err != nil {
+			t.Errorf("Failed to unmarshal '%s': %s", test.content, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(cd.Command, test.expected) {
+			t.Errorf("'%s' is expected to be unmarshaled as %q, but got %q", test.content, test.expected, cd.Command)
+		}
+	}
+}
+
+func TestGetRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		name   string
+		maxTry int
+		valid  bool
+	}{
+		{"", RESTART_POLICY_NO, 0, true},
+		{"no", RESTART_POLICY_NO, 0, true},
+		{"always", RESTART_POLICY_ALWAYS, 0, true},
+		{"unless-stopped", RESTART_POLICY_UNLESS_STOPPED, 0, true},
+		{"on-failure", RESTART_POLICY_ON_FAILURE, 0, true},
+		{"on-failure:5", RESTART_POLICY_ON_FAILURE, 5, true},
+		{" on-failure:5 ", RESTART_POLICY_ON_FAILURE, 5, true},
+		{"on-failure:-1", "", 0, false},
+		{"on-failure:many", "", 0, false},
+		{"always:5", "", 0, false},
+		{"sometimes", "", 0, false},
+	}
+	for _, test := range tests {
+		cd := ContainerDescription{RestartPolicy: test.policy}
+		name, maxTry, err := cd.GetRestartPolicy()
+		if (err == nil) != test.valid {
+			t.Errorf("'%s': expected valid %v, but got error %v", test.policy, test.valid, err)
+			continue
+		}
+		if err == nil && (name != test.name || maxTry != test.maxTry) {
+			t.Errorf("'%s' is expected to be %s with max retries %d, but got %s with %d", test.policy, test.name, test.maxTry, name, maxTry)
+		}
+	}
+}
+
+func TestHealthCheckMaxFailures(t *testing.T) {
+	tests := []struct {
+		hc       HealthCheck
+		expected int
+	}{
+		{HealthCheck{}, 0},
+		{HealthCheck{MaxFailures: 3}, 0},
+		{HealthCheck{HTTP: "/health"}, 1},
+		{HealthCheck{TCP: 8080, MaxFailures: 3}, 3},
+		{HealthCheck{Cmd: "true", MaxFailures: -1}, 1},
+	}
+	for _, test := range tests {
+		if n := test.hc.GetMaxFailures(); n != test.expected {
+			t.Errorf("The max failures of health check %+v is expected to be %d, but got %d", test.hc, test.expected, n)
+		}
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []PortBinding
+		sds      []string
+	}{
+		{
+			content:  "group: web\nport: 8080\nservicediscover: nginx",
+			expected: []PortBinding{{Protocal: "tcp", HostPort: 8080, ContainerPort: 8080, ServiceDiscover: "nginx"}},
+			sds:      []string{"nginx"},
+		},
+		{
+			content: "group: web\nport: 8000:8080\nservicediscover: nginx\nports:\n  - 9090\n  - port: 9000:53\n    protocol: udp\n    servicediscover: dns\n  - port: 9001:8081\n    servicediscover: nginx",
+			expected: []PortBinding{
+				{Protocal: "tcp", HostPort: 8000, ContainerPort: 8080, ServiceDiscover: "nginx"},
+				{Protocal: "tcp", HostPort: 9090, ContainerPort: 9090},
+				{Protocal: "udp", HostPort: 9000, ContainerPort: 53, ServiceDiscover: "dns"},
+				{Protocal: "tcp", HostPort: 9001, ContainerPort: 8081, ServiceDiscover: "nginx"},
+			},
+			sds: []string{"nginx", "dns"},
+		},
+		{
+			content: "group: web\nservicediscover: nginx\nports:\n  - port: 8080\n  - port: 9090\n    servicediscover: metrics",
+			expected: []PortBinding{
+				{Protocal: "tcp", HostPort: 8080, ContainerPort: 8080, ServiceDiscover: "nginx"},
+				{Protocal: "tcp", HostPort: 9090, ContainerPort: 9090, ServiceDiscover: "metrics"},
+			},
+			sds: []string{"nginx", "metrics"},
+		},
+		{
+			content:  "group: web\nservicediscover: nginx",
+			expected: nil,
+			sds:      []string{},
+		},
+		{
+			content:  "group: web\nports:\n  - http",
+			expected: nil,
+			sds:      []string{},
+		},
+	}
+	for _, test := range tests {
+		cd := ContainerDescription{}
+		if err := yaml.Unmarshal([]byte(test.content), &cd); err != nil {
+			t.Errorf("Failed to unmarshal '%s': %s", test.content, err.Error())
+			continue
+		}
+		err := cd.ParsePorts()
+		if (err == nil) != (test.expected != nil) {
+			t.Errorf("'%s': expected parsed %v, but got error %v", test.content, test.expected != nil, err)
+			continue
+		}
+		if err == nil {
+			bindings := []PortBinding{}
+			for _, binding := range cd.PortBindings {
+				// the ranges of the host ports are not compared.
+				binding.hostPortRange = HostPortRange{}
+				bindings = append(bindings, binding)
+			}
+			if !reflect.DeepEqual(bindings, test.expected) {
+				t.Errorf("'%s' is expected to be parsed as %+v, but got %+v", test.content, test.expected, bindings)
+			}
+			if cd.PortBinding.ContainerPort != test.expected[0].ContainerPort {
+				t.Errorf("'%s': the first binding is expected to be the port binding, but got %+v", test.content, cd.PortBinding)
+			}
+		}
+		if sds := cd.GetServiceDiscovers(); !reflect.DeepEqual(sds, test.sds) {
+			t.Errorf("'%s': expected the service discovers %v, but got %v", test.content, test.sds, sds)
+		}
+	}
+}
+
+func TestHookConfig(t *testing.T) {
+	tests := []struct {
+		timeout  string
+		policy   string
+		duration time.Duration // the timeout expected
+		expected string        // the policy expected
+		valid    bool
+	}{
+		{"", "", DEFAULT_HOOK_TIMEOUT, HOOK_POLICY_IGNORE, true},
+		{"5s", HOOK_POLICY_ABORT, 5 * time.Second, HOOK_POLICY_ABORT, true},
+		{"1m30s", HOOK_POLICY_IGNORE, 90 * time.Second, HOOK_POLICY_IGNORE, true},
+		{"soon", "", 0, HOOK_POLICY_IGNORE, false},
+	}
+	for _, test := range tests {
+		cd := ContainerDescription{HookTimeout: test.timeout, HookPolicy: test.policy}
+		timeout, err := cd.GetHookTimeout()
+		if (err == nil) != test.valid {
+			t.Errorf("hook-timeout '%s': expected valid %v, but got error %v", test.timeout, test.valid, err)
+		} else if err == nil && timeout != test.duration {
+			t.Errorf("hook-timeout '%s' is expected to be %s, but got %s", test.timeout, test.duration, timeout)
+		}
+		if policy := cd.GetHookPolicy(); policy != test.expected {
+			t.Errorf("hook-policy '%s' is expected to be %s, but got %s", test.policy, test.expected, policy)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -58,10 +57,50 @@ type ClusterContext struct {
 	cProxy               *dcontainer.DockerProxy
 	serviceRegistries    map[string]*discovery.ServiceRegisterDriver
 	containerFilterChain *dcontainerfilter.FilterChain
+	report               *DeployReport
+	lock                 *clusterLock
+	kvStore              kvStore // the kv store of the cluster, the consul servers if nil
+	interrupted          int32   // set once the process is interrupted while the cluster is locked
+	placements           *placements
+	cordons              map[string]CordonInfo
 }
 
-func NewClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc bool, cFilter map[string]string, cStepPercent int, cluster *dcluster.Cluster) *ClusterContext {
-	clusterContext := &ClusterContext{
+func NewClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc bool, cFilter map[string]string, cStepPercent int, cluster *dcluster.Cluster) (*ClusterContext, error) {
+	clusterContext := newClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc, cFilter, cStepPercent, cluster)
+	if err := clusterContext.initContext(); err != nil {
+		clusterContext.Close()
+		return nil, err
+	}
+	return clusterContext, nil
+}
+
+// NewReadonlyClusterContext loads the machines and containers of the cluster,
+// but never creates, starts or deploys anything.
+func NewReadonlyClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc bool, cFilter map[string]string, cluster *dcluster.Cluster) (*ClusterContext, error) {
+	clusterContext := newClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc, cFilter, 0, cluster)
+	clusterContext.create = false
+	if err := clusterContext.loadContext(); err != nil {
+		return nil, err
+	}
+	return clusterContext, nil
+}
+
+// NewLockedClusterContext loads the machines and containers of the cluster like NewReadonlyClusterContext, and holds
+// the deploy lock until Close, for the commands changing the running cluster in place, such as resize and rollback.
+// Neither the consul servers nor the master are created or started, and the context fails if the consul servers are
+// not running.
+func NewLockedClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc bool, cFilter map[string]string, cStepPercent int, cluster *dcluster.Cluster) (*ClusterContext, error) {
+	clusterContext := newClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc, cFilter, cStepPercent, cluster)
+	clusterContext.create = false
+	if err := clusterContext.lockContext(); err != nil {
+		clusterContext.Close()
+		return nil, err
+	}
+	return clusterContext, nil
+}
+
+func newClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc bool, cFilter map[string]string, cStepPercent int, cluster *dcluster.Cluster) *ClusterContext {
+	return &ClusterContext{
 		create:            true,
 		clusterDesc:       cluster,
 		filters:           cFilter,
@@ -76,82 +115,177 @@ func NewClusterContext(mScaleIn, mScaleOut, cScaleIn, cScaleout, rmc bool, cFilt
 		mSeq:              sequence.Seq{},
 		cSeqs:             map[string]*sequence.Seq{},
 		serviceRegistries: map[string]*discovery.ServiceRegisterDriver{},
+		report:            NewDeployReport(),
+		placements:        newPlacements(),
+		cordons:           map[string]CordonInfo{},
 	}
-	clusterContext.initContext()
-	return clusterContext
-
 }
 
 // init the exists machine, container, and seq
-func (ctx *ClusterContext) initContext() {
+func (ctx *ClusterContext) initContext() error {
 	// log.Info("Parsing port binding in cluster description.")
 	// ctx.parsePortBindings()
 
 	log.Info("Init container description")
 	err := ctx.initContainerDescription()
 	if err != nil {
-		panic("Fail to init container description, err: " + err.Error())
+		return errors.New("Fail to init container description, err: " + err.Error())
 	}
 
 	supportedDrivers := strings.Join(ctx.clusterDesc.Machine.Cloud.SurportedDrivers(), ",")
 	log.Infof("Create a new machine proxy. cluster by:%s, supported drivers:%s, discovery: %s, master: %s\n", ctx.clusterDesc.ClusterBy, supportedDrivers, ctx.clusterDesc.Discovery, ctx.clusterDesc.Master)
-	machineProxy := dmachine.NewMachineClusterProxy("dockerf machine", ctx.clusterDesc.ClusterBy, ctx.clusterDesc.Discovery, ctx.clusterDesc.Master, ctx.clusterDesc.Machine.Cloud)
+	machineProxy, err := dmachine.NewMachineClusterProxy(ctx.clusterDesc.ClusterBy, ctx.clusterDesc.Discovery, ctx.clusterDesc.Master, ctx.clusterDesc.Machine.Cloud)
+	if err != nil {
+		return err
+	}
 	ctx.mProxy = machineProxy
 
 	log.Info("Loading the cluster machine info...")
 	mis, err := ctx.mProxy.List()
 	if err != nil {
-		panic("Init cluster context error, cannot list machine infos:" + err.Error())
+		return errors.New("Init cluster context error, cannot list machine infos:" + err.Error())
 	}
 	ctx.machineInfos = mis
 
-	log.Info("Init the consule cluster.")
-	if err := ctx.startConsulCluster(); err != nil {
-		panic("Start consul cluster failed: " + err.Error())
+	// the lock is kept in the consul servers, so it is taken before anything is changed if they are all running,
+	// or right after they are created or started otherwise.
+	managed := len(ctx.clusterDesc.ConsulCluster.Server.IPs) == 0
+	log.Info("Loading the consul server ips.")
+	if err := ctx.loadConsulServerIPs(); err != nil {
+		return fmt.Errorf("Load consul server ips failed: %s", err.Error())
+	}
+	if len(ctx.clusterDesc.ConsulCluster.Server.IPs) == 0 {
+		log.Info("Init the consule cluster.")
+		if err := ctx.startConsulCluster(); err != nil {
+			return errors.New("Start consul cluster failed: " + err.Error())
+		}
+	}
+	log.Info("Lock the cluster")
+	if err := ctx.acquireLock(); err != nil {
+		return err
+	}
+	// another deploy may have changed the master or the consul servers before the lock is acquired.
+	if err := ctx.reloadMachineInfos(); err != nil {
+		return errors.New("Init cluster context error, cannot list machine infos:" + err.Error())
+	}
+	mis = ctx.machineInfos
+	if managed {
+		if err := ctx.checkConsulServers(); err != nil {
+			return err
+		}
+	}
+	log.Info("Loading the cordoned machines.")
+	if err := ctx.loadCordons(); err != nil {
+		return fmt.Errorf("Failed to load the cordoned machines: %s", err.Error())
 	}
 
 	log.Info("Starting machine master")
 	if err := ctx.startMaster(); err != nil {
-		panic("Start cluster master failed: " + err.Error())
-	}
-
-	tlsConfig, err := machineProxy.Config()
-	if err != nil {
-		panic(fmt.Sprintf("Failed to load master machine node tls config. err:%s\n", err.Error()))
+		return errors.New("Start cluster master failed: " + err.Error())
 	}
 
-	containerProxy, err := dcontainer.NewDockerProxy(tlsConfig)
-	if err != nil {
-		panic("Failed to create docker proxy:%s\n" + err.Error())
+	if err := ctx.initContainerProxy(); err != nil {
+		return err
 	}
-	ctx.cProxy = containerProxy
-
-	ctx.containerFilterChain = dcontainerfilter.NewFilterChain(ctx.cProxy)
 
 	log.Info("Init the named machine sequence...")
 	ctx.initMachineSequence(mis)
 
 	log.Info("Loading all filtered container infos... ")
 	if err := ctx.loadContainers(); err != nil {
-		panic("Init cluster context error, cannot list container infos:" + err.Error())
+		return errors.New("Init cluster context error, cannot list container infos:" + err.Error())
 	}
 
 	log.Info("Init container sequences.")
 	if err := ctx.initContainerSequences(); err != nil {
-		panic("Init cluster context error, cannot init container seqs:" + err.Error())
+		return errors.New("Init cluster context error, cannot init container seqs:" + err.Error())
 	}
 
 	log.Infof("ensure machine compacity.")
 	if err := ctx.ensureMachineCapacity(); err != nil {
-		panic("Ensure machine capacity error:%s" + err.Error())
+		return errors.New("Ensure machine capacity error:" + err.Error())
 	}
 
 	log.Info("Init service discovery.")
 	if err := ctx.initServiceDiscovery(); err != nil {
-		panic("Init service discovery failed:" + err.Error())
+		return errors.New("Init service discovery failed:" + err.Error())
 	}
 
 	log.Info("cluster context inited successfully")
+	return nil
+}
+
+// load the exists machine, container, and seq without changing the cluster
+func (ctx *ClusterContext) loadContext() error {
+	return ctx.loadContextWithLock(false)
+}
+
+// load the context like loadContext, and lock the cluster before anything is loaded from the consul kv.
+func (ctx *ClusterContext) lockContext() error {
+	return ctx.loadContextWithLock(true)
+}
+
+func (ctx *ClusterContext) loadContextWithLock(lock bool) error {
+	log.Info("Init container description")
+	if err := ctx.initContainerDescription(); err != nil {
+		return fmt.Errorf("Fail to init container description, err: %s", err.Error())
+	}
+
+	machineProxy, err := dmachine.NewMachineClusterProxy(ctx.clusterDesc.ClusterBy, ctx.clusterDesc.Discovery, ctx.clusterDesc.Master, ctx.clusterDesc.Machine.Cloud)
+	if err != nil {
+		return err
+	}
+	ctx.mProxy = machineProxy
+
+	log.Info("Loading the cluster machine info...")
+	mis, err := ctx.mProxy.List()
+	if err != nil {
+		return fmt.Errorf("Load cluster context error, cannot list machine infos: %s", err.Error())
+	}
+	ctx.machineInfos = mis
+
+	log.Info("Init the named machine sequence...")
+	ctx.initMachineSequence(mis)
+
+	log.Info("Loading the consul server ips.")
+	if err := ctx.loadConsulServerIPs(); err != nil {
+		return fmt.Errorf("Load consul server ips failed: %s", err.Error())
+	}
+	if lock {
+		if len(ctx.clusterDesc.ConsulCluster.Server.IPs) == 0 {
+			return fmt.Errorf("The consul servers %v of the cluster are not all running, run 'dockerf cluster deploy' to start them.", ctx.clusterDesc.ConsulCluster.Server.Nodes)
+		}
+		log.Info("Lock the cluster")
+		if err := ctx.acquireLock(); err != nil {
+			return err
+		}
+		if err := ctx.loadCordons(); err != nil {
+			return fmt.Errorf("Failed to load the cordoned machines: %s", err.Error())
+		}
+	} else if err := ctx.loadCordons(); err != nil {
+		log.Warnf("Failed to load the cordoned machines, which are treated as schedulable. err:%s", err.Error())
+	}
+
+	if master, exists := ctx.getMaster(); !exists || !master.IsRunning() {
+		log.Warnf("Master '%s' is not running, no container can be loaded.", ctx.clusterDesc.Master)
+		return nil
+	}
+
+	if err := ctx.initContainerProxy(); err != nil {
+		return err
+	}
+
+	log.Info("Loading all filtered container infos... ")
+	if err := ctx.loadContainers(); err != nil {
+		return fmt.Errorf("Load cluster context error, cannot list container infos: %s", err.Error())
+	}
+
+	log.Info("Init container sequences.")
+	if err := ctx.initContainerSequences(); err != nil {
+		return fmt.Errorf("Load cluster context error, cannot init container seqs: %s", err.Error())
+	}
+	log.Info("cluster context loaded successfully")
+	return nil
 }
 
 // func (ctx *ClusterContext) parsePortBindings() error {
@@ -167,6 +301,21 @@ func (ctx *ClusterContext) initContext() {
 // 	return nil
 // }
 
+// create the docker proxy to the master, which must be running.
+func (ctx *ClusterContext) initContainerProxy() error {
+	config, err := ctx.mProxy.Config()
+	if err != nil {
+		return fmt.Errorf("Failed to load master machine node tls config. err:%s", err.Error())
+	}
+	containerProxy, err := dcontainer.NewDockerProxy(config)
+	if err != nil {
+		return fmt.Errorf("Failed to create docker proxy: %s", err.Error())
+	}
+	ctx.cProxy = containerProxy
+	ctx.containerFilterChain = dcontainerfilter.NewFilterChain(ctx.cProxy)
+	return nil
+}
+
 func (ctx *ClusterContext) loadContainers() error {
 	var (
 		infos []dcontainer.ContainerInfo
@@ -177,7 +326,7 @@ func (ctx *ClusterContext) loadContainers() error {
 	} else {
 		infos, err = ctx.containerFilterChain.Filter(ctx.filters)
 	}
-	fmt.Printf("Load containers: %v, filters: %v \n", infos, ctx.filters)
+	log.Debugf("Load containers: %v, filters: %v", infos, ctx.filters)
 	// infos, err := ctx.cProxy.ListAll()
 	if err == nil {
 		ctx.containerInfos = infos
@@ -186,6 +335,9 @@ func (ctx *ClusterContext) loadContainers() error {
 }
 
 func (ctx *ClusterContext) loadAllContainers() ([]dcontainer.ContainerInfo, error) {
+	if ctx.cProxy == nil {
+		return nil, fmt.Errorf("Master '%s' is not running, no container can be loaded.", ctx.clusterDesc.Master)
+	}
 	return ctx.cProxy.ListAll()
 }
 
@@ -212,11 +364,21 @@ func (ctx *ClusterContext) getContainerByNode(node string) []dcontainer.Containe
 func (ctx *ClusterContext) initServiceDiscovery() error {
 	descriptions := ctx.getSortedSDDescriptionByType()
 	log.Debugf("deploying all service discovery related container. len:%d", len(descriptions))
+	ec := &errorCollector{}
 	for _, description := range descriptions {
 		log.Debugf("deploy service discovery container. group:%s", description.Group)
-		ctx.deployContainersByDescription(&description)
+		if err := ctx.deployContainersByDescription(&description); err != nil {
+			ec.add(fmt.Errorf("Failed to deploy service discovery group '%s'. err:%s", description.Group, err.Error()))
+		}
 	}
+	if err := ec.err(); err != nil {
+		return err
+	}
+	return ctx.loadServiceRegistries()
+}
 
+// create the service register drivers, and registry them with the running service discovery containers.
+func (ctx *ClusterContext) loadServiceRegistries() error {
 	log.Debugf("loading all container infos.")
 	cinfos, err := ctx.loadAllContainers()
 	if err != nil {
@@ -251,58 +413,75 @@ func (ctx *ClusterContext) initServiceDiscovery() error {
 		containerGroup, ok := sdd["container"]
 		log.Debugf("Load registry for '%s'\n", containerGroup)
 		if ok {
-			fmt.Printf("Load registry for service discover. sd name: '%s', group: '%s'.\n", sdName, containerGroup)
+			dlog.Printf("Load registry for service discover. sd name: '%s', group: '%s'.\n", sdName, containerGroup)
 			description, exists := ctx.clusterDesc.Container.Topology.GetDescription(containerGroup)
 			if !exists {
-				panic(fmt.Sprintf("No container description found for group '%s'", containerGroup))
+				return fmt.Errorf("No container description found for group '%s'", containerGroup)
 			}
 			ipPorts := loadRegistry(containerGroup, description, cinfos)
 			if len(ipPorts) == 0 {
-				fmt.Printf("No available container for service discovery:%s, container group:%s\n", sdName, containerGroup)
+				dlog.Printf("No available container for service discovery:%s, container group:%s\n", sdName, containerGroup)
 			} else {
-				fmt.Printf("Service discover registry found: %+v\n", ipPorts)
+				dlog.Printf("Service discover registry found: %+v\n", ipPorts)
 				(*driver).Registry(ipPorts)
 			}
 		}
-		fmt.Printf("Service discover registered name:%s. \n", sdName)
+		dlog.Printf("Service discover registered name:%s. \n", sdName)
 		ctx.serviceRegistries[sdName] = driver
 	}
 	return nil
 }
 
-func (ctx *ClusterContext) registerServiceByContainer(c *dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) error {
-	sd := cd.ServiceDiscover
-	if sd == "" {
-		fmt.Printf("Service discover missed, no need to register %s\n", c.Name[0])
+func (ctx *ClusterContext) ensureServiceRegistries() error {
+	if len(ctx.serviceRegistries) > 0 || len(ctx.clusterDesc.ServiceDiscover) == 0 {
 		return nil
 	}
+	return ctx.loadServiceRegistries()
+}
 
-	host, port, find := func(c *dcontainer.ContainerInfo) (string, int, bool) {
-		for _, ipPort := range c.IpPorts {
-			if ipPort.PrivatePort == cd.PortBinding.ContainerPort {
-				return ipPort.IP, ipPort.PublicPort, true
-			}
+// the ip and the public port the container port is exposed on.
+func getPublicPort(c *dcontainer.ContainerInfo, containerPort int) (string, int, bool) {
+	for _, ipPort := range c.IpPorts {
+		if ipPort.PrivatePort == containerPort {
+			return ipPort.IP, ipPort.PublicPort, true
 		}
-		return "", 0, false
-	}(c)
-
-	if !find {
-		return errors.New(fmt.Sprintf("Container is not expose any port as a service. (container name:%s, description:%s)", c.Name[0], cd.Group))
 	}
+	return "", 0, false
+}
 
-	driver, ok := ctx.serviceRegistries[cd.ServiceDiscover]
-	if !ok {
-		return errors.New(fmt.Sprintf("No service register driver available for:'%s'\n", cd.ServiceDiscover))
+// register the ports of the container with the service discovers they choose.
+func (ctx *ClusterContext) registerServiceByContainer(c *dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) error {
+	registered := false
+	for _, binding := range cd.PortBindings {
+		sd := binding.ServiceDiscover
+		if sd == "" {
+			continue
+		}
+		host, port, find := getPublicPort(c, binding.ContainerPort)
+		if !find {
+			return errors.New(fmt.Sprintf("Container does not expose port %d as a service. (container name:%s, description:%s)", binding.ContainerPort, c.Name[0], cd.Group))
+		}
+
+		driver, ok := ctx.serviceRegistries[sd]
+		if !ok {
+			return errors.New(fmt.Sprintf("No service register driver available for:'%s'\n", sd))
+		}
+		err := (*driver).Register(host, port)
+		ctx.report.addRegistration(newRegistrationEvent(REPORT_REGISTER, cd, sd, c.Name[0], host, port, err))
+		if err != nil {
+			return err
+		}
+		registered = true
+		log.Infof("Container service successfully registered. cid:%s, name:%s, sd:%s, host:%s, port:%d\n", c.ID, c.Name[0], sd, host, port)
 	}
-	if err := (*driver).Register(host, port); err != nil {
-		return err
+	if !registered {
+		dlog.Printf("Service discover missed, no need to register %s\n", c.Name[0])
 	}
-	log.Infof("Container service successfully registered. cid:%s, name:%s, host:%s, ip:%d\n", c.ID, c.Name[0], host, port)
 	return nil
 }
 
 func (ctx *ClusterContext) registerServiceByContainerId(cid string, cd *dcluster.ContainerDescription) error {
-	if cd.ServiceDiscover == "" {
+	if len(cd.GetServiceDiscovers()) == 0 {
 		log.Warnf("Service discover missed, there is not need to register. cid:%s", cid)
 		return nil
 	}
@@ -310,28 +489,29 @@ func (ctx *ClusterContext) registerServiceByContainerId(cid string, cd *dcluster
 
 	c, exists := ctx.cProxy.GetContainerByID(cid)
 	if !exists {
-		return errors.New(fmt.Sprintf("Container(cid:%s, name:%s) is not exists", cid))
+		return errors.New(fmt.Sprintf("Container(cid:%s) is not exists", cid))
 	}
 	return ctx.registerServiceByContainer(&c, cd)
 }
 
-func (ctx *ClusterContext) unregisterService(ip string, port int, cd *dcluster.ContainerDescription) error {
-	sd := cd.ServiceDiscover
-	if sd == "" {
-		fmt.Printf("Service discover missed, no need to unregister %s:%d\n", ip, port)
-		return nil
-	}
-	fmt.Printf("Ungregister service ip:%s, port:%d\n", ip, port)
+func (ctx *ClusterContext) unregisterService(ip string, port int, sd string, cd *dcluster.ContainerDescription) error {
+	dlog.Printf("Ungregister service sd:%s, ip:%s, port:%d\n", sd, ip, port)
 	driver, ok := ctx.serviceRegistries[sd]
 	if !ok {
 		return errors.New(fmt.Sprintf("No service register driver available for:'%s'\n", sd))
 	}
-	return (*driver).UnRegister(ip, port)
-	fmt.Printf("Ungregistered service ip:%s, port:%d\n", ip, port)
+	err := (*driver).UnRegister(ip, port)
+	ctx.report.addRegistration(newRegistrationEvent(REPORT_UNREGISTER, cd, sd, "", ip, port, err))
+	if err != nil {
+		return err
+	}
+	dlog.Printf("Ungregistered service sd:%s, ip:%s, port:%d\n", sd, ip, port)
 	return nil
 }
 
+// the machines are listed again, as they may be changed by the others.
 func (ctx *ClusterContext) reloadMachineInfos() error {
+	ctx.mProxy.Refresh()
 	mis, err := ctx.mProxy.List()
 	if err == nil {
 		ctx.machineInfos = mis
@@ -362,10 +542,10 @@ func (ctx *ClusterContext) initContainerSequences() error {
 				ctx.cSeqs[group] = seq
 			}
 		} else {
-			fmt.Printf("'%s' is not a valid container name.\n", cName)
+			dlog.Printf("'%s' is not a valid container name.\n", cName)
 		}
 	}
-	fmt.Printf("Named Container info sequences inited:%+v\n", ctx.cSeqs)
+	dlog.Printf("Named Container info sequences inited:%+v\n", ctx.cSeqs)
 	return nil
 }
 
@@ -377,15 +557,14 @@ func (ctx *ClusterContext) initMachineSequence(mifs []dmachine.MachineInfo) {
 		if mi.Seq >= 0 {
 			ctx.mSeq.Max(mi.Seq)
 		} else {
-			fmt.Printf("'%s' is not a valid machine name.\n", mi.Name)
+			dlog.Printf("'%s' is not a valid machine name.\n", mi.Name)
 		}
 	}
-	fmt.Printf("Named Machine info sequences inited:%d\n", ctx.mSeq.Get())
+	dlog.Printf("Named Machine info sequences inited:%d\n", ctx.mSeq.Get())
 }
 
 func (ctx *ClusterContext) getMaster() (dmachine.MachineInfo, bool) {
 	for _, mi := range ctx.machineInfos {
-		fmt.Printf("ctx.clusterDesc.Master: %s, mi name: %s \n", ctx.clusterDesc.Master, mi.Name)
 		if mi.IsMaster() && mi.Name == ctx.clusterDesc.Master {
 			return mi, true
 		}
@@ -393,12 +572,14 @@ func (ctx *ClusterContext) getMaster() (dmachine.MachineInfo, bool) {
 	return dmachine.MachineInfo{}, false
 }
 
+// Deploy deploys all the biz groups, going on with the others if a group failed.
+// What succeeded, failed and skipped is recorded in the report.
 func (ctx *ClusterContext) Deploy() error {
 	if err := ctx.deployContainers(); err != nil {
-		fmt.Printf("Deploy container error:%s\n", err.Error())
-		os.Exit(1)
+		dlog.Printf("Deploy container error:%s\n", err.Error())
+		return err
 	}
-	fmt.Printf("Deploy successfully.\n")
+	dlog.Printf("Deploy successfully.\n")
 	return nil
 }
 
@@ -520,15 +701,18 @@ func (ctx *ClusterContext) runConsulBootstrapServer(serverNode string, serverIP
 }
 
 func (ctx *ClusterContext) createPlainDockerProxy(node string) (*dcontainer.DockerProxy, error) {
-	tlsConfig, err := ctx.mProxy.ConfigNode(node)
+	config, err := ctx.mProxy.ConfigNode(node)
 	if err != nil {
 		return nil, err
 	}
-	return dcontainer.NewDockerProxy(tlsConfig)
+	return dcontainer.NewDockerProxy(config)
 }
 
 func (ctx *ClusterContext) runConsulAgent(dockerProxy *dcontainer.DockerProxy, agent dcluster.ConsulAgent, agentNode string, agentIp string) (string, error) {
 	name := fmt.Sprintf("%s-consul-agent", agentNode)
+	if len(ctx.clusterDesc.ConsulCluster.Server.IPs) == 0 {
+		return "", fmt.Errorf("No consul server is running for the agent on '%s' to join.", agentNode)
+	}
 	serverIp := ctx.clusterDesc.ConsulCluster.Server.IPs[0]
 	envs := []string{
 		"SERVICE_NAME=consul-agent",
@@ -565,42 +749,41 @@ func (ctx *ClusterContext) runConsulRegistrator(dockerProxy *dcontainer.DockerPr
 }
 
 func (ctx *ClusterContext) initSlave(node string, md dcluster.MachineDescription) error {
-	fmt.Printf("Init the machine infrastructure envment: '%s'\n", node)
+	dlog.Printf("Init the machine infrastructure envment: '%s'\n", node)
 	// exec command on this machine
 	command := strings.TrimSpace(md.Init)
 	if command != "" {
 		if err := ctx.mProxy.ExecCmd(node, command); err != nil {
-			fmt.Printf("Failed to exec command(%s) on '%s'\n", command, node)
+			dlog.Printf("Failed to exec command(%s) on '%s'\n", command, node)
 		}
 	}
 
 	if md.Consul {
 		proxy, err := ctx.createPlainDockerProxy(node)
 		if err != nil {
-			panic(fmt.Sprintf("Failed to new docker proxy formachine:%s\n", node))
-
+			return fmt.Errorf("Failed to new docker proxy formachine:%s. err:%s", node, err.Error())
 		}
 		ip, err := ctx.mProxy.IP(node)
 		if err != nil {
-			fmt.Printf("Failed to load agent ip:'%s', error:%s\n", node, err.Error())
+			dlog.Printf("Failed to load agent ip:'%s', error:%s\n", node, err.Error())
 			return err
 		}
-		fmt.Printf("Run consul agent on '%s(%s)'\n", node, ip)
+		dlog.Printf("Run consul agent on '%s(%s)'\n", node, ip)
 		if cid, err := ctx.runConsulAgent(proxy, ctx.clusterDesc.ConsulCluster.Agent, node, ip); err != nil {
-			panic(fmt.Sprintf("Run consul agent on '%s' failed. err:%s\n", node, err.Error()))
+			return fmt.Errorf("Run consul agent on '%s' failed. err:%s", node, err.Error())
 		} else {
-			fmt.Printf("Consul agent running successfully. id:%s\n", cid)
+			dlog.Printf("Consul agent running successfully. id:%s\n", cid)
 		}
 
-		fmt.Printf("Run consul registrator on '%s(%s)'\n", node, ip)
+		dlog.Printf("Run consul registrator on '%s(%s)'\n", node, ip)
 		if cid, err := ctx.runConsulRegistrator(proxy, ctx.clusterDesc.ConsulCluster.Registrator, node, ip); err != nil {
-			panic(fmt.Sprintf("Failed to run consul registor container on '%s'. err:%s", node, err.Error()))
+			return fmt.Errorf("Failed to run consul registor container on '%s'. err:%s", node, err.Error())
 		} else {
-			fmt.Printf("Consul registrator running successfully. id:%s\n", cid)
+			dlog.Printf("Consul registrator running successfully. id:%s\n", cid)
 		}
 	}
 
-	fmt.Sprintf("Slave machine init successfully. node:%s\n", node)
+	dlog.Printf("Slave machine init successfully. node:%s\n", node)
 	return nil
 }
 
@@ -613,16 +796,23 @@ func (ctx *ClusterContext) createSlaves(md dcluster.MachineDescription, num int)
 	for i := 0; i < num; i++ {
 		go func(ctx *ClusterContext) {
 			defer wg.Done()
-			name, err := ctx.mProxy.CreateSlave(md)
+			var name string
+			err := protect(func() error {
+				var err error
+				name, err = ctx.mProxy.CreateSlave(md)
+				return err
+			})
 			if err != nil {
-				fmt.Printf("Failed to Create machine of group '%s'. Error:%s\n", md.Group, err.Error())
+				dlog.Printf("Failed to Create machine of group '%s'. Error:%s\n", md.Group, err.Error())
+				lock.Lock()
 				errs = append(errs, err.Error())
+				lock.Unlock()
 			} else {
-				fmt.Printf("Machine(%s) created and started, begin to init slave.\n", name)
-				if err := ctx.initSlave(name, md); err != nil {
-					fmt.Printf("Failed to init slave '%s'\n", name)
+				dlog.Printf("Machine(%s) created and started, begin to init slave.\n", name)
+				if err := protect(func() error { return ctx.initSlave(name, md) }); err != nil {
+					dlog.Printf("Failed to init slave '%s'. err:%s\n", name, err.Error())
 				} else {
-					fmt.Printf("Machine(%s) inited complete.\n", name)
+					dlog.Printf("Machine(%s) inited complete.\n", name)
 					lock.Lock()
 					successNodeNames = append(successNodeNames, name)
 					lock.Unlock()
@@ -642,52 +832,63 @@ func (ctx *ClusterContext) scaleMachineInByGroup(md dcluster.MachineDescription)
 	group := md.Group
 	machines, err := ctx.mProxy.ListByGroup(group)
 	if err != nil {
-		fmt.Printf("Scale machine in failed when loading machine for group:%s\n", err.Error())
+		dlog.Printf("Scale machine in failed when loading machine for group:%s\n", err.Error())
 		return err
 	}
 
+	// the cordoned machines are not counted toward the minimal num in scale-out, so neither toward the maximal one.
 	runningMachines := []dmachine.MachineInfo{}
 	for _, m := range machines {
-		if m.IsRunning() {
+		if m.IsRunning() && !ctx.isCordoned(m.Name) {
 			runningMachines = append(runningMachines, m)
 		}
 	}
 	rNum := len(runningMachines)
 	max := md.MaxNum
 	if rNum <= max {
-		fmt.Printf("No extra machines in the cluster. Exists: %d. Maximal requirements: %d\n", rNum, max)
+		dlog.Printf("No extra machines in the cluster. Exists: %d. Maximal requirements: %d\n", rNum, max)
 		return nil
 	}
 	destroyNum := rNum - max
-	fmt.Printf("There are %d machines in the cluster, but maximal required num is %d. %d extra will be destroyed.\n", rNum, max, destroyNum)
-
-	for idx := 0; idx < destroyNum; idx++ {
-		mi := runningMachines[idx]
-		fmt.Printf("Destroying machine '%s'\n", mi.Name)
-		fmt.Printf("Stopping and unregistering all container service on machine '%s'\n", mi.Name)
-		containers := ctx.getContainerByNode(mi.Name)
-		fmt.Printf("There are %d container on machine '%s'\n", len(containers), mi.Name)
-		for _, c := range containers {
-			if !c.IsUp() {
-				continue
-			}
-			var description *dcluster.ContainerDescription = nil
-			group := c.Group
-			if cd, ok := ctx.clusterDesc.Container.Topology.GetDescription(group); ok {
-				description = cd
-			}
-			fmt.Printf("Stopping container. name:%s, cid:%s\n", c.Name[0], c.ID)
-			ctx.stopContainer(&c, description)
+	dlog.Printf("There are %d machines in the cluster, but maximal required num is %d. %d extra will be destroyed.\n", rNum, max, destroyNum)
+
+	containers, err := ctx.getRunningContainersByMachine()
+	if err != nil {
+		return fmt.Errorf("Scale machine in failed when loading containers for group '%s': %s", group, err.Error())
+	}
+	// no container is moved to the machines destroyed, so all of them are excluded before any is drained.
+	destroyed := chooseMachinesToDrain(runningMachines, containers, destroyNum)
+	for _, mi := range destroyed {
+		ctx.placements.exclude(mi.Name)
+	}
+	// the replacements are registered before the containers are stopped.
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+
+	ec := &errorCollector{}
+	for _, mi := range destroyed {
+		if err := ctx.checkLock(); err != nil {
+			ec.add(err)
+			break
+		}
+		dlog.Printf("Destroying machine '%s'\n", mi.Name)
+		if err := ctx.drainMachine(mi.Name, containers[mi.Name], false); err != nil {
+			// the services on the machine may be still registered.
+			ec.add(fmt.Errorf("Machine '%s' is not destroyed, as some containers on it can not be moved off securely.%s%s", mi.Name, ERROR_SEPARATOR, err.Error()))
+			continue
+		}
+		dlog.Printf("All running container moved off, the machine '%s' will be destroy gracefully.\n", mi.Name)
+		if err := ctx.mProxy.Destroy(mi.Name); err != nil {
+			ec.add(fmt.Errorf("Failed to destroy machine '%s': %s", mi.Name, err.Error()))
 		}
-		fmt.Printf("All running container stopped, the machine '%s' will be destroy gracefully.\n", mi.Name)
-		ctx.mProxy.Destroy(mi.Name)
 	}
-	return nil
+	return ec.err()
 }
 
 func (ctx *ClusterContext) scaleMachineIn() error {
 	if !ctx.mScaleIn {
-		fmt.Printf("No need to scale in.\n")
+		dlog.Printf("No need to scale in.\n")
 		return nil
 	}
 	for _, md := range ctx.clusterDesc.Machine.Topology {
@@ -698,6 +899,83 @@ func (ctx *ClusterContext) scaleMachineIn() error {
 	return nil
 }
 
+// ResizeMachineGroup starts or creates machines of the group, or destroys the extra ones,
+// until num machines are running. num must be between the MinNum and MaxNum of the group unless forced.
+func (ctx *ClusterContext) ResizeMachineGroup(group string, num int, force bool) error {
+	md, exists := ctx.clusterDesc.Machine.Topology.GetDescription(group)
+	if !exists {
+		return fmt.Errorf("No machine description found for group '%s'", group)
+	}
+	if num < 0 {
+		return fmt.Errorf("'%d' is not a valid machine num.", num)
+	}
+	if !force && (num < md.MinNum || num > md.MaxNum) {
+		return fmt.Errorf("The machine num of group '%s' must be between %d and %d, but %d provided. Use '--force' to resize it anyway.", group, md.MinNum, md.MaxNum, num)
+	}
+	if ctx.cProxy == nil {
+		return fmt.Errorf("Master '%s' is not running, no container can be moved off the machines", ctx.clusterDesc.Master)
+	}
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+
+	machines, err := ctx.mProxy.ListByGroup(group)
+	if err != nil {
+		return err
+	}
+	// the cordoned machines are counted neither in the scale-out nor in the scale-in.
+	running := 0
+	for i := range machines {
+		if machines[i].IsRunning() && !ctx.isCordoned(machines[i].Name) {
+			running++
+		}
+	}
+	dlog.Printf("Resize machine group '%s' from %d to %d.\n", group, running, num)
+
+	// the bounds of the description decide how many machines are started, created or destroyed.
+	resized := *md
+	resized.MinNum = num
+	resized.MaxNum = num
+	if running < num {
+		runningNum, restarted, err := ctx.startMachines(machines, resized)
+		if err != nil {
+			dlog.Printf("Error happend when Start machines for group:%s. err:%s\n", group, err.Error())
+		}
+		created := []string{}
+		if runningNum < num {
+			created, err = ctx.createSlaves(resized, num-runningNum)
+			runningNum += len(created)
+		}
+		dlog.Printf("%d machines running, of which %d restarted and %d created. group: %s.\n", runningNum, restarted, len(created), group)
+		if runningNum < num {
+			return fmt.Errorf("Resize machine group '%s' failed, %d running but %d required. err:%v", group, runningNum, num, err)
+		}
+	} else if running > num {
+		if err := ctx.scaleMachineInByGroup(resized); err != nil {
+			return err
+		}
+	} else {
+		dlog.Printf("There are %d machines running in group '%s' already.\n", running, group)
+	}
+	return ctx.reloadMachineInfos()
+}
+
+// ResizeMachines scales every machine group in or out, into the MinNum and MaxNum of the group.
+func (ctx *ClusterContext) ResizeMachines() error {
+	if ctx.cProxy == nil {
+		return fmt.Errorf("Master '%s' is not running, no container can be moved off the machines", ctx.clusterDesc.Master)
+	}
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+	ctx.mScaleIn = true
+	ctx.mScaleOut = true
+	if err := ctx.ensureMachineCapacity(); err != nil {
+		return err
+	}
+	return ctx.reloadMachineInfos()
+}
+
 func (ctx *ClusterContext) ensureMachineCapacity() error {
 	if err := ctx.scaleMachineOut(); err != nil {
 		return err
@@ -730,11 +1008,16 @@ func (ctx *ClusterContext) nextContainerName(group string) string {
 	return cn.GetName()
 }
 
-func (ctx *ClusterContext) runContainer(cd *dcluster.ContainerDescription, grp string) {
+// run a new container and its poststart hook, and register it once it passes the health check.
+// The unhealthy container is left running but unregistered, and a HealthCheckError returned.
+func (ctx *ClusterContext) runContainer(cd *dcluster.ContainerDescription, grp string) error {
 	group := cd.Group
 	if group == "" {
 		group = grp
 	}
+	if len(ctx.clusterDesc.ConsulCluster.Server.IPs) == 0 {
+		return fmt.Errorf("No consul server is running, container of group '%s' can not be run.", group)
+	}
 	name := ctx.nextContainerName(group)
 	log.Infof("Run a new container. name:%s, image:%s, group:%s.\n", name, cd.Image, group)
 	envs := []string{"constraint:role==slave", "constraint:group==" + cd.Machine}
@@ -751,24 +1034,77 @@ func (ctx *ClusterContext) runContainer(cd *dcluster.ContainerDescription, grp s
 			envs = append(envs, "SERVICE_NAME="+url)
 		}
 	}
+	memory, err := cd.GetMemInBytes()
+	if err != nil {
+		return fmt.Errorf("Invalid memory of group '%s': %s", group, err.Error())
+	}
+	memorySwap, err := cd.GetMemorySwapInBytes()
+	if err != nil {
+		return fmt.Errorf("Invalid memory-swap of group '%s': %s", group, err.Error())
+	}
+	ulimits, err := cd.GetUlimits()
+	if err != nil {
+		return fmt.Errorf("Invalid ulimits of group '%s': %s", group, err.Error())
+	}
+	restartPolicy, maxTry, err := cd.GetRestartPolicy()
+	if err != nil {
+		return fmt.Errorf("Invalid restart-policy of group '%s': %s", group, err.Error())
+	}
+	node, err := ctx.placeContainer(cd, group)
+	if err != nil {
+		return err
+	}
+	if node != "" {
+		envs = append(envs, "constraint:node=="+node)
+	}
+	for _, excluded := range ctx.placements.excludedMachines() {
+		envs = append(envs, "constraint:node!="+excluded)
+	}
 	runConfig := dcontainer.ContainerRunConfig{
 		Image:        cd.Image,
 		Name:         name,
-		PortBindings: []dcluster.PortBinding{cd.PortBinding},
+		PortBindings: cd.PortBindings,
 		Envs:         envs,
+		Cmds:         cd.Command,
+		Entrypoint:   cd.Entrypoint,
+		Hostname:     cd.Hostname,
+		Labels:       cd.Labels,
+		User:         cd.User,
+		WorkingDir:   cd.WorkDir,
 		DNS:          ctx.clusterDesc.ConsulCluster.Server.IPs,
 		Bindings:     cd.Volums,
+		Memory:       memory,
+		MemorySwap:   memorySwap,
+		CpuShares:    int64(cd.CpuShares),
+		CpusetCpus:   cd.Cpuset,
+		Privileged:   cd.Privileged,
+		CapAdd:       cd.CapAdd,
+		CapDrop:      cd.CapDrop,
+		Ulimits:      ulimits,
+		ExtraHosts:   cd.ExtraHosts,
+		RestartPolicy: dcontainer.RestartPolicy{
+			Name:   restartPolicy,
+			MaxTry: maxTry,
+		},
 	}
 
 	cid, err := ctx.cProxy.RunByConfig(runConfig)
 
 	if err != nil {
-		panic(fmt.Sprintf("Failed to run a container. name: %s, error: %s", name, err.Error()))
+		ctx.placements.add(group, node, -1)
+		return fmt.Errorf("Failed to run a container. name: %s, error: %s", name, err.Error())
 	}
-	err = ctx.registerServiceByContainerId(cid, cd)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to register service of container. id:%s, description:%+v err:%s", cid, *cd, err.Error()))
+	ctx.report.addStarted(ContainerEvent{Group: group, ID: cid, Name: name, Image: cd.Image})
+	if err := ctx.runPostStartHook(cid, cd); err != nil {
+		return err
+	}
+	if err := ctx.checkHealth(cid, cd); err != nil {
+		return err
+	}
+	if err := ctx.registerServiceByContainerId(cid, cd); err != nil {
+		return fmt.Errorf("Container runs, but failed to register its service. name:%s, id:%s, err:%s", name, cid, err.Error())
 	}
+	return nil
 }
 
 func (ctx *ClusterContext) removeStoppedContainerByGroup(group string) error {
@@ -777,67 +1113,108 @@ func (ctx *ClusterContext) removeStoppedContainerByGroup(group string) error {
 		return nil
 	}
 	containers := ctx.getContainerByGroup(group)
+	ec := &errorCollector{}
 	var wg sync.WaitGroup
 	for _, c := range containers {
 		if c.IsUp() {
 			continue
 		}
 		wg.Add(1)
-		fmt.Printf("Remove an container: container id: %s name:%s\n", c.ID, c.Name[0])
+		dlog.Printf("Remove an container: container id: %s name:%s\n", c.ID, c.Name[0])
 
 		go func(c dcontainer.ContainerInfo) {
 			defer wg.Done()
-			if err := ctx.cProxy.RemoveContainer(c.ID); err != nil {
-				fmt.Printf("Failed to remove an container. cid:%s, name:%s, Error:%s\n", c.ID, c.Name[0], err.Error())
+			err := protect(func() error {
+				return ctx.cProxy.RemoveContainer(c.ID)
+			})
+			if err != nil {
+				dlog.Printf("Failed to remove an container. cid:%s, name:%s, Error:%s\n", c.ID, c.Name[0], err.Error())
+				ctx.report.addFailure(group, c.Name[0], err)
+				ec.add(err)
 			} else {
-				fmt.Printf("Successfully to remove an container. cid:%s, name:%s. %s\n", c.ID, c.Name[0])
+				dlog.Printf("Successfully to remove an container. cid:%s, name:%s.\n", c.ID, c.Name[0])
+				ctx.report.addRemoved(newContainerEvent(&c))
 			}
 		}(c)
 	}
 	wg.Wait()
-	return nil
+	return ec.err()
 }
 
 func (ctx *ClusterContext) stopContainer(c *dcontainer.ContainerInfo, description *dcluster.ContainerDescription) error {
 	cid := c.ID
 	cName := c.Name[0]
-	if len(c.IpPorts) > 0 && description != nil {
-		ip := c.IpPorts[0].IP
-		port := c.IpPorts[0].PublicPort
-		fmt.Printf("Unregister service before stop a container. cid:%s, name: %s, ip:%s, port:%d\n", cid, cName, ip, port)
-		if err := ctx.unregisterService(ip, port, description); err != nil && err != io.EOF {
-			fmt.Println(fmt.Sprintf("Failed to unregister container service. cid:%s, name: %s, ip:%s, port:%d. Error:%s\n", cid, cName, ip, port, err.Error()))
+	if description != nil {
+		if err := ctx.runHook(HOOK_PRE_STOP, description.PreStop, c, description); err != nil {
 			return err
 		}
-		fmt.Printf("Container unregistered, begin to stop an container: container id: %s\n", cid)
-		if err := ctx.cProxy.StopContainer(cid); err != nil {
-			fmt.Println(fmt.Sprintf("Failed to stop container. CID:%s, name:%s, Error:%s", cid, cName, err.Error()))
-			return err
+	}
+	if description != nil {
+		for _, binding := range description.PortBindings {
+			if binding.ServiceDiscover == "" {
+				continue
+			}
+			ip, port, find := getPublicPort(c, binding.ContainerPort)
+			if !find {
+				continue
+			}
+			dlog.Printf("Unregister service before stop a container. cid:%s, name: %s, ip:%s, port:%d\n", cid, cName, ip, port)
+			if err := ctx.unregisterService(ip, port, binding.ServiceDiscover, description); err != nil && err != io.EOF {
+				dlog.Println(fmt.Sprintf("Failed to unregister container service. cid:%s, name: %s, ip:%s, port:%d. Error:%s\n", cid, cName, ip, port, err.Error()))
+				return err
+			}
 		}
-		fmt.Printf("Container unregistered, begin to stop an container: container id: %s\n", cid)
+		dlog.Printf("Container unregistered, begin to stop an container: container id: %s\n", cid)
 	}
 	if err := ctx.cProxy.StopContainer(cid); err != nil {
-		panic(fmt.Sprintf("Failed to stop container. CID:%s, name:%s, Error:%s", cid, cName, err.Error()))
+		return fmt.Errorf("Failed to stop container. CID:%s, name:%s, Error:%s", cid, cName, err.Error())
 	}
-	fmt.Printf("Container stopped securely and successfully. name:%s, container id: %s\n", cName, cid)
+	ctx.report.addStopped(newContainerEvent(c))
+	ctx.updatePlacement(c, -1)
+	dlog.Printf("Container stopped securely and successfully. name:%s, container id: %s\n", cName, cid)
 	return nil
 }
 
 func (ctx *ClusterContext) startContainer(container *dcontainer.ContainerInfo, description *dcluster.ContainerDescription) error {
-	fmt.Printf("Restarting container. cid:%s, image:%s, name:%s\n", container.ID, container.Image, container.Name[0])
+	dlog.Printf("Restarting container. cid:%s, image:%s, name:%s\n", container.ID, container.Image, container.Name[0])
 	if err := ctx.cProxy.RestartContainer(container.ID); err != nil {
-		fmt.Println(fmt.Sprintf("Failed to restart container.  cid:%s, image:%s, name:%s, err:%s\n", container.ID, container.Image, container.Name[0], err.Error()))
+		dlog.Println(fmt.Sprintf("Failed to restart container.  cid:%s, image:%s, name:%s, err:%s\n", container.ID, container.Image, container.Name[0], err.Error()))
 		return err
 	}
-	fmt.Printf("Container restarted, begin to register. cid:%s, image:%s, name:%s\n", container.ID, container.Image, container.Name[0])
-	if err := ctx.registerServiceByContainer(container, description); err != nil && err != io.EOF {
-		fmt.Println(fmt.Sprintf("Service Register failed. name:%s, error:%s\n", container.Name[0], err.Error()))
+	dlog.Printf("Container restarted, begin to register. cid:%s, image:%s, name:%s\n", container.ID, container.Image, container.Name[0])
+	ctx.report.addStarted(newContainerEvent(container))
+	ctx.updatePlacement(container, 1)
+	if err := ctx.runPostStartHook(container.ID, description); err != nil {
 		return err
 	}
-	fmt.Printf("Container successfully. cid:%s, image:%s, name:%s\n", container.ID, container.Image, container.Name[0])
+	if err := ctx.checkHealth(container.ID, description); err != nil {
+		return err
+	}
+	// the ports of a stopped container are not listed, so reload the container before registering.
+	if err := ctx.registerServiceByContainerId(container.ID, description); err != nil && err != io.EOF {
+		dlog.Println(fmt.Sprintf("Service Register failed. name:%s, error:%s\n", container.Name[0], err.Error()))
+		return err
+	}
+	dlog.Printf("Container successfully. cid:%s, image:%s, name:%s\n", container.ID, container.Image, container.Name[0])
 	return nil
 }
 
+// stop the container, and restart it if the image is not changed, or run a new one instead.
+// The container is not replaced if it can not be stopped securely.
+func (ctx *ClusterContext) replaceContainer(c *dcontainer.ContainerInfo, description *dcluster.ContainerDescription) error {
+	if err := ctx.stopContainer(c, description); err != nil {
+		return err
+	}
+	if c.Image == description.Image {
+		err := ctx.startContainer(c, description) // just restart
+		if err == nil || err == io.EOF || isHealthCheckError(err) || isHookError(err) {
+			return err
+		}
+		log.Debugf("Fail to start an existing container, error: %s, run a brand new container instead.. ", err.Error())
+	}
+	return ctx.runContainer(description, description.Group)
+}
+
 func (ctx *ClusterContext) deployRunningContainersByDescription(description *dcluster.ContainerDescription) error {
 	group := description.Group
 	runningContainers := func() []dcontainer.ContainerInfo {
@@ -851,7 +1228,6 @@ func (ctx *ClusterContext) deployRunningContainersByDescription(description *dcl
 		return running
 	}()
 	log.Debugf("The running num of group '%s' is %d", group, len(runningContainers))
-	var lock sync.Mutex
 	total := len(runningContainers)
 	if total <= 0 {
 		log.Debugf("No running container for group %s is available. ", group)
@@ -863,45 +1239,51 @@ func (ctx *ClusterContext) deployRunningContainersByDescription(description *dcl
 		sim = 1
 	}
 	log.Debugf("Simutaneous of group '%s' is %d, total: %d", group, sim, total)
-	blocking := make(chan int, sim)
-	done := make(chan bool, 1)
-	doneNum := 0
 
-	increaseDoneNum := func() {
-		lock.Lock()
-		defer lock.Unlock()
-		doneNum++
-		if doneNum >= total {
-			done <- true
-		}
-	}
-
-	for idx, c := range runningContainers {
+	replaced := []dcontainer.ContainerInfo{}
+	for _, c := range runningContainers {
 		if c.Image == description.Image && !description.Restart {
 			log.Debugf("The image of container group '%s' is not changed, and need not to be restart. so nothing to be done with the container. name:%s, id:%s", c.Group, c.Name[0], c.ID)
-			increaseDoneNum()
 			continue
 		}
-		blocking <- idx
-		go func(c dcontainer.ContainerInfo, ctx *ClusterContext) {
-			defer func() {
-				<-blocking
-				increaseDoneNum()
-			}()
-			ctx.stopContainer(&c, description)
-			if c.Image == description.Image {
-				err := ctx.startContainer(&c, description) // just restart
-				if err != nil && err != io.EOF {
-					log.Debugf("Fail to start an existing container, error: %s, run a brand new container instead.. ", err.Error())
-					ctx.runContainer(description, group)
-				}
-			} else {
-				ctx.runContainer(description, group)
-			}
+		replaced = append(replaced, c)
+	}
 
-		}(c, ctx)
+	// the containers are replaced batch by batch, and a batch starts after the previous one passed the health check.
+	ec := &errorCollector{}
+	maxFailures := description.HealthCheck.GetMaxFailures()
+	for start := 0; start < len(replaced); start += sim {
+		if err := ctx.checkLock(); err != nil {
+			ec.add(fmt.Errorf("Deploy of group '%s' stopped, %d of %d containers replaced. %s", group, start, len(replaced), err.Error()))
+			return ec.err()
+		}
+		end := start + sim
+		if end > len(replaced) {
+			end = len(replaced)
+		}
+		var wg sync.WaitGroup
+		for _, c := range replaced[start:end] {
+			wg.Add(1)
+			go func(c dcontainer.ContainerInfo, ctx *ClusterContext) {
+				defer wg.Done()
+				err := protect(func() error {
+					return ctx.replaceContainer(&c, description)
+				})
+				if err != nil {
+					log.Errorf("Failed to replace container. name:%s, err:%s", c.Name[0], err.Error())
+					ctx.report.addFailure(group, c.Name[0], err)
+					ec.add(err)
+				}
+			}(c, ctx)
+		}
+		wg.Wait()
+		if maxFailures > 0 && ec.len() >= maxFailures {
+			return fmt.Errorf("Deploy of group '%s' aborted, %d containers failed.%s%s", group, ec.len(), ERROR_SEPARATOR, ec.err().Error())
+		}
+	}
+	if err := ec.err(); err != nil {
+		return err
 	}
-	<-done
 	log.Debugf("Running container of group '%s' deployed successfully.", group)
 	return nil
 }
@@ -909,7 +1291,7 @@ func (ctx *ClusterContext) deployRunningContainersByDescription(description *dcl
 func (ctx *ClusterContext) scaleOutContainersByDescription(description *dcluster.ContainerDescription) error {
 	group := description.Group
 	if !ctx.cScaleOut {
-		fmt.Printf("scale out container flag is set to false(not set), no need to scale container out for group '%s'.\n", group)
+		dlog.Printf("scale out container flag is set to false(not set), no need to scale container out for group '%s'.\n", group)
 		return nil
 	}
 	containers := ctx.getContainerByGroup(group)
@@ -926,16 +1308,24 @@ func (ctx *ClusterContext) scaleOutContainersByDescription(description *dcluster
 	}
 	log.Debugf("%d container will be created and run of group '%s'.\n", createNum, group)
 
+	ec := &errorCollector{}
 	var wg sync.WaitGroup
 	for i := 0; i < createNum; i++ {
 		wg.Add(1)
 		go func(group string, cd *dcluster.ContainerDescription) {
 			defer wg.Done()
-			ctx.runContainer(cd, group)
+			err := protect(func() error {
+				return ctx.runContainer(cd, group)
+			})
+			if err != nil {
+				log.Errorf("%s", err.Error())
+				ctx.report.addFailure(group, "", err)
+				ec.add(err)
+			}
 		}(group, description)
 	}
 	wg.Wait()
-	return nil
+	return ec.err()
 }
 
 func (ctx *ClusterContext) scaleInContainersByDescription(description *dcluster.ContainerDescription) error {
@@ -953,11 +1343,12 @@ func (ctx *ClusterContext) scaleInContainersByDescription(description *dcluster.
 	}
 	needStopped := running - description.Num
 	if needStopped <= 0 {
-		fmt.Printf("No need to scale in container for group '%s'. running:%d, need:%d\n", group, running, description.Num)
+		dlog.Printf("No need to scale in container for group '%s'. running:%d, need:%d\n", group, running, description.Num)
 		return nil
 	}
 	log.Infof("%d container will be stopped of group '%s'.\n", needStopped, group)
 
+	ec := &errorCollector{}
 	var wg sync.WaitGroup
 	stopped := 0
 	for _, c := range containers {
@@ -971,29 +1362,61 @@ func (ctx *ClusterContext) scaleInContainersByDescription(description *dcluster.
 		wg.Add(1)
 		go func(container dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) {
 			defer wg.Done()
-			ctx.stopContainer(&container, description)
+			err := protect(func() error {
+				return ctx.stopContainer(&container, cd)
+			})
+			if err != nil {
+				log.Errorf("Failed to stop container. name:%s, err:%s", container.Name[0], err.Error())
+				ctx.report.addFailure(group, container.Name[0], err)
+				ec.add(err)
+			}
 		}(c, description)
 	}
 	wg.Wait()
-	return nil
+	return ec.err()
 }
 
+// deploy the group, and record its result in the report.
 func (ctx *ClusterContext) deployContainersByDescription(description *dcluster.ContainerDescription) error {
+	err := ctx.deployGroup(description)
+	if err != nil {
+		ctx.report.setGroupResult(description.Group, GROUP_FAILED, err)
+	} else {
+		ctx.report.setGroupResult(description.Group, GROUP_SUCCEEDED, nil)
+	}
+	return err
+}
+
+func (ctx *ClusterContext) deployGroup(description *dcluster.ContainerDescription) error {
 	log.Debugf("deploy container by description:%+v", description)
+	ctx.report.addGroup(description.Group)
 	log.Debugf("deploy runnning container of group '%s'", description.Group)
 	if err := ctx.deployRunningContainersByDescription(description); err != nil {
 		return err
 	}
+	if err := ctx.checkLock(); err != nil {
+		return err
+	}
 	log.Debugf("scale out container of group '%s'", description.Group)
 	if err := ctx.scaleOutContainersByDescription(description); err != nil {
 		return err
 	}
+	if err := ctx.checkLock(); err != nil {
+		return err
+	}
 	log.Debugf("scale in container of group '%s'", description.Group)
 	if err := ctx.scaleInContainersByDescription(description); err != nil {
 		return err
 	}
 	log.Debugf("remove stopped container of group '%s'", description.Group)
-	return ctx.removeStoppedContainerByGroup(description.Group)
+	if err := ctx.removeStoppedContainerByGroup(description.Group); err != nil {
+		return err
+	}
+	// the deploy is done even if the revision can not be recorded.
+	if err := ctx.recordRevision(description); err != nil {
+		log.Warnf("Failed to record the revision of group '%s'. err:%s", description.Group, err.Error())
+	}
+	return nil
 }
 
 func (ctx *ClusterContext) addContainerDescription(gdeps *dcontainer.ContainerGroupDeps, description *dcluster.ContainerDescription) error {
@@ -1105,30 +1528,30 @@ func (ctx *ClusterContext) splitDescription() (map[string]dcluster.ContainerDesc
 			sdNameGroupMap[sdName] = group
 			sdGroups[group] = true
 		} else {
-			fmt.Printf("Service discover container missed. discovery name:%s.\n", sdName)
+			dlog.Printf("Service discover container missed. discovery name:%s.\n", sdName)
 		}
 	}
 
-	fmt.Printf("Service discover container group:%+v\n", sdGroups)
+	dlog.Printf("Service discover container group:%+v\n", sdGroups)
 
 	for _, description := range ctx.clusterDesc.Container.Topology {
 		group := description.Group
 		descriptions[group] = description
-		fmt.Printf("Description: group:%s, description:%+v, total:%+v\n", group, description, descriptions)
+		dlog.Printf("Description: group:%s, description:%+v, total:%+v\n", group, description, descriptions)
 		// add deps
-		fmt.Printf("Add dependancy for group: group:%s, deps:%+v\n", group, description.Deps)
+		dlog.Printf("Add dependancy for group: group:%s, deps:%+v\n", group, description.Deps)
 
 		gDeps.AddDeps(group, description.Deps)
 
-		if description.ServiceDiscover != "" {
-			if depGroup, ok := sdNameGroupMap[description.ServiceDiscover]; ok {
-				fmt.Printf("Add dependancy. group:%s, deps:%+v\n", group, depGroup)
+		for _, sd := range description.GetServiceDiscovers() {
+			if depGroup, ok := sdNameGroupMap[sd]; ok {
+				dlog.Printf("Add dependancy. group:%s, deps:%+v\n", group, depGroup)
 				gDeps.AddDeps(group, []string{depGroup})
 			}
 		}
 	}
 
-	fmt.Printf("Total description:%+v\n", descriptions)
+	dlog.Printf("Total description:%+v\n", descriptions)
 
 	allGroups := gDeps.List()
 	sdDGroups := []string{}
@@ -1147,29 +1570,63 @@ func (ctx *ClusterContext) deployContainers() error {
 	descriptions := ctx.getSortedBizDescriptionByType()
 	log.Infof("The num of biz container description is %d", len(descriptions))
 
+	ec := &errorCollector{}
 	for _, description := range descriptions {
+		if err := ctx.checkLock(); err != nil {
+			log.Warnf("Group '%s' skipped. %s", description.Group, err.Error())
+			ctx.report.setGroupResult(description.Group, GROUP_SKIPPED, err)
+			continue
+		}
+		// the groups are sorted by the dependancies, so the deps are always deployed before.
+		if dep, failed := ctx.getFailedDep(&description); failed {
+			err := fmt.Errorf("Group '%s' skipped, as the group '%s' it depends on is not deployed.", description.Group, dep)
+			log.Warnf("%s", err.Error())
+			ctx.report.setGroupResult(description.Group, GROUP_SKIPPED, err)
+			continue
+		}
 		log.Infof("Deploy container for group '%s'", description.Group)
 		if err := ctx.deployContainersByDescription(&description); err != nil {
-			panic(fmt.Sprintf("Failed to deploy container for group:%s. err:%s", description.Group, err.Error()))
+			log.Errorf("Failed to deploy container for group:%s. err:%s", description.Group, err.Error())
+			ec.add(fmt.Errorf("Failed to deploy container for group:%s. err:%s", description.Group, err.Error()))
 		}
+	}
 
+	if err := ctx.checkLock(); err != nil {
+		ec.add(err)
 	}
 
 	log.Infof("Reload the containers after all biz container deployed")
 	if err := ctx.loadContainers(); err != nil {
 		return errors.New("Failed to load containers:" + err.Error())
 	}
+	if err := ec.err(); err != nil {
+		return err
+	}
 	log.Info("biz contontainer deployed successfully")
 	return nil
 }
 
+// the first dependancy of the group failed or skipped in this deploy.
+func (ctx *ClusterContext) getFailedDep(description *dcluster.ContainerDescription) (string, bool) {
+	for _, dep := range description.Deps {
+		switch ctx.report.getGroupStatus(dep) {
+		case GROUP_FAILED, GROUP_SKIPPED:
+			return dep, true
+		}
+	}
+	return "", false
+}
+
 // return: running, restart, error
 func (ctx *ClusterContext) startMachines(machines []dmachine.MachineInfo, md dcluster.MachineDescription) (int, int, error) {
 	running := 0
 	stoppedNodes := func(ms []dmachine.MachineInfo) []string {
 		stopped := []string{}
 		for _, m := range ms {
-			if !m.IsRunning() {
+			if ctx.isCordoned(m.Name) {
+				// the cordoned machines run no new container, so they are neither started nor counted toward the minimal num.
+				log.Infof("Machine '%s' is cordoned, not counted as running. group:%s", m.Name, md.Group)
+			} else if !m.IsRunning() {
 				stopped = append(stopped, m.Name)
 			} else {
 				running++
@@ -1182,7 +1639,7 @@ func (ctx *ClusterContext) startMachines(machines []dmachine.MachineInfo, md dcl
 
 	max := md.MinNum
 	if running >= max {
-		fmt.Printf("Enough node running, no need to start extra machines. group:%s, running:%d, max:%d\n", md.Group, running, max)
+		dlog.Printf("Enough node running, no need to start extra machines. group:%s, running:%d, max:%d\n", md.Group, running, max)
 		return running, 0, nil
 	}
 
@@ -1200,17 +1657,17 @@ func (ctx *ClusterContext) startMachines(machines []dmachine.MachineInfo, md dcl
 		if start >= end {
 			break
 		}
-		fmt.Printf("nodes:%+v, start:%d, end:%d\n", stoppedNodes, start, end)
+		dlog.Printf("nodes:%+v, start:%d, end:%d\n", stoppedNodes, start, end)
 		toBeStart := stoppedNodes[start:end]
 
 		if len(toBeStart) == 0 || running >= max {
-			fmt.Printf("No stopped machines exists or running machine is enough. stopped:%d, running:%d, max nedd:%d\n", len(toBeStart), running, max)
+			dlog.Printf("No stopped machines exists or running machine is enough. stopped:%d, running:%d, max nedd:%d\n", len(toBeStart), running, max)
 			break
 		}
 		succesNames, err := ctx.mProxy.Start(toBeStart...)
 		running = running + len(succesNames)
 		if err != nil {
-			fmt.Printf("Start stopped machine failed. names:%+v, err:%s\n", toBeStart, err.Error())
+			dlog.Printf("Start stopped machine failed. names:%+v, err:%s\n", toBeStart, err.Error())
 			errs = append(errs, err.Error())
 		}
 	}
@@ -1227,41 +1684,41 @@ func (ctx *ClusterContext) scaleMachineOutByGroup(md dcluster.MachineDescription
 	min := md.MinNum
 	machines, err := ctx.mProxy.ListByGroup(md.Group)
 	if err != nil {
-		fmt.Printf("Failed to load machine for group:%s\n", err.Error())
+		dlog.Printf("Failed to load machine for group:%s\n", err.Error())
 		return err
 	}
 
-	fmt.Printf("Start stopped machines for group:%s\n", md.Group)
+	dlog.Printf("Start stopped machines for group:%s\n", md.Group)
 	runningNum, restarted, err := ctx.startMachines(machines, md)
 	if err != nil {
-		fmt.Printf("Error happend when Start machines for group:%s. total running:%d, need: %d, err:%s\n", md.Group, runningNum, min, err.Error())
+		dlog.Printf("Error happend when Start machines for group:%s. total running:%d, need: %d, err:%s\n", md.Group, runningNum, min, err.Error())
 	} else {
-		fmt.Printf("Start machines complete for group:%s. running:%d, need: %d\n", md.Group, runningNum, min)
+		dlog.Printf("Start machines complete for group:%s. running:%d, need: %d\n", md.Group, runningNum, min)
 	}
 
 	if runningNum >= min {
-		fmt.Printf("Running machines num is enough(%d) for the cluster minimal need(%d)\n", runningNum, min)
+		dlog.Printf("Running machines num is enough(%d) for the cluster minimal need(%d)\n", runningNum, min)
 		return nil
 	}
-	fmt.Printf("Running machines num is 'not' enough(%d) for the cluster minimal need(%d)\n", runningNum, min)
+	dlog.Printf("Running machines num is 'not' enough(%d) for the cluster minimal need(%d)\n", runningNum, min)
 
 	toBeCreateNum := min - runningNum
-	fmt.Printf("Creating %d machines of group '%s'\n", toBeCreateNum, md.Group)
+	dlog.Printf("Creating %d machines of group '%s'\n", toBeCreateNum, md.Group)
 	startedNames, err := ctx.createSlaves(md, toBeCreateNum)
 	createdNum := len(startedNames)
 	runningNum += createdNum
 	if err != nil {
-		fmt.Printf("Error happened when create machines of group '%s'. err:%s\n", md.Group, err.Error())
+		dlog.Printf("Error happened when create machines of group '%s'. err:%s\n", md.Group, err.Error())
 	}
 
-	fmt.Printf("%d machines running, of which %d restarted and %d created.group: %s.\n", runningNum, restarted, createdNum, md.Group)
+	dlog.Printf("%d machines running, of which %d restarted and %d created.group: %s.\n", runningNum, restarted, createdNum, md.Group)
 
 	if runningNum < min {
 		errInfo := fmt.Sprintf("Machine num if not enough. Rumming is %d, but the minimal requirements is %d.\n", runningNum, min)
 		return errors.New(errInfo)
 	}
 
-	fmt.Printf("Running machine num scale out up to %d, the minimal requirements is %d.\n", runningNum, min)
+	dlog.Printf("Running machine num scale out up to %d, the minimal requirements is %d.\n", runningNum, min)
 	return nil
 }
 
@@ -1279,14 +1736,14 @@ func (ctx *ClusterContext) scaleMachineOut() error {
 			if err := ctx.scaleMachineOutByGroup(md); err != nil {
 				errs = append(errs, err.Error())
 			}
-			fmt.Printf("Scale machine out for group '%s' complete \n", md.Group)
+			dlog.Printf("Scale machine out for group '%s' complete \n", md.Group)
 		}(md)
 	}
 	wg.Wait()
 	if len(errs) > 0 {
 		return fmt.Errorf("Scale machine out error:%+v", errs)
 	}
-	fmt.Printf("Scale machine out complete.\n")
+	dlog.Printf("Scale machine out complete.\n")
 	return nil
 }
 
@@ -1311,7 +1768,7 @@ func (ctx *ClusterContext) startMaster() error {
 	masterMachineInfo, exists := ctx.getMaster()
 	if !exists {
 		if ctx.create {
-			fmt.Printf("Master is not exists on the cluster, creating an new master.\n")
+			dlog.Printf("Master is not exists on the cluster, creating an new master.\n")
 			group := ctx.clusterDesc.MasterGroup
 			if group == "" {
 				group, _ = dmachine.ParseMachineName(ctx.clusterDesc.Master)
@@ -1324,18 +1781,18 @@ func (ctx *ClusterContext) startMaster() error {
 				return err
 			}
 			ctx.reloadMachineInfos()
-			fmt.Printf("Master node create and running.\n")
+			dlog.Printf("Master node create and running.\n")
 		} else {
 			return errors.New("Master Not Exists.")
 		}
 	} else {
 		if !masterMachineInfo.IsRunning() {
-			fmt.Printf("Master node(%s) is not running, try to start...\n", masterMachineInfo.Name)
+			dlog.Printf("Master node(%s) is not running, try to start...\n", masterMachineInfo.Name)
 			if succNames, err := ctx.mProxy.Start(masterMachineInfo.Name); len(succNames) == 0 {
 				return err
 			}
 			ctx.reloadMachineInfos()
-			fmt.Printf("Master node(%s) started.\n", masterMachineInfo.Name)
+			dlog.Printf("Master node(%s) started.\n", masterMachineInfo.Name)
 		}
 	}
 	return nil
@@ -1353,7 +1810,7 @@ func (ctx *ClusterContext) createConsulClusterServers(nodes []string) error {
 	}
 
 	errs := ""
-	fmt.Printf("Consul server is not exists, a new consul cluster with machine names(%+v) will be created.\n", nodes)
+	dlog.Printf("Consul server is not exists, a new consul cluster with machine names(%+v) will be created.\n", nodes)
 	var wg sync.WaitGroup
 	for _, node := range nodes {
 		wg.Add(1)
@@ -1366,10 +1823,10 @@ func (ctx *ClusterContext) createConsulClusterServers(nodes []string) error {
 				"group=consulcluster",
 			}
 			if err := ctx.mProxy.CreateMachine(n, *smd, opts); err != nil {
-				fmt.Printf("Failed to create consul server. node:%s, err:%s\n", n, err.Error())
+				dlog.Printf("Failed to create consul server. node:%s, err:%s\n", n, err.Error())
 				errs = errs + "--" + err.Error()
 			} else {
-				fmt.Printf("One consul server created. name:%s\n", n)
+				dlog.Printf("One consul server created. name:%s\n", n)
 			}
 		}(ctx, node)
 	}
@@ -1381,10 +1838,70 @@ func (ctx *ClusterContext) createConsulClusterServers(nodes []string) error {
 	return nil
 }
 
+// resolve the ips of the consul servers managed by dockerf, without creating or starting any of them.
+func (ctx *ClusterContext) loadConsulServerIPs() error {
+	server := ctx.clusterDesc.ConsulCluster.Server
+	if len(server.IPs) > 0 || len(server.Nodes) == 0 {
+		return nil
+	}
+	serverMachineInfos, err := ctx.mProxy.Proxy.List(func(mi *dmachine.MachineInfo) bool {
+		for _, node := range server.Nodes {
+			if node == mi.Name {
+				return mi.IsRunning()
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if len(serverMachineInfos) != len(server.Nodes) {
+		log.Warnf("%d consul server expected, but %d running found.", len(server.Nodes), len(serverMachineInfos))
+		return nil
+	}
+	consulServerIPs, err := ctx.mProxy.IPs(server.Nodes)
+	if err != nil {
+		return err
+	}
+	ctx.setConsulServerIPs(consulServerIPs)
+	return nil
+}
+
+// all the consul servers managed by dockerf are expected to be running once the cluster is locked.
+func (ctx *ClusterContext) checkConsulServers() error {
+	nodes := ctx.clusterDesc.ConsulCluster.Server.Nodes
+	running, err := ctx.mProxy.Proxy.List(func(mi *dmachine.MachineInfo) bool {
+		for _, node := range nodes {
+			if node == mi.Name {
+				return mi.IsRunning()
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if len(running) != len(nodes) {
+		return fmt.Errorf("%d consul servers expected running, but %d found after the cluster is locked. Try again later.", len(nodes), len(running))
+	}
+	return nil
+}
+
+func (ctx *ClusterContext) setConsulServerIPs(consulServerIPs []string) {
+	nodes := ctx.clusterDesc.ConsulCluster.Server.Nodes
+	ctx.clusterDesc.ConsulCluster.Server.IPs = consulServerIPs
+	discovery := ctx.clusterDesc.Discovery
+	for i := 0; i < len(consulServerIPs); i++ {
+		discovery = strings.Replace(discovery, nodes[i], consulServerIPs[i], -1)
+	}
+	ctx.clusterDesc.Discovery = discovery
+	ctx.mProxy.Discovery = discovery
+}
+
 func (ctx *ClusterContext) startConsulCluster() error {
 	server := ctx.clusterDesc.ConsulCluster.Server
 	if len(server.IPs) > 0 {
-		fmt.Printf("Consule server ips(%+v) provided and managed outsided of dockerf.\n", server.IPs)
+		dlog.Printf("Consule server ips(%+v) provided and managed outsided of dockerf.\n", server.IPs)
 		return nil
 	}
 	nodes := server.Nodes
@@ -1417,7 +1934,7 @@ func (ctx *ClusterContext) startConsulCluster() error {
 				stoppedNodes = append(stoppedNodes, m.Name)
 			}
 		}
-		fmt.Printf("Consul server(num:%d) is exists, %d are stopped and will be restarted. \n", len(serverMachineInfos), len(stoppedNodes))
+		dlog.Printf("Consul server(num:%d) is exists, %d are stopped and will be restarted. \n", len(serverMachineInfos), len(stoppedNodes))
 		if len(stoppedNodes) > 0 {
 			_, err := ctx.mProxy.Start(stoppedNodes...)
 			if err != nil {
@@ -1432,7 +1949,7 @@ func (ctx *ClusterContext) startConsulCluster() error {
 		if err := ctx.createConsulClusterServers(nodes); err != nil {
 			return err
 		}
-		fmt.Printf("All Consul server created. names:%+v\n", nodes)
+		dlog.Printf("All Consul server created. names:%+v\n", nodes)
 		serverIPs, err := ctx.mProxy.IPs(nodes)
 		if err != nil {
 			return errors.New("Failed to load consul server ips. err:" + err.Error())
@@ -1440,12 +1957,12 @@ func (ctx *ClusterContext) startConsulCluster() error {
 		consulServerIPs = serverIPs
 		bootstrapServerNode := nodes[0]
 		bootstrapServerIp := serverIPs[0]
-		fmt.Printf("Run bootstrap consul server on. node:%s, ip:%s\n", bootstrapServerNode, bootstrapServerIp)
+		dlog.Printf("Run bootstrap consul server on. node:%s, ip:%s\n", bootstrapServerNode, bootstrapServerIp)
 		if cid, err := ctx.runConsulBootstrapServer(bootstrapServerNode, bootstrapServerIp); err != nil {
-			fmt.Printf("Failed to run bootstrap consul server. node:%s, ip:%s. err:%s\n", bootstrapServerNode, bootstrapServerIp, err.Error())
+			dlog.Printf("Failed to run bootstrap consul server. node:%s, ip:%s. err:%s\n", bootstrapServerNode, bootstrapServerIp, err.Error())
 			return err
 		} else {
-			fmt.Printf("Successfully run bootstrap consul server. cid:%s, node:%s, ip:%s. err:%s\n", cid, bootstrapServerNode, bootstrapServerIp)
+			dlog.Printf("Successfully run bootstrap consul server. cid:%s, node:%s, ip:%s.\n", cid, bootstrapServerNode, bootstrapServerIp)
 		}
 		if len(serverIPs) > 1 {
 			errs := ""
@@ -1453,15 +1970,15 @@ func (ctx *ClusterContext) startConsulCluster() error {
 			joinNodes := nodes[1:]
 			for idx, ip := range joinIps {
 				node := joinNodes[idx]
-				fmt.Printf("Run join consul server on node:%s, ip:%s\n", node, ip)
+				dlog.Printf("Run join consul server on node:%s, ip:%s\n", node, ip)
 				wg.Add(1)
 				go func(ctx *ClusterContext, n string, ip string) {
 					defer wg.Done()
 					if cid, err := ctx.runConsulJoinServer(server, n, ip, bootstrapServerIp); err != nil {
 						errs = errs + "--" + err.Error()
-						fmt.Printf("Failed to run consul join server. join node:%s, join ip:%s, boot strap node:%s, boot strap ip:%s. err:%s\n", n, ip, bootstrapServerNode, bootstrapServerIp, err.Error())
+						dlog.Printf("Failed to run consul join server. join node:%s, join ip:%s, boot strap node:%s, boot strap ip:%s. err:%s\n", n, ip, bootstrapServerNode, bootstrapServerIp, err.Error())
 					} else {
-						fmt.Printf("Successfully run consul join server. cid:%s, join node:%s, join ip:%s, boot strap node:%s, boot strap ip:%s\n", cid, n, ip, bootstrapServerNode, bootstrapServerIp)
+						dlog.Printf("Successfully run consul join server. cid:%s, join node:%s, join ip:%s, boot strap node:%s, boot strap ip:%s\n", cid, n, ip, bootstrapServerNode, bootstrapServerIp)
 					}
 
 				}(ctx, node, ip)
@@ -1472,14 +1989,8 @@ func (ctx *ClusterContext) startConsulCluster() error {
 			}
 		}
 	}
-	ctx.clusterDesc.ConsulCluster.Server.IPs = consulServerIPs
-	discovery := ctx.clusterDesc.Discovery
-	for i := 0; i < len(consulServerIPs); i++ {
-		discovery = strings.Replace(discovery, nodes[i], consulServerIPs[i], -1)
-	}
-	ctx.clusterDesc.Discovery = discovery
-	ctx.mProxy.Discovery = discovery
+	ctx.setConsulServerIPs(consulServerIPs)
 
-	fmt.Printf("Consul server cluster start complete. ips:%+v discovery:%s\n", ctx.clusterDesc.ConsulCluster.Server.IPs, ctx.clusterDesc.Discovery)
+	dlog.Printf("Consul server cluster start complete. ips:%+v discovery:%s\n", ctx.clusterDesc.ConsulCluster.Server.IPs, ctx.clusterDesc.Discovery)
 	return nil
 }
@@ -0,0 +1,225 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/discovery"
+)
+
+// the service register driver keeping the registered addresses in memory.
+type fakeRegistry struct {
+	lock       sync.Mutex
+	registered map[string]bool
+	err        error // returned by Register and UnRegister if set
+}
+
+func newFakeRegistry() *discovery.ServiceRegisterDriver {
+	var driver discovery.ServiceRegisterDriver = &fakeRegistry{registered: map[string]bool{}}
+	return &driver
+}
+
+func fakeRegistryOf(driver *discovery.ServiceRegisterDriver) *fakeRegistry {
+	return (*driver).(*fakeRegistry)
+}
+
+func (r *fakeRegistry) Registry(urls []string) {}
+
+func (r *fakeRegistry) Register(host string, port int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.registered[fmt.Sprintf("%s:%d", host, port)] = true
+	return nil
+}
+
+func (r *fakeRegistry) UnRegister(host string, port int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	delete(r.registered, fmt.Sprintf("%s:%d", host, port))
+	return nil
+}
+
+func (r *fakeRegistry) addresses() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	addresses := []string{}
+	for address := range r.registered {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func TestRegisterServiceByContainer(t *testing.T) {
+	c := newTestContainer("web", "web-1", "web:1", "Up 2 hours")
+	c.IpPorts = []dcontainer.IPPort{
+		{IP: "10.0.0.1", PublicPort: 8000, PrivatePort: 8080},
+		{IP: "10.0.0.1", PublicPort: 9000, PrivatePort: 9090},
+		{IP: "10.0.0.1", PublicPort: 9053, PrivatePort: 53},
+	}
+	tests := []struct {
+		name     string
+		bindings []dcluster.PortBinding
+		failed   string // the registry failing to register
+		nginx    []string
+		metrics  []string
+		valid    bool
+	}{
+		{
+			name:     "no service discover",
+			bindings: []dcluster.PortBinding{{ContainerPort: 8080}},
+			nginx:    []string{},
+			metrics:  []string{},
+			valid:    true,
+		},
+		{
+			name:     "first port",
+			bindings: []dcluster.PortBinding{{ContainerPort: 8080, ServiceDiscover: "nginx"}, {ContainerPort: 9090}},
+			nginx:    []string{"10.0.0.1:8000"},
+			metrics:  []string{},
+			valid:    true,
+		},
+		{
+			name:     "port per service discover",
+			bindings: []dcluster.PortBinding{{ContainerPort: 8080, ServiceDiscover: "nginx"}, {ContainerPort: 9090, ServiceDiscover: "metrics"}, {ContainerPort: 53, ServiceDiscover: "nginx"}},
+			nginx:    []string{"10.0.0.1:8000", "10.0.0.1:9053"},
+			metrics:  []string{"10.0.0.1:9000"},
+			valid:    true,
+		},
+		{
+			name:     "port not exposed",
+			bindings: []dcluster.PortBinding{{ContainerPort: 8081, ServiceDiscover: "nginx"}},
+			nginx:    []string{},
+			metrics:  []string{},
+			valid:    false,
+		},
+		{
+			name:     "service discover not defined",
+			bindings: []dcluster.PortBinding{{ContainerPort: 8080, ServiceDiscover: "dns"}},
+			nginx:    []string{},
+			metrics:  []string{},
+			valid:    false,
+		},
+		{
+			name:     "register failed",
+			bindings: []dcluster.PortBinding{{ContainerPort: 8080, ServiceDiscover: "nginx"}, {ContainerPort: 9090, ServiceDiscover: "metrics"}},
+			failed:   "metrics",
+			nginx:    []string{"10.0.0.1:8000"},
+			metrics:  []string{},
+			valid:    false,
+		},
+	}
+	for _, test := range tests {
+		ctx := &ClusterContext{
+			serviceRegistries: map[string]*discovery.ServiceRegisterDriver{"nginx": newFakeRegistry(), "metrics": newFakeRegistry()},
+			report:            NewDeployReport(),
+		}
+		if test.failed != "" {
+			fakeRegistryOf(ctx.serviceRegistries[test.failed]).err = errors.New("unavailable")
+		}
+		cd := &dcluster.ContainerDescription{Group: "web", PortBindings: test.bindings}
+		err := ctx.registerServiceByContainer(&c, cd)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected registered %v, but got error %v", test.name, test.valid, err)
+		}
+		if nginx := fakeRegistryOf(ctx.serviceRegistries["nginx"]).addresses(); !reflect.DeepEqual(nginx, test.nginx) {
+			t.Errorf("%s: expected %v registered with nginx, but got %v", test.name, test.nginx, nginx)
+		}
+		if metrics := fakeRegistryOf(ctx.serviceRegistries["metrics"]).addresses(); !reflect.DeepEqual(metrics, test.metrics) {
+			t.Errorf("%s: expected %v registered with metrics, but got %v", test.name, test.metrics, metrics)
+		}
+	}
+}
+
+func TestUnregisterService(t *testing.T) {
+	ctx := &ClusterContext{
+		serviceRegistries: map[string]*discovery.ServiceRegisterDriver{"nginx": newFakeRegistry()},
+		report:            NewDeployReport(),
+	}
+	cd := &dcluster.ContainerDescription{Group: "web"}
+	nginx := ctx.serviceRegistries["nginx"]
+	(*nginx).Register("10.0.0.1", 8000)
+	(*nginx).Register("10.0.0.1", 8001)
+	if err := ctx.unregisterService("10.0.0.1", 8000, "nginx", cd); err != nil {
+		t.Errorf("Failed to unregister 10.0.0.1:8000: %s", err.Error())
+	}
+	if err := ctx.unregisterService("10.0.0.1", 8000, "dns", cd); err == nil {
+		t.Errorf("The service discover not defined is expected to fail")
+	}
+	if addresses := fakeRegistryOf(nginx).addresses(); !reflect.DeepEqual(addresses, []string{"10.0.0.1:8001"}) {
+		t.Errorf("Only 10.0.0.1:8001 is expected to be registered, but got %v", addresses)
+	}
+	if len(ctx.report.Registrations) != 1 || ctx.report.Registrations[0].Port != 8000 {
+		t.Errorf("The unregistration is expected to be reported, but got %+v", ctx.report.Registrations)
+	}
+}
+
+func TestGetPublicPort(t *testing.T) {
+	c := newTestContainer("web", "web-1", "web:1", "Up 2 hours")
+	c.IpPorts = []dcontainer.IPPort{
+		{IP: "10.0.0.1", PublicPort: 8000, PrivatePort: 8080},
+		{IP: "10.0.0.2", PublicPort: 9000, PrivatePort: 9090},
+	}
+	tests := []struct {
+		containerPort int
+		ip            string
+		port          int
+		found         bool
+	}{
+		{8080, "10.0.0.1", 8000, true},
+		{9090, "10.0.0.2", 9000, true},
+		{53, "", 0, false},
+	}
+	for _, test := range tests {
+		ip, port, found := getPublicPort(&c, test.containerPort)
+		if ip != test.ip || port != test.port || found != test.found {
+			t.Errorf("port %d is expected to be exposed on %s:%d (%v), but got %s:%d (%v)", test.containerPort, test.ip, test.port, test.found, ip, port, found)
+		}
+	}
+}
+
+func TestResizeMachineGroupBounds(t *testing.T) {
+	ctx := &ClusterContext{
+		clusterDesc: &dcluster.Cluster{
+			Master: "test-master",
+			Machine: dcluster.MachineCluster{
+				Topology: dcluster.MachineTopology{{Group: "web", MinNum: 2, MaxNum: 5}},
+			},
+		},
+	}
+	tests := []struct {
+		group    string
+		num      int
+		force    bool
+		expected string // the error expected
+	}{
+		{"redis", 3, false, "No machine description found"},
+		{"web", -1, true, "not a valid machine num"},
+		{"web", 1, false, "must be between 2 and 5"},
+		{"web", 6, false, "must be between 2 and 5"},
+		// the master is checked once the num is allowed.
+		{"web", 2, false, "is not running"},
+		{"web", 5, false, "is not running"},
+		{"web", 0, true, "is not running"},
+		{"web", 8, true, "is not running"},
+	}
+	for _, test := range tests {
+		err := ctx.ResizeMachineGroup(test.group, test.num, test.force)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("group %s, num %d, force %v: expected error '%s', but got %v", test.group, test.num, test.force, test.expected, err)
+		}
+	}
+}
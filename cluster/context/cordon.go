@@ -0,0 +1,165 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	consul "github.com/hashicorp/consul/api"
+)
+
+const (
+	CORDON_KEY = "cordons"
+)
+
+// CordonInfo is who cordoned the machine and why, kept in the consul kv as 'dockerf/MASTER/cordons/MACHINE'.
+type CordonInfo struct {
+	Machine string    `json:"machine" yaml:"machine"`
+	Reason  string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Owner   string    `json:"owner" yaml:"owner"`
+	Host    string    `json:"host" yaml:"host"`
+	Since   time.Time `json:"since" yaml:"since"`
+}
+
+// Cordons is the cordoned machines of the cluster, sorted by name.
+type Cordons struct {
+	Machines []CordonInfo `json:"machines" yaml:"machines"`
+}
+
+func (c *Cordons) Print(w io.Writer) {
+	if len(c.Machines) == 0 {
+		fmt.Fprintf(w, "No machine is cordoned.\n")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MACHINE\tSINCE\tBY\tREASON\t")
+	for _, ci := range c.Machines {
+		fmt.Fprintf(tw, "%s\t%s\t%s@%s\t%s\t\n", ci.Machine, ci.Since.Format(time.RFC3339), ci.Owner, ci.Host, ci.Reason)
+	}
+	tw.Flush()
+}
+
+func newCordonInfo(machine, reason string) *CordonInfo {
+	owner := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	host, _ := os.Hostname()
+	return &CordonInfo{
+		Machine: machine,
+		Reason:  reason,
+		Owner:   owner,
+		Host:    host,
+		Since:   time.Now(),
+	}
+}
+
+// load the cordoned machines from the consul kv, and no new container is placed on them then.
+func (ctx *ClusterContext) loadCordons() error {
+	store, err := ctx.getKVStore()
+	if err != nil {
+		return err
+	}
+	prefix := ctx.kvKey(CORDON_KEY) + KV_SEPARATOR
+	pairs, err := store.list(prefix)
+	if err != nil {
+		return err
+	}
+	cordons := map[string]CordonInfo{}
+	for _, pair := range pairs {
+		machine := strings.TrimPrefix(pair.Key, prefix)
+		if machine == "" {
+			continue
+		}
+		info := CordonInfo{}
+		if err := json.Unmarshal(pair.Value, &info); err != nil {
+			log.Warnf("Invalid cordon info of machine '%s'. err:%s", machine, err.Error())
+		}
+		info.Machine = machine
+		cordons[machine] = info
+		ctx.placements.exclude(machine)
+	}
+	ctx.cordons = cordons
+	if len(cordons) > 0 {
+		log.Infof("%d machines cordoned, no new container runs on them.", len(cordons))
+	}
+	return nil
+}
+
+func (ctx *ClusterContext) isCordoned(machine string) bool {
+	_, cordoned := ctx.cordons[machine]
+	return cordoned
+}
+
+// Cordon takes the machine out of the scheduling, the containers running on it are kept.
+func (ctx *ClusterContext) Cordon(name, reason string) error {
+	mi, exists := ctx.getMachine(name)
+	if !exists {
+		return fmt.Errorf("Machine '%s' is not found", name)
+	}
+	if mi.IsMaster() {
+		return fmt.Errorf("Machine '%s' is the master, which can not be cordoned", name)
+	}
+	store, err := ctx.getKVStore()
+	if err != nil {
+		return err
+	}
+	info := newCordonInfo(name, reason)
+	value, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := store.put(&consul.KVPair{Key: ctx.kvKey(CORDON_KEY, name), Value: value}); err != nil {
+		return fmt.Errorf("Failed to cordon machine '%s': %s", name, err.Error())
+	}
+	ctx.cordons[name] = *info
+	ctx.placements.exclude(name)
+	log.Infof("Machine '%s' cordoned.", name)
+	return nil
+}
+
+// Uncordon puts the machine back into the scheduling. The machines removed from the cluster can be uncordoned too.
+func (ctx *ClusterContext) Uncordon(name string) error {
+	if !ctx.isCordoned(name) {
+		return fmt.Errorf("Machine '%s' is not cordoned", name)
+	}
+	store, err := ctx.getKVStore()
+	if err != nil {
+		return err
+	}
+	if err := store.delete(ctx.kvKey(CORDON_KEY, name)); err != nil {
+		return fmt.Errorf("Failed to uncordon machine '%s': %s", name, err.Error())
+	}
+	delete(ctx.cordons, name)
+	log.Infof("Machine '%s' uncordoned.", name)
+	return nil
+}
+
+// Cordons lists the cordoned machines of the cluster.
+func (ctx *ClusterContext) Cordons() *Cordons {
+	cordons := &Cordons{Machines: []CordonInfo{}}
+	for _, info := range ctx.cordons {
+		cordons.Machines = append(cordons.Machines, info)
+	}
+	sort.Sort(sortCordonByMachine(cordons.Machines))
+	return cordons
+}
+
+type sortCordonByMachine []CordonInfo
+
+func (s sortCordonByMachine) Len() int {
+	return len(s)
+}
+func (s sortCordonByMachine) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortCordonByMachine) Less(i, j int) bool {
+	return s[i].Machine < s[j].Machine
+}
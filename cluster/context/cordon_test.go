@@ -0,0 +1,95 @@
+package context
+
+import (
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+func newCordonTestContext(store kvStore) *ClusterContext {
+	cache := dcluster.ContainerDescription{Group: "cache", Machine: "redis", Placement: dcluster.Placement{Spread: true}}
+	return &ClusterContext{
+		clusterDesc: &dcluster.Cluster{
+			Master: "test-master",
+			Machine: dcluster.MachineCluster{
+				Topology: dcluster.MachineTopology{{Group: "redis"}},
+			},
+			Container: dcluster.ContainerCluster{
+				Topology: dcluster.ContainerTopology{cache},
+			},
+		},
+		machineInfos: []dmachine.MachineInfo{
+			{Name: "test-master", Master: "test-master", State: "Running"},
+			newTestMachine("redis", "redis-1", "Running"),
+			newTestMachine("redis", "redis-2", "Running"),
+		},
+		kvStore:    store,
+		placements: newPlacements(),
+		cordons:    map[string]CordonInfo{},
+	}
+}
+
+func TestCordon(t *testing.T) {
+	store := newMemKVStore()
+	ctx := newCordonTestContext(store)
+	if err := ctx.Cordon("redis-9", ""); err == nil {
+		t.Errorf("The machine not found is expected not to be cordoned")
+	}
+	if err := ctx.Cordon("test-master", ""); err == nil {
+		t.Errorf("The master is expected not to be cordoned")
+	}
+	if err := ctx.Cordon("redis-1", "disk failure"); err != nil {
+		t.Fatalf("Failed to cordon machine redis-1: %s", err.Error())
+	}
+
+	// another deploy loads the cordons from the kv.
+	loaded := newCordonTestContext(store)
+	if err := loaded.loadCordons(); err != nil {
+		t.Fatalf("Failed to load the cordons: %s", err.Error())
+	}
+	cordons := loaded.Cordons().Machines
+	if len(cordons) != 1 || cordons[0].Machine != "redis-1" || cordons[0].Reason != "disk failure" {
+		t.Errorf("Machine redis-1 is expected to be cordoned for the disk failure, but got %+v", cordons)
+	}
+	cache := loaded.clusterDesc.Container.Topology[0]
+	for i := 0; i < 2; i++ {
+		if node, err := loaded.placeContainer(&cache, cache.Group); err != nil || node != "redis-2" {
+			t.Errorf("Container %d is expected to be placed on redis-2 but not the cordoned one, but got '%s', %v", i, node, err)
+		}
+	}
+
+	if err := loaded.Uncordon("redis-1"); err != nil {
+		t.Errorf("Failed to uncordon machine redis-1: %s", err.Error())
+	}
+	if err := loaded.Uncordon("redis-1"); err == nil {
+		t.Errorf("The machine uncordoned is expected not to be uncordoned again")
+	}
+	reloaded := newCordonTestContext(store)
+	if err := reloaded.loadCordons(); err != nil || len(reloaded.Cordons().Machines) != 0 {
+		t.Errorf("No machine is expected to be cordoned, but got %+v, %v", reloaded.Cordons().Machines, err)
+	}
+}
+
+func TestStartMachinesCordoned(t *testing.T) {
+	ctx := &ClusterContext{cordons: map[string]CordonInfo{"redis-1": {Machine: "redis-1"}, "redis-3": {Machine: "redis-3"}}}
+	machines := []dmachine.MachineInfo{
+		newTestMachine("redis", "redis-1", "Running"),
+		newTestMachine("redis", "redis-2", "Running"),
+		newTestMachine("redis", "redis-3", "Stopped"),
+	}
+	tests := []struct {
+		min     int
+		running int
+	}{
+		{0, 1},
+		{1, 1},
+	}
+	for _, test := range tests {
+		md := dcluster.MachineDescription{Group: "redis", MinNum: test.min}
+		running, started, err := ctx.startMachines(machines, md)
+		if running != test.running || started != 0 || err != nil {
+			t.Errorf("min %d: expected %d running without the cordoned, but got %d running, %d started, %v", test.min, test.running, running, started, err)
+		}
+	}
+}
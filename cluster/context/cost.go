@@ -0,0 +1,148 @@
+package context
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dopts "github.com/weibocom/dockerf/machine/opts"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DEFAULT_PRICE_PERIOD = "month"
+)
+
+// PriceTable is the price of every instance type, such as 'ecs.s2.large: 270', edited as the cloud changes its prices.
+type PriceTable struct {
+	Currency string
+	Period   string // what a price is paid for, such as month or hour
+	Prices   map[string]float64
+}
+
+func LoadPriceTable(file string) (*PriceTable, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pt := &PriceTable{}
+	if err := yaml.Unmarshal(b, pt); err != nil {
+		return nil, fmt.Errorf("Invalid price file '%s': %s", file, err.Error())
+	}
+	if pt.Period == "" {
+		pt.Period = DEFAULT_PRICE_PERIOD
+	}
+	return pt, nil
+}
+
+// GroupCost is what the machines of a group cost, from the minnum to the maxnum of the group.
+type GroupCost struct {
+	Group        string  `json:"group" yaml:"group"`
+	Driver       string  `json:"driver" yaml:"driver"`
+	Cpu          int     `json:"cpu" yaml:"cpu"`
+	Memory       string  `json:"memory" yaml:"memory"`
+	InstanceType string  `json:"instance-type,omitempty" yaml:"instance-type,omitempty"`
+	MinNum       int     `json:"min-num" yaml:"min-num"`
+	MaxNum       int     `json:"max-num" yaml:"max-num"`
+	Price        float64 `json:"price" yaml:"price"`
+	MinCost      float64 `json:"min-cost" yaml:"min-cost"`
+	MaxCost      float64 `json:"max-cost" yaml:"max-cost"`
+	// why the group is not priced, such as no instance type matched or no price of the instance type.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ClusterCost is the cost of the machine groups in cluster.yml. The groups of the drivers without instance types,
+// such as virtualbox, cost nothing.
+type ClusterCost struct {
+	Currency string      `json:"currency" yaml:"currency"`
+	Period   string      `json:"period" yaml:"period"`
+	Groups   []GroupCost `json:"groups" yaml:"groups"`
+	MinCost  float64     `json:"min-cost" yaml:"min-cost"`
+	MaxCost  float64     `json:"max-cost" yaml:"max-cost"`
+	// the groups not priced, which are left out of the total.
+	Unpriced []string `json:"unpriced" yaml:"unpriced"`
+}
+
+func (cc *ClusterCost) Complete() bool {
+	return len(cc.Unpriced) == 0
+}
+
+func (cc *ClusterCost) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "GROUP\tDRIVER\tCPU\tMEMORY\tINSTANCE TYPE\tMIN\tMAX\tPRICE\tMIN COST\tMAX COST\t\n")
+	for _, gc := range cc.Groups {
+		instanceType := gc.InstanceType
+		if instanceType == "" {
+			instanceType = "-"
+		}
+		if gc.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%d\t%d\t-\t-\t-\t\n", gc.Group, gc.Driver, gc.Cpu, gc.Memory, instanceType, gc.MinNum, gc.MaxNum)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t\n", gc.Group, gc.Driver, gc.Cpu, gc.Memory, instanceType, gc.MinNum, gc.MaxNum, gc.Price, gc.MinCost, gc.MaxCost)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nTotal per %s: %.2f - %.2f %s\n", cc.Period, cc.MinCost, cc.MaxCost, cc.Currency)
+	if !cc.Complete() {
+		fmt.Fprintf(w, "Not priced, left out of the total: %s\n", strings.Join(cc.Unpriced, ", "))
+		for _, gc := range cc.Groups {
+			if gc.Error != "" {
+				fmt.Fprintf(w, "    %s: %s\n", gc.Group, gc.Error)
+			}
+		}
+	}
+}
+
+// Cost sums the prices of the instance types the machine groups of the cluster are created with.
+func Cost(cluster *dcluster.Cluster, prices *PriceTable) *ClusterCost {
+	cc := &ClusterCost{
+		Currency: prices.Currency,
+		Period:   prices.Period,
+		Groups:   []GroupCost{},
+		Unpriced: []string{},
+	}
+	for _, md := range cluster.Machine.Topology {
+		gc := GroupCost{
+			Group:  md.Group,
+			Driver: cluster.Machine.GetDriverName(&md),
+			Cpu:    md.GetCpu(),
+			Memory: md.Memory,
+			MinNum: md.MinNum,
+			MaxNum: md.MaxNum,
+		}
+		if gc.Memory == "" {
+			gc.Memory = "512m"
+		}
+		given := []string{}
+		if driver, exists := cluster.Machine.Cloud[gc.Driver]; exists {
+			given = driver.GetOptions()
+		}
+		instanceType, err := dopts.GetInstanceType(gc.Driver, md, given)
+		gc.InstanceType = instanceType
+		switch {
+		case err != nil:
+			gc.Error = err.Error()
+		case instanceType == "":
+			// the machines of the driver are not paid for by instance type.
+		default:
+			price, exists := prices.Prices[instanceType]
+			if !exists {
+				gc.Error = fmt.Sprintf("No price of instance type '%s' in the price table.", instanceType)
+				break
+			}
+			gc.Price = price
+			gc.MinCost = price * float64(md.MinNum)
+			gc.MaxCost = price * float64(md.MaxNum)
+		}
+		if gc.Error != "" {
+			cc.Unpriced = append(cc.Unpriced, md.Group)
+		}
+		cc.MinCost += gc.MinCost
+		cc.MaxCost += gc.MaxCost
+		cc.Groups = append(cc.Groups, gc)
+	}
+	return cc
+}
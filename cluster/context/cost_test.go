@@ -0,0 +1,64 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func TestCost(t *testing.T) {
+	cluster := &dcluster.Cluster{
+		Machine: dcluster.MachineCluster{
+			Cloud: dcluster.CloudDrivers{
+				"aliyun":     {Default: true},
+				"virtualbox": {},
+			},
+			Topology: dcluster.MachineTopology{
+				{Group: "master", Cpu: 1, Memory: "1g", MinNum: 1, MaxNum: 1},
+				{Group: "web", Cpu: 2, Memory: "4g", MinNum: 2, MaxNum: 5},
+				{Group: "redis", Cpu: 4, Memory: "32g", MinNum: 1, MaxNum: 2},
+				{Group: "odd", Cpu: 3, Memory: "4g", MinNum: 1, MaxNum: 1},
+				{Group: "local", Cloud: "virtualbox", MinNum: 3, MaxNum: 3},
+			},
+		},
+	}
+	prices := &PriceTable{
+		Currency: "CNY",
+		Period:   DEFAULT_PRICE_PERIOD,
+		Prices: map[string]float64{
+			"ecs.t1.small": 50,
+			"ecs.s2.large": 270,
+		},
+	}
+	cc := Cost(cluster, prices)
+
+	tests := []struct {
+		group        string
+		instanceType string
+		minCost      float64
+		maxCost      float64
+		priced       bool
+	}{
+		{"master", "ecs.t1.small", 50, 50, true},
+		{"web", "ecs.s2.large", 540, 1350, true},
+		{"redis", "ecs.m2.medium", 0, 0, false},
+		{"odd", "", 0, 0, false},
+		{"local", "", 0, 0, true},
+	}
+	if len(cc.Groups) != len(tests) {
+		t.Fatalf("Expected %d groups priced, but got %+v", len(tests), cc.Groups)
+	}
+	for i, test := range tests {
+		gc := cc.Groups[i]
+		if gc.Group != test.group || gc.InstanceType != test.instanceType || gc.MinCost != test.minCost || gc.MaxCost != test.maxCost || (gc.Error == "") != test.priced {
+			t.Errorf("Group %s is expected to be %s from %.2f to %.2f, priced %v, but got %+v", test.group, test.instanceType, test.minCost, test.maxCost, test.priced, gc)
+		}
+	}
+	if cc.MinCost != 590 || cc.MaxCost != 1400 {
+		t.Errorf("The cluster is expected to cost from 590.00 to 1400.00, but got from %.2f to %.2f", cc.MinCost, cc.MaxCost)
+	}
+	if !reflect.DeepEqual(cc.Unpriced, []string{"redis", "odd"}) || cc.Complete() {
+		t.Errorf("Groups redis and odd are expected to be unpriced, but got %v", cc.Unpriced)
+	}
+}
@@ -0,0 +1,161 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+// the running containers on the machines, loaded again as the containers may be filtered in the deploy.
+func (ctx *ClusterContext) getRunningContainersByMachine() (map[string][]dcontainer.ContainerInfo, error) {
+	infos, err := ctx.loadAllContainers()
+	if err != nil {
+		return nil, err
+	}
+	containers := map[string][]dcontainer.ContainerInfo{}
+	for _, c := range infos {
+		if c.IsUp() {
+			containers[c.Node] = append(containers[c.Node], c)
+		}
+	}
+	return containers, nil
+}
+
+// move the container off its machine: run a replacement, which passes the health check and is registered,
+// and stop the container then. The containers of the groups not in the cluster are stopped only if forced.
+func (ctx *ClusterContext) moveContainer(c *dcontainer.ContainerInfo, force bool) error {
+	description, exists := ctx.clusterDesc.Container.Topology.GetDescription(c.Group)
+	if !exists {
+		if !force {
+			return fmt.Errorf("Group '%s' of container '%s' is not in the cluster, the container can not be replaced", c.Group, c.Name[0])
+		}
+		log.Warnf("Group '%s' of container '%s' is not in the cluster, the container is stopped without a replacement.", c.Group, c.Name[0])
+		return ctx.stopContainer(c, nil)
+	}
+	if err := ctx.runContainer(description, c.Group); err != nil {
+		return fmt.Errorf("Container '%s' is not moved off machine '%s', as its replacement failed: %s", c.Name[0], c.Node, err.Error())
+	}
+	return ctx.stopContainer(c, description)
+}
+
+// fail if some running containers on the machine can not be replaced, as their groups are not in the cluster.
+func (ctx *ClusterContext) checkReplaceable(machine string, containers []dcontainer.ContainerInfo, force bool) error {
+	unreplaceable := []string{}
+	for i := range containers {
+		if _, exists := ctx.clusterDesc.Container.Topology.GetDescription(containers[i].Group); !exists {
+			unreplaceable = append(unreplaceable, containers[i].Name[0])
+		}
+	}
+	if len(unreplaceable) > 0 && !force {
+		return fmt.Errorf("Containers %v on machine '%s' are not in the cluster and can not be replaced, use '--force' to stop them without replacements", unreplaceable, machine)
+	}
+	return nil
+}
+
+// move all the running containers off the machine, which is excluded from the placement already. Nothing is moved
+// if some containers can not be replaced, unless forced to stop them without replacements.
+func (ctx *ClusterContext) drainMachine(name string, containers []dcontainer.ContainerInfo, force bool) error {
+	if err := ctx.checkReplaceable(name, containers, force); err != nil {
+		return err
+	}
+	dlog.Printf("Draining %d containers off machine '%s'.\n", len(containers), name)
+	ec := &errorCollector{}
+	var wg sync.WaitGroup
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c dcontainer.ContainerInfo) {
+			defer wg.Done()
+			err := protect(func() error {
+				return ctx.moveContainer(&c, force)
+			})
+			if err != nil {
+				log.Errorf("Failed to move container off machine '%s'. name:%s, err:%s", name, c.Name[0], err.Error())
+				ctx.report.addFailure(c.Group, c.Name[0], err)
+				ec.add(err)
+			}
+		}(c)
+	}
+	wg.Wait()
+	if err := ec.err(); err != nil {
+		return err
+	}
+	dlog.Printf("Machine '%s' is drained.\n", name)
+	return nil
+}
+
+// DrainMachine moves all the running containers off the machine, to the other machines of their groups. The machine
+// is cordoned first and kept cordoned, so no new container runs on it even by the other processes. The containers
+// of the groups not in the cluster fail the drain before anything is moved, unless forced to be stopped.
+// The context must be locked.
+func (ctx *ClusterContext) DrainMachine(name string, force bool) error {
+	mi, exists := ctx.getMachine(name)
+	if !exists {
+		return fmt.Errorf("Machine '%s' is not found", name)
+	}
+	if mi.IsMaster() {
+		return fmt.Errorf("Machine '%s' is the master, which can not be drained", name)
+	}
+	if ctx.cProxy == nil {
+		return fmt.Errorf("Master '%s' is not running, no container can be moved", ctx.clusterDesc.Master)
+	}
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+	containers, err := ctx.getRunningContainersByMachine()
+	if err != nil {
+		return err
+	}
+	if err := ctx.checkReplaceable(name, containers[name], force); err != nil {
+		return err
+	}
+	if !ctx.isCordoned(name) {
+		if err := ctx.Cordon(name, "drained"); err != nil {
+			return err
+		}
+	}
+	return ctx.drainMachine(name, containers[name], force)
+}
+
+func (ctx *ClusterContext) getMachine(name string) (dmachine.MachineInfo, bool) {
+	for _, mi := range ctx.machineInfos {
+		if mi.Name == name {
+			return mi, true
+		}
+	}
+	return dmachine.MachineInfo{}, false
+}
+
+// the machines with fewer running containers first, which are cheaper to drain.
+type sortMachineByContainers struct {
+	machines   []dmachine.MachineInfo
+	containers map[string][]dcontainer.ContainerInfo
+}
+
+func (s sortMachineByContainers) Len() int {
+	return len(s.machines)
+}
+func (s sortMachineByContainers) Swap(i, j int) {
+	s.machines[i], s.machines[j] = s.machines[j], s.machines[i]
+}
+func (s sortMachineByContainers) Less(i, j int) bool {
+	ci, cj := len(s.containers[s.machines[i].Name]), len(s.containers[s.machines[j].Name])
+	if ci != cj {
+		return ci < cj
+	}
+	return s.machines[i].Name < s.machines[j].Name
+}
+
+// choose the machines to destroy in scale-in, the ones with the fewest running containers.
+func chooseMachinesToDrain(machines []dmachine.MachineInfo, containers map[string][]dcontainer.ContainerInfo, num int) []dmachine.MachineInfo {
+	sorted := append([]dmachine.MachineInfo{}, machines...)
+	sort.Sort(sortMachineByContainers{machines: sorted, containers: containers})
+	if num > len(sorted) {
+		num = len(sorted)
+	}
+	return sorted[:num]
+}
@@ -0,0 +1,73 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+func TestChooseMachinesToDrain(t *testing.T) {
+	machines := []dmachine.MachineInfo{
+		newTestMachine("web", "web-1", "Running"),
+		newTestMachine("web", "web-2", "Running"),
+		newTestMachine("web", "web-3", "Running"),
+		newTestMachine("web", "web-4", "Running"),
+	}
+	containers := map[string][]dcontainer.ContainerInfo{
+		"web-1": {newPlacedContainer("nginx", "web-1"), newPlacedContainer("redis", "web-1")},
+		"web-2": {newPlacedContainer("nginx", "web-2")},
+		"web-4": {newPlacedContainer("nginx", "web-4"), newPlacedContainer("redis", "web-4"), newPlacedContainer("mysql", "web-4")},
+	}
+	tests := []struct {
+		num      int
+		expected []string
+	}{
+		{0, []string{}},
+		{1, []string{"web-3"}},
+		{2, []string{"web-3", "web-2"}},
+		{3, []string{"web-3", "web-2", "web-1"}},
+		{5, []string{"web-3", "web-2", "web-1", "web-4"}},
+	}
+	for _, test := range tests {
+		chosen := []string{}
+		for _, m := range chooseMachinesToDrain(machines, containers, test.num) {
+			chosen = append(chosen, m.Name)
+		}
+		if !reflect.DeepEqual(chosen, test.expected) {
+			t.Errorf("%d machines to drain are expected to be %v, but got %v", test.num, test.expected, chosen)
+		}
+	}
+	if machines[0].Name != "web-1" || machines[3].Name != "web-4" {
+		t.Errorf("The machines given are reordered: %v", machines)
+	}
+}
+
+func TestCheckReplaceable(t *testing.T) {
+	ctx := &ClusterContext{
+		clusterDesc: &dcluster.Cluster{
+			Container: dcluster.ContainerCluster{
+				Topology: dcluster.ContainerTopology{{Group: "nginx"}, {Group: "redis"}},
+			},
+		},
+	}
+	tests := []struct {
+		name       string
+		containers []dcontainer.ContainerInfo
+		force      bool
+		valid      bool
+	}{
+		{"no container", nil, false, true},
+		{"in the cluster", []dcontainer.ContainerInfo{newPlacedContainer("nginx", "web-1"), newPlacedContainer("redis", "web-1")}, false, true},
+		{"not in the cluster", []dcontainer.ContainerInfo{newPlacedContainer("nginx", "web-1"), newPlacedContainer("mysql", "web-1")}, false, false},
+		{"forced", []dcontainer.ContainerInfo{newPlacedContainer("mysql", "web-1")}, true, true},
+	}
+	for _, test := range tests {
+		err := ctx.checkReplaceable("web-1", test.containers, test.force)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected replaceable %v, but got error %v", test.name, test.valid, err)
+		}
+	}
+}
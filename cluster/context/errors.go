@@ -0,0 +1,50 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// errorCollector collects the errors of the operations running in several goroutines.
+type errorCollector struct {
+	lock sync.Mutex
+	errs []string
+}
+
+func (ec *errorCollector) add(err error) {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	ec.errs = append(ec.errs, err.Error())
+}
+
+func (ec *errorCollector) len() int {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	return len(ec.errs)
+}
+
+// all the collected errors in one, nil if nothing collected.
+func (ec *errorCollector) err() error {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	if len(ec.errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(ec.errs, ERROR_SEPARATOR))
+}
+
+// protect runs the operation, and turns its panic into an error,
+// so a crashed operation never kills the goroutines operating other containers.
+func protect(op func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Operation crashed: %v", r)
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return op()
+}
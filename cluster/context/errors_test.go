@@ -0,0 +1,62 @@
+package context
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestErrorCollector(t *testing.T) {
+	ec := &errorCollector{}
+	if ec.len() != 0 || ec.err() != nil {
+		t.Errorf("The empty collector is expected to have no error, but got %v", ec.err())
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ec.add(errors.New("failed"))
+		}()
+	}
+	wg.Wait()
+	if ec.len() != 10 {
+		t.Errorf("10 errors are expected to be collected, but got %d", ec.len())
+	}
+
+	ec = &errorCollector{}
+	ec.add(errors.New("first"))
+	ec.add(errors.New("second"))
+	if err := ec.err(); err == nil || err.Error() != "first"+ERROR_SEPARATOR+"second" {
+		t.Errorf("The errors are expected to be joined by '%s', but got %v", ERROR_SEPARATOR, err)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       func() error
+		expected string
+	}{
+		{"succeeded", func() error { return nil }, ""},
+		{"failed", func() error { return errors.New("failed") }, "failed"},
+		{"crashed", func() error { panic("crashed") }, "crashed"},
+		{"nil map", func() error {
+			var m map[string]int
+			m["a"] = 1
+			return nil
+		}, "assignment to entry in nil map"},
+	}
+	for _, test := range tests {
+		err := protect(test.op)
+		if test.expected == "" {
+			if err != nil {
+				t.Errorf("%s: expected no error, but got %s", test.name, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s: expected error '%s', but got %v", test.name, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package context
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+)
+
+// HealthCheckError means a container runs, but never passes the health check of its group.
+type HealthCheckError struct {
+	Container string
+	Err       error
+}
+
+func (e *HealthCheckError) Error() string {
+	return fmt.Sprintf("Container '%s' is unhealthy: %s", e.Container, e.Err.Error())
+}
+
+func isHealthCheckError(err error) bool {
+	_, ok := err.(*HealthCheckError)
+	return ok
+}
+
+func getPublicAddress(c *dcontainer.ContainerInfo, containerPort int) (string, bool) {
+	ip, port, ok := getPublicPort(c, containerPort)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s:%d", ip, port), true
+}
+
+func (ctx *ClusterContext) checkHealthOnce(c *dcontainer.ContainerInfo, hc *dcluster.HealthCheck, cd *dcluster.ContainerDescription, timeout time.Duration) error {
+	switch {
+	case hc.HTTP != "":
+		port := hc.Port
+		if port <= 0 {
+			port = cd.PortBinding.ContainerPort
+		}
+		address, ok := getPublicAddress(c, port)
+		if !ok {
+			return fmt.Errorf("port %d is not exposed", port)
+		}
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get("http://" + address + "/" + strings.TrimPrefix(hc.HTTP, "/"))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("GET %s returns %d", hc.HTTP, resp.StatusCode)
+		}
+		return nil
+	case hc.TCP > 0:
+		address, ok := getPublicAddress(c, hc.TCP)
+		if !ok {
+			return fmt.Errorf("port %d is not exposed", hc.TCP)
+		}
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		command := fmt.Sprintf("docker exec %s sh -c '%s'", c.ID, strings.Replace(hc.Cmd, "'", `'\''`, -1))
+		output, err := ctx.mProxy.ExecCmdOutput(c.Node, command, timeout)
+		if err != nil {
+			return fmt.Errorf("%s %s", err.Error(), strings.TrimSpace(output))
+		}
+		return nil
+	}
+}
+
+// check the container with the health check of the group, until it passes or the retries are used up.
+// It passes if the group has no health check.
+func (ctx *ClusterContext) checkHealth(cid string, cd *dcluster.ContainerDescription) error {
+	hc := &cd.HealthCheck
+	if !hc.Enabled() {
+		return nil
+	}
+	timeout, err := hc.GetTimeout()
+	if err != nil {
+		return fmt.Errorf("Invalid health check timeout of group '%s': %s", cd.Group, err.Error())
+	}
+	interval, err := hc.GetInterval()
+	if err != nil {
+		return fmt.Errorf("Invalid health check interval of group '%s': %s", cd.Group, err.Error())
+	}
+
+	var lastErr error
+	for i := 0; i < hc.GetRetries(); i++ {
+		time.Sleep(interval)
+		// the ports are not listed until the container runs.
+		c, exists := ctx.cProxy.GetContainerByID(cid)
+		if !exists {
+			return &HealthCheckError{Container: cid, Err: fmt.Errorf("container is not exists")}
+		}
+		if lastErr = ctx.checkHealthOnce(&c, hc, cd, timeout); lastErr == nil {
+			log.Infof("Container passed the health check. cid:%s, name:%s", cid, c.Name[0])
+			return nil
+		}
+		log.Warnf("Container failed the health check (%d/%d). cid:%s, name:%s, err:%s", i+1, hc.GetRetries(), cid, c.Name[0], lastErr.Error())
+	}
+	return &HealthCheckError{Container: cid, Err: lastErr}
+}
@@ -0,0 +1,71 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+)
+
+const (
+	HOOK_PRE_STOP   = "prestop"
+	HOOK_POST_START = "poststart"
+)
+
+// HookError means a hook failed, and the policy of the group aborts the operation of the container.
+type HookError struct {
+	Hook      string
+	Container string
+	Err       error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("The %s hook of container '%s' failed: %s", e.Hook, e.Container, e.Err.Error())
+}
+
+func isHookError(err error) bool {
+	_, ok := err.(*HookError)
+	return ok
+}
+
+// run the hook command on the machine of the container, not in the container.
+func (ctx *ClusterContext) runHook(hook, command string, c *dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil
+	}
+	timeout, err := cd.GetHookTimeout()
+	if err != nil {
+		return fmt.Errorf("Invalid hook timeout of group '%s': %s", cd.Group, err.Error())
+	}
+	name := c.Name[0]
+	log.Infof("Run %s hook of container. name:%s, node:%s, command:%s", hook, name, c.Node, command)
+	output, err := ctx.mProxy.ExecCmdOutput(c.Node, command, timeout)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			log.Infof("[%s %s] %s", hook, name, line)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if cd.GetHookPolicy() == dcluster.HOOK_POLICY_ABORT {
+		return &HookError{Hook: hook, Container: name, Err: err}
+	}
+	log.Warnf("The %s hook of container '%s' failed, ignored. err:%s", hook, name, err.Error())
+	return nil
+}
+
+// run the poststart hook of the container just started, which is reloaded to find its node.
+func (ctx *ClusterContext) runPostStartHook(cid string, cd *dcluster.ContainerDescription) error {
+	if strings.TrimSpace(cd.PostStart) == "" {
+		return nil
+	}
+	c, exists := ctx.cProxy.GetContainerByID(cid)
+	if !exists {
+		return fmt.Errorf("Container(cid:%s) is not exists", cid)
+	}
+	return ctx.runHook(HOOK_POST_START, cd.PostStart, &c, cd)
+}
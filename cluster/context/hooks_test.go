@@ -0,0 +1,45 @@
+package context
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+func TestRunHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dockerf-hooks")
+	if err != nil {
+		t.Fatalf("Failed to create the machine store: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	// no machine is in the store, so the hook commands fail.
+	ctx := &ClusterContext{
+		mProxy: &dmachine.MachineClusterProxy{Proxy: dmachine.NewMachineProxy([]string{"--storage-path", dir})},
+	}
+	c := newPlacedContainer("web", "web-9")
+	tests := []struct {
+		name    string
+		command string
+		cd      dcluster.ContainerDescription
+		aborted bool
+		valid   bool
+	}{
+		{"no command", "  ", dcluster.ContainerDescription{Group: "web", HookPolicy: dcluster.HOOK_POLICY_ABORT}, false, true},
+		{"ignored by default", "nginx -s quit", dcluster.ContainerDescription{Group: "web"}, false, true},
+		{"ignored", "nginx -s quit", dcluster.ContainerDescription{Group: "web", HookPolicy: dcluster.HOOK_POLICY_IGNORE}, false, true},
+		{"aborted", "nginx -s quit", dcluster.ContainerDescription{Group: "web", HookPolicy: dcluster.HOOK_POLICY_ABORT}, true, false},
+		{"invalid timeout", "nginx -s quit", dcluster.ContainerDescription{Group: "web", HookTimeout: "soon"}, false, false},
+	}
+	for _, test := range tests {
+		err := ctx.runHook(HOOK_PRE_STOP, test.command, &c, &test.cd)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected the operation going on %v, but got error %v", test.name, test.valid, err)
+		}
+		if isHookError(err) != test.aborted {
+			t.Errorf("%s: expected aborted by the hook %v, but got error %v", test.name, test.aborted, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+const (
+	KV_PREFIX    = "dockerf"
+	KV_SEPARATOR = "/"
+)
+
+// the client of the consul servers, whose kv keeps the states of dockerf for the cluster.
+func (ctx *ClusterContext) newConsulClient() (*consul.Client, error) {
+	ips := ctx.clusterDesc.ConsulCluster.Server.IPs
+	if len(ips) == 0 {
+		return nil, errors.New("No consul server available.")
+	}
+	config := consul.DefaultConfig()
+	config.Address = fmt.Sprintf("%s:8500", ips[0])
+	return consul.NewClient(config)
+}
+
+// the sessions and the kv dockerf keeps the states of the cluster in, such as the deploy lock and the cordons.
+type kvStore interface {
+	createSession(name string) (string, error)
+	// false if the session is gone, such as expired or destroyed.
+	renewSession(session string) (bool, error)
+	destroySession(session string) error
+	acquire(pair *consul.KVPair) (bool, error)
+	release(pair *consul.KVPair) error
+	get(key string) (*consul.KVPair, error)
+	put(pair *consul.KVPair) error
+	// the pairs whose keys start with the prefix.
+	list(prefix string) (consul.KVPairs, error)
+	delete(key string) error
+}
+
+// the kv store in the consul servers of the cluster.
+type consulKVStore struct {
+	client *consul.Client
+}
+
+func (s *consulKVStore) createSession(name string) (string, error) {
+	session, _, err := s.client.Session().Create(&consul.SessionEntry{
+		Name:      name,
+		TTL:       LOCK_TTL.String(),
+		Behavior:  LOCK_BEHAVIOUR,
+		LockDelay: LOCK_DELAY,
+		Checks:    []string{},
+	}, nil)
+	return session, err
+}
+
+func (s *consulKVStore) renewSession(session string) (bool, error) {
+	entry, _, err := s.client.Session().Renew(session, nil)
+	return entry != nil, err
+}
+
+func (s *consulKVStore) destroySession(session string) error {
+	_, err := s.client.Session().Destroy(session, nil)
+	return err
+}
+
+func (s *consulKVStore) acquire(pair *consul.KVPair) (bool, error) {
+	acquired, _, err := s.client.KV().Acquire(pair, nil)
+	return acquired, err
+}
+
+func (s *consulKVStore) release(pair *consul.KVPair) error {
+	_, _, err := s.client.KV().Release(pair, nil)
+	return err
+}
+
+func (s *consulKVStore) get(key string) (*consul.KVPair, error) {
+	pair, _, err := s.client.KV().Get(key, nil)
+	return pair, err
+}
+
+func (s *consulKVStore) put(pair *consul.KVPair) error {
+	_, err := s.client.KV().Put(pair, nil)
+	return err
+}
+
+func (s *consulKVStore) list(prefix string) (consul.KVPairs, error) {
+	pairs, _, err := s.client.KV().List(prefix, nil)
+	return pairs, err
+}
+
+func (s *consulKVStore) delete(key string) error {
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+// the kv store of the cluster, which is the consul servers unless one is set.
+func (ctx *ClusterContext) getKVStore() (kvStore, error) {
+	if ctx.kvStore != nil {
+		return ctx.kvStore, nil
+	}
+	client, err := ctx.newConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	return &consulKVStore{client: client}, nil
+}
+
+// the key of the cluster in the consul kv, as 'dockerf/MASTER/PATH'.
+func (ctx *ClusterContext) kvKey(path ...string) string {
+	parts := []string{KV_PREFIX, ctx.clusterDesc.Master}
+	parts = append(parts, path...)
+	return strings.Join(parts, KV_SEPARATOR)
+}
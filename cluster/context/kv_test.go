@@ -0,0 +1,119 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// the kv store in memory, which behaves like the consul kv with the sessions deleting their locks.
+type memKVStore struct {
+	lock     sync.Mutex
+	seq      int
+	sessions map[string]bool
+	pairs    map[string]*consul.KVPair
+}
+
+func newMemKVStore() *memKVStore {
+	return &memKVStore{sessions: map[string]bool{}, pairs: map[string]*consul.KVPair{}}
+}
+
+func (s *memKVStore) createSession(name string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seq++
+	session := fmt.Sprintf("%s-%d", name, s.seq)
+	s.sessions[session] = true
+	return session, nil
+}
+
+func (s *memKVStore) renewSession(session string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sessions[session], nil
+}
+
+func (s *memKVStore) destroySession(session string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.sessions, session)
+	for key, pair := range s.pairs {
+		if pair.Session == session {
+			delete(s.pairs, key)
+		}
+	}
+	return nil
+}
+
+func (s *memKVStore) acquire(pair *consul.KVPair) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if held, exists := s.pairs[pair.Key]; exists && held.Session != "" && held.Session != pair.Session {
+		return false, nil
+	}
+	p := *pair
+	s.pairs[pair.Key] = &p
+	return true, nil
+}
+
+func (s *memKVStore) release(pair *consul.KVPair) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if held, exists := s.pairs[pair.Key]; exists && held.Session == pair.Session {
+		held.Session = ""
+	}
+	return nil
+}
+
+func (s *memKVStore) get(key string) (*consul.KVPair, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pair, exists := s.pairs[key]
+	if !exists {
+		return nil, nil
+	}
+	p := *pair
+	return &p, nil
+}
+
+func (s *memKVStore) put(pair *consul.KVPair) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p := *pair
+	s.pairs[pair.Key] = &p
+	return nil
+}
+
+func (s *memKVStore) list(prefix string) (consul.KVPairs, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := []string{}
+	for key := range s.pairs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	pairs := consul.KVPairs{}
+	for _, key := range keys {
+		p := *s.pairs[key]
+		pairs = append(pairs, &p)
+	}
+	return pairs, nil
+}
+
+func (s *memKVStore) delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.pairs, key)
+	return nil
+}
+
+func (s *memKVStore) numSessions() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.sessions)
+}
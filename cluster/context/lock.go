@@ -0,0 +1,272 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	consul "github.com/hashicorp/consul/api"
+)
+
+const (
+	LOCK_TTL       = 30 * time.Second
+	LOCK_DELAY     = time.Second
+	LOCK_KEY       = "lock"
+	LOCK_BEHAVIOUR = "delete" // the lock is removed once the session expires
+)
+
+// LockInfo is who holds the deploy lock of the cluster.
+type LockInfo struct {
+	Owner   string    `json:"owner" yaml:"owner"`
+	Host    string    `json:"host" yaml:"host"`
+	Pid     int       `json:"pid" yaml:"pid"`
+	Command string    `json:"command" yaml:"command"`
+	Started time.Time `json:"started" yaml:"started"`
+	Session string    `json:"session" yaml:"session"`
+}
+
+type LockStatus struct {
+	Locked bool      `json:"locked" yaml:"locked"`
+	Holder *LockInfo `json:"holder,omitempty" yaml:"holder,omitempty"`
+}
+
+func (s *LockStatus) Print(w io.Writer) {
+	if !s.Locked {
+		fmt.Fprintf(w, "The cluster is not locked.\n")
+		return
+	}
+	h := s.Holder
+	fmt.Fprintf(w, "The cluster is locked by %s@%s (pid:%d) since %s.\ncommand: %s\nsession: %s\n", h.Owner, h.Host, h.Pid, h.Started.Format(time.RFC3339), h.Command, h.Session)
+}
+
+// the deploy lock held by this process. The session is renewed until the lock is released.
+type clusterLock struct {
+	store   kvStore
+	key     string
+	session string
+	done    chan bool
+	signals chan os.Signal
+	once    sync.Once
+	err     error
+	// why the changes stop, set once the lock is lost or the process is interrupted.
+	stopLock sync.Mutex
+	stopErr  error
+}
+
+func newLockInfo(session string) *LockInfo {
+	owner := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	host, _ := os.Hostname()
+	return &LockInfo{
+		Owner:   owner,
+		Host:    host,
+		Pid:     os.Getpid(),
+		Command: strings.Join(os.Args, " "),
+		Started: time.Now(),
+		Session: session,
+	}
+}
+
+// acquire the deploy lock of the cluster, which fails if someone else holds it.
+func (ctx *ClusterContext) acquireLock() error {
+	if ctx.lock != nil {
+		return nil
+	}
+	store, err := ctx.getKVStore()
+	if err != nil {
+		return fmt.Errorf("Failed to lock the cluster: %s", err.Error())
+	}
+	session, err := store.createSession(ctx.kvKey(LOCK_KEY))
+	if err != nil {
+		return fmt.Errorf("Failed to create the lock session: %s", err.Error())
+	}
+	value, err := json.Marshal(newLockInfo(session))
+	if err != nil {
+		return err
+	}
+	key := ctx.kvKey(LOCK_KEY)
+	acquired, err := store.acquire(&consul.KVPair{Key: key, Value: value, Session: session})
+	if err != nil || !acquired {
+		store.destroySession(session)
+		if err != nil {
+			return fmt.Errorf("Failed to lock the cluster: %s", err.Error())
+		}
+		status, err := ctx.LockStatus()
+		if err != nil || !status.Locked {
+			return fmt.Errorf("Failed to lock the cluster, try again later.")
+		}
+		h := status.Holder
+		return fmt.Errorf("The cluster is locked by %s@%s since %s, command: '%s'. Run 'dockerf cluster lock break' if the lock is stale.", h.Owner, h.Host, h.Started.Format(time.RFC3339), h.Command)
+	}
+
+	l := &clusterLock{
+		store:   store,
+		key:     key,
+		session: session,
+		done:    make(chan bool),
+		signals: make(chan os.Signal, 1),
+	}
+	ctx.lock = l
+	signal.Notify(l.signals, os.Interrupt, syscall.SIGTERM)
+	go ctx.keepLock(l)
+	log.Infof("Cluster locked. key:%s, session:%s", key, session)
+	return nil
+}
+
+// renew the session of the lock, and release the lock if the process is interrupted.
+// The changes stop between the batches then, and the report is written as usual.
+func (ctx *ClusterContext) keepLock(l *clusterLock) {
+	ticker := time.NewTicker(LOCK_TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case sig := <-l.signals:
+			log.Warnf("Interrupted by %s, releasing the cluster lock. Interrupt again to exit at once.", sig)
+			l.stop(fmt.Errorf("Interrupted by %s, the changes stopped.", sig))
+			atomic.StoreInt32(&ctx.interrupted, 1)
+			// the lock this goroutine renews, which the context may not refer to any more.
+			l.release()
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+// renew the session of the lock, and stop the changes if it is gone.
+func (l *clusterLock) renew() {
+	if l.stopped() != nil {
+		// the lost session can not be renewed, but the signals are still handled.
+		return
+	}
+	renewed, err := l.store.renewSession(l.session)
+	if err != nil {
+		log.Warnf("Failed to renew the cluster lock. err:%s", err.Error())
+	} else if !renewed {
+		log.Errorf("The cluster lock is lost, it may be broken by someone else.")
+		l.stop(fmt.Errorf("The cluster lock is lost, the changes stopped. It may be broken by someone else."))
+	}
+}
+
+// the first reason to stop is kept.
+func (l *clusterLock) stop(err error) {
+	l.stopLock.Lock()
+	defer l.stopLock.Unlock()
+	if l.stopErr == nil {
+		l.stopErr = err
+	}
+}
+
+func (l *clusterLock) stopped() error {
+	l.stopLock.Lock()
+	defer l.stopLock.Unlock()
+	return l.stopErr
+}
+
+// isInterrupted tells if the process is interrupted, even if the lock is released already.
+func (ctx *ClusterContext) isInterrupted() bool {
+	return atomic.LoadInt32(&ctx.interrupted) == 1
+}
+
+// the error to stop the changes with, once the lock is lost or the process is interrupted.
+func (ctx *ClusterContext) checkLock() error {
+	if ctx.lock == nil {
+		return nil
+	}
+	return ctx.lock.stopped()
+}
+
+// Close releases the deploy lock of the cluster, if it is held.
+func (ctx *ClusterContext) Close() error {
+	l := ctx.lock
+	if l == nil {
+		return nil
+	}
+	ctx.lock = nil
+	return l.release()
+}
+
+// release the lock and destroy its session, only once even if interrupted while the lock is being released.
+func (l *clusterLock) release() error {
+	l.once.Do(func() {
+		signal.Stop(l.signals)
+		close(l.done)
+		if err := l.store.release(&consul.KVPair{Key: l.key, Session: l.session}); err != nil {
+			log.Warnf("Failed to release the cluster lock. err:%s", err.Error())
+		}
+		if err := l.store.destroySession(l.session); err != nil {
+			log.Warnf("Failed to destroy the lock session, it expires in %s. err:%s", LOCK_TTL, err.Error())
+			l.err = err
+			return
+		}
+		log.Infof("Cluster lock released. key:%s", l.key)
+	})
+	return l.err
+}
+
+func (ctx *ClusterContext) getLock() (kvStore, *consul.KVPair, error) {
+	store, err := ctx.getKVStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := store.get(ctx.kvKey(LOCK_KEY))
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, pair, nil
+}
+
+// LockStatus tells who holds the deploy lock of the cluster.
+func (ctx *ClusterContext) LockStatus() (*LockStatus, error) {
+	_, pair, err := ctx.getLock()
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil || pair.Session == "" {
+		return &LockStatus{Locked: false}, nil
+	}
+	info := &LockInfo{}
+	if err := json.Unmarshal(pair.Value, info); err != nil {
+		log.Warnf("Invalid cluster lock info. err:%s", err.Error())
+	}
+	info.Session = pair.Session
+	return &LockStatus{Locked: true, Holder: info}, nil
+}
+
+// BreakLock destroys the session holding the deploy lock, for the stale lock left by a crashed process.
+func (ctx *ClusterContext) BreakLock() (*LockStatus, error) {
+	store, pair, err := ctx.getLock()
+	if err != nil {
+		return nil, err
+	}
+	status, err := ctx.LockStatus()
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return status, nil
+	}
+	if pair.Session != "" {
+		if err := store.destroySession(pair.Session); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.delete(pair.Key); err != nil {
+		return nil, err
+	}
+	log.Infof("Cluster lock broken. key:%s", pair.Key)
+	return status, nil
+}
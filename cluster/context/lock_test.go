@@ -0,0 +1,164 @@
+package context
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func newLockTestContext(store kvStore) *ClusterContext {
+	return &ClusterContext{
+		clusterDesc: &dcluster.Cluster{Master: "test-master"},
+		kvStore:     store,
+	}
+}
+
+func checkLocked(t *testing.T, ctx *ClusterContext, expected bool, session string) {
+	status, err := ctx.LockStatus()
+	if err != nil {
+		t.Fatalf("Failed to get the lock status: %s", err.Error())
+	}
+	if status.Locked != expected {
+		t.Errorf("The cluster is expected to be locked %v, but got %+v", expected, status)
+	}
+	if expected && status.Holder.Session != session {
+		t.Errorf("The cluster is expected to be locked by session %s, but got %s", session, status.Holder.Session)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	store := newMemKVStore()
+	first := newLockTestContext(store)
+	second := newLockTestContext(store)
+
+	if err := first.acquireLock(); err != nil {
+		t.Fatalf("Failed to acquire the unlocked cluster: %s", err.Error())
+	}
+	checkLocked(t, second, true, first.lock.session)
+	if err := first.acquireLock(); err != nil {
+		t.Errorf("The lock held already is expected to be acquired again, but got %s", err.Error())
+	}
+
+	err := second.acquireLock()
+	if err == nil || !strings.Contains(err.Error(), "locked by") {
+		t.Errorf("The cluster locked is expected to fail with the holder, but got %v", err)
+	}
+	if second.lock != nil || store.numSessions() != 1 {
+		t.Errorf("The session of the failed lock is expected to be destroyed, but got %d sessions", store.numSessions())
+	}
+	if err := second.checkLock(); err != nil {
+		t.Errorf("The context without a lock is expected to go on, but got %s", err.Error())
+	}
+
+	if err := first.Close(); err != nil {
+		t.Errorf("Failed to release the lock: %s", err.Error())
+	}
+	checkLocked(t, second, false, "")
+	if store.numSessions() != 0 {
+		t.Errorf("The session is expected to be destroyed once the lock is released, but got %d sessions", store.numSessions())
+	}
+	if err := second.acquireLock(); err != nil {
+		t.Errorf("Failed to acquire the released lock: %s", err.Error())
+	}
+	second.Close()
+}
+
+func TestBreakLock(t *testing.T) {
+	store := newMemKVStore()
+	stale := newLockTestContext(store)
+	other := newLockTestContext(store)
+
+	status, err := other.BreakLock()
+	if err != nil || status.Locked {
+		t.Errorf("Breaking the unlocked cluster is expected to do nothing, but got %+v, %v", status, err)
+	}
+
+	if err := stale.acquireLock(); err != nil {
+		t.Fatalf("Failed to acquire the unlocked cluster: %s", err.Error())
+	}
+	l := stale.lock
+	status, err = other.BreakLock()
+	if err != nil || !status.Locked || status.Holder.Session != l.session {
+		t.Fatalf("The broken lock is expected to be held by session %s, but got %+v, %v", l.session, status, err)
+	}
+	checkLocked(t, other, false, "")
+
+	l.renew()
+	if err := stale.checkLock(); err == nil || !strings.Contains(err.Error(), "lock is lost") {
+		t.Errorf("The changes are expected to stop once the lock is broken, but got %v", err)
+	}
+	if stale.isInterrupted() {
+		t.Errorf("The lost lock is not expected to interrupt the process")
+	}
+
+	if err := other.acquireLock(); err != nil {
+		t.Errorf("Failed to acquire the broken lock: %s", err.Error())
+	}
+	stale.Close()
+	checkLocked(t, other, true, other.lock.session)
+	other.Close()
+}
+
+func TestInterruptLock(t *testing.T) {
+	store := newMemKVStore()
+	ctx := newLockTestContext(store)
+	if err := ctx.acquireLock(); err != nil {
+		t.Fatalf("Failed to acquire the unlocked cluster: %s", err.Error())
+	}
+	l := ctx.lock
+	l.signals <- syscall.SIGTERM
+	select {
+	case <-l.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The lock is expected to be released once interrupted")
+	}
+
+	if err := ctx.checkLock(); err == nil || !strings.Contains(err.Error(), "Interrupted") {
+		t.Errorf("The changes are expected to stop once interrupted, but got %v", err)
+	}
+	if !ctx.isInterrupted() {
+		t.Errorf("The context is expected to be interrupted")
+	}
+	checkLocked(t, ctx, false, "")
+	if err := ctx.Close(); err != nil {
+		t.Errorf("The lock released already is expected to be closed, but got %s", err.Error())
+	}
+}
+
+func TestClusterLockStop(t *testing.T) {
+	l := &clusterLock{}
+	if l.stopped() != nil {
+		t.Errorf("The new lock is not expected to be stopped, but got %v", l.stopped())
+	}
+	l.stop(errors.New("lost"))
+	l.stop(errors.New("interrupted"))
+	if err := l.stopped(); err == nil || err.Error() != "lost" {
+		t.Errorf("The first reason to stop is expected to be kept, but got %v", err)
+	}
+}
+
+func TestLockStatusPrint(t *testing.T) {
+	started := time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status   *LockStatus
+		expected string
+	}{
+		{&LockStatus{Locked: false}, "The cluster is not locked.\n"},
+		{
+			&LockStatus{Locked: true, Holder: &LockInfo{Owner: "weibo", Host: "dev-1", Pid: 42, Command: "dockerf deploy", Started: started, Session: "s-1"}},
+			"The cluster is locked by weibo@dev-1 (pid:42) since 2016-03-01T10:00:00Z.\ncommand: dockerf deploy\nsession: s-1\n",
+		},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		test.status.Print(buf)
+		if buf.String() != test.expected {
+			t.Errorf("The lock status %+v is expected to be printed as %q, but got %q", test.status, test.expected, buf.String())
+		}
+	}
+}
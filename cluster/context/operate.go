@@ -0,0 +1,236 @@
+package context
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+// the containers selected by the container filters, which are described in the container topology. The service
+// discovery containers are skipped like the master, unless their group is named by the group filter.
+func (ctx *ClusterContext) getOperableContainers() ([]dcontainer.ContainerInfo, error) {
+	if ctx.cProxy == nil {
+		return nil, fmt.Errorf("Master '%s' is not running, the containers can not be operated.", ctx.clusterDesc.Master)
+	}
+	containers := []dcontainer.ContainerInfo{}
+	skipped := map[string]bool{}
+	for _, c := range ctx.containerInfos {
+		cd, ok := ctx.clusterDesc.Container.Topology.GetDescription(c.Group)
+		if !ok {
+			continue
+		}
+		if cd.Type == dcluster.ContainerDescription_TYPE_SD && ctx.filters["group"] != c.Group {
+			if !skipped[c.Group] {
+				log.Warnf("The containers of service discovery group '%s' are skipped, name it by '--c-filter group=%s' to operate them.", c.Group, c.Group)
+				skipped[c.Group] = true
+			}
+			continue
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+func (ctx *ClusterContext) operateContainers(containers []dcontainer.ContainerInfo, op string, operate func(c *dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) error) error {
+	ec := &errorCollector{}
+	var wg sync.WaitGroup
+	for _, c := range containers {
+		cd, _ := ctx.clusterDesc.Container.Topology.GetDescription(c.Group)
+		wg.Add(1)
+		go func(c dcontainer.ContainerInfo) {
+			defer wg.Done()
+			err := protect(func() error {
+				return operate(&c, cd)
+			})
+			if err != nil {
+				log.Errorf("Failed to %s container. name:%s, cid:%s, err:%s", op, c.Name[0], c.ID, err.Error())
+				ctx.report.addFailure(c.Group, c.Name[0], err)
+				ec.add(fmt.Errorf("%s: %s", c.Name[0], err.Error()))
+			}
+		}(c)
+	}
+	wg.Wait()
+	return ec.err()
+}
+
+func (ctx *ClusterContext) startStoppedContainers(containers []dcontainer.ContainerInfo) error {
+	stopped := []dcontainer.ContainerInfo{}
+	for _, c := range containers {
+		if !c.IsUp() {
+			stopped = append(stopped, c)
+		}
+	}
+	dlog.Printf("%d stopped containers will be started.\n", len(stopped))
+	if len(stopped) == 0 {
+		return nil
+	}
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+	return ctx.operateContainers(stopped, "start", ctx.startContainer)
+}
+
+func (ctx *ClusterContext) stopRunningContainers(containers []dcontainer.ContainerInfo) error {
+	running := []dcontainer.ContainerInfo{}
+	for _, c := range containers {
+		if c.IsUp() {
+			running = append(running, c)
+		}
+	}
+	dlog.Printf("%d running containers will be stopped.\n", len(running))
+	if len(running) == 0 {
+		return nil
+	}
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+	return ctx.operateContainers(running, "stop", ctx.stopContainer)
+}
+
+// StartContainers starts the stopped containers selected by the container filters,
+// and registers them to the service discovery.
+func (ctx *ClusterContext) StartContainers() error {
+	containers, err := ctx.getOperableContainers()
+	if err != nil {
+		return err
+	}
+	return ctx.startStoppedContainers(containers)
+}
+
+// StopContainers unregisters the running containers selected by the container filters
+// from the service discovery, and stops them.
+func (ctx *ClusterContext) StopContainers() error {
+	containers, err := ctx.getOperableContainers()
+	if err != nil {
+		return err
+	}
+	return ctx.stopRunningContainers(containers)
+}
+
+// RestartContainers unregisters, restarts and registers the containers selected by the container filters.
+func (ctx *ClusterContext) RestartContainers() error {
+	containers, err := ctx.getOperableContainers()
+	if err != nil {
+		return err
+	}
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+	dlog.Printf("%d containers will be restarted.\n", len(containers))
+	return ctx.operateContainers(containers, "restart", func(c *dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) error {
+		if c.IsUp() {
+			if err := ctx.stopContainer(c, cd); err != nil {
+				return err
+			}
+		}
+		return ctx.startContainer(c, cd)
+	})
+}
+
+// the slave machines of the groups. The master is never operated, as the cluster can not work without it.
+func (ctx *ClusterContext) getMachinesByGroups(groups []string) ([]dmachine.MachineInfo, error) {
+	machines := []dmachine.MachineInfo{}
+	for _, group := range groups {
+		if _, ok := ctx.clusterDesc.Machine.Topology.GetDescription(group); !ok {
+			return nil, fmt.Errorf("No machine description found for group '%s'", group)
+		}
+		mis, err := ctx.mProxy.ListByGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, mi := range mis {
+			if mi.Name == ctx.clusterDesc.Master {
+				log.Warnf("The master machine '%s' is skipped.", mi.Name)
+				continue
+			}
+			machines = append(machines, mi)
+		}
+	}
+	return machines, nil
+}
+
+func (ctx *ClusterContext) getContainersByNodes(nodes []string) ([]dcontainer.ContainerInfo, error) {
+	if ctx.cProxy == nil {
+		return []dcontainer.ContainerInfo{}, nil
+	}
+	all, err := ctx.loadAllContainers()
+	if err != nil {
+		return nil, err
+	}
+	containers := []dcontainer.ContainerInfo{}
+	for _, c := range all {
+		if _, ok := ctx.clusterDesc.Container.Topology.GetDescription(c.Group); !ok {
+			continue
+		}
+		for _, node := range nodes {
+			if c.Node == node {
+				containers = append(containers, c)
+				break
+			}
+		}
+	}
+	return containers, nil
+}
+
+// StartMachines starts the stopped machines of the groups, and then the stopped containers on them.
+func (ctx *ClusterContext) StartMachines(groups []string) error {
+	machines, err := ctx.getMachinesByGroups(groups)
+	if err != nil {
+		return err
+	}
+	stopped := []string{}
+	for _, m := range machines {
+		if !m.IsRunning() {
+			stopped = append(stopped, m.Name)
+		}
+	}
+	dlog.Printf("%d stopped machines will be started. names:%+v\n", len(stopped), stopped)
+	started, startErr := ctx.mProxy.Start(stopped...)
+	if len(started) > 0 {
+		containers, err := ctx.getContainersByNodes(started)
+		if err != nil {
+			return err
+		}
+		if err := ctx.startStoppedContainers(containers); err != nil {
+			return err
+		}
+	}
+	return startErr
+}
+
+// StopMachines stops the containers on the running machines of the groups securely, and then the machines.
+func (ctx *ClusterContext) StopMachines(groups []string) error {
+	machines, err := ctx.getMachinesByGroups(groups)
+	if err != nil {
+		return err
+	}
+	running := []string{}
+	for _, m := range machines {
+		if m.IsRunning() {
+			running = append(running, m.Name)
+		}
+	}
+	containers, err := ctx.getContainersByNodes(running)
+	if err != nil {
+		return err
+	}
+	if err := ctx.stopRunningContainers(containers); err != nil {
+		return err
+	}
+	dlog.Printf("%d running machines will be stopped. names:%+v\n", len(running), running)
+	_, err = ctx.mProxy.Stop(running...)
+	return err
+}
+
+// RestartMachines stops and starts the machines of the groups.
+func (ctx *ClusterContext) RestartMachines(groups []string) error {
+	if err := ctx.StopMachines(groups); err != nil {
+		return err
+	}
+	return ctx.StartMachines(groups)
+}
@@ -0,0 +1,124 @@
+package context
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+)
+
+func newOperateTestContext(filters map[string]string) *ClusterContext {
+	return &ClusterContext{
+		clusterDesc: &dcluster.Cluster{
+			Master: "test-master",
+			Container: dcluster.ContainerCluster{
+				Topology: dcluster.ContainerTopology{
+					{Group: "nginx-sd", Type: dcluster.ContainerDescription_TYPE_SD},
+					{Group: "web", Type: dcluster.ContainerDescription_TYPE_BZ},
+				},
+			},
+		},
+		containerInfos: []dcontainer.ContainerInfo{
+			newTestContainer("nginx-sd", "nginx-sd-1", "nginx:1", "Up 2 hours"),
+			newTestContainer("web", "web-1", "web:1", "Up 2 hours"),
+			newTestContainer("web", "web-2", "web:1", "Exited (0) 2 hours ago"),
+			newTestContainer("mysql", "mysql-1", "mysql:5", "Up 2 hours"),
+		},
+		filters: filters,
+		cProxy:  &dcontainer.DockerProxy{},
+		report:  NewDeployReport(),
+	}
+}
+
+func containerNames(containers []dcontainer.ContainerInfo) []string {
+	names := []string{}
+	for _, c := range containers {
+		names = append(names, c.Name[0])
+	}
+	return names
+}
+
+func TestGetOperableContainers(t *testing.T) {
+	tests := []struct {
+		filters  map[string]string
+		expected []string
+	}{
+		{map[string]string{}, []string{"web-1", "web-2"}},
+		{map[string]string{"group": "web"}, []string{"web-1", "web-2"}},
+		{map[string]string{"group": "nginx-sd"}, []string{"nginx-sd-1"}},
+	}
+	for _, test := range tests {
+		ctx := newOperateTestContext(test.filters)
+		// the containers are loaded with the filters, so only the filtered groups are given.
+		if group, exists := test.filters["group"]; exists {
+			filtered := []dcontainer.ContainerInfo{}
+			for _, c := range ctx.containerInfos {
+				if c.Group == group {
+					filtered = append(filtered, c)
+				}
+			}
+			ctx.containerInfos = filtered
+		}
+		containers, err := ctx.getOperableContainers()
+		if err != nil {
+			t.Errorf("filters %v: failed to get the containers: %s", test.filters, err.Error())
+			continue
+		}
+		if names := containerNames(containers); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("filters %v: expected the containers %v, but got %v", test.filters, test.expected, names)
+		}
+	}
+
+	ctx := newOperateTestContext(map[string]string{})
+	ctx.cProxy = nil
+	if _, err := ctx.getOperableContainers(); err == nil {
+		t.Errorf("The containers are expected not to be operated without the master")
+	}
+}
+
+func TestOperateContainers(t *testing.T) {
+	ctx := newOperateTestContext(map[string]string{})
+	containers := []dcontainer.ContainerInfo{
+		newTestContainer("web", "web-1", "web:1", "Up 2 hours"),
+		newTestContainer("web", "web-2", "web:1", "Up 2 hours"),
+		newTestContainer("web", "web-3", "web:1", "Up 2 hours"),
+	}
+	operated := make(chan string, len(containers))
+	err := ctx.operateContainers(containers, "stop", func(c *dcontainer.ContainerInfo, cd *dcluster.ContainerDescription) error {
+		operated <- c.Name[0]
+		if cd == nil || cd.Group != "web" {
+			return errors.New("no description")
+		}
+		switch c.Name[0] {
+		case "web-2":
+			return errors.New("timeout")
+		case "web-3":
+			panic("crashed")
+		}
+		return nil
+	})
+	close(operated)
+	names := []string{}
+	for name := range operated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"web-1", "web-2", "web-3"}) {
+		t.Errorf("All the containers are expected to be operated, but got %v", names)
+	}
+	if err == nil || !strings.Contains(err.Error(), "web-2: timeout") || !strings.Contains(err.Error(), "web-3: crashed") {
+		t.Errorf("The errors of web-2 and web-3 are expected, but got %v", err)
+	}
+	failed := []string{}
+	for _, f := range ctx.report.Failures {
+		failed = append(failed, f.Container)
+	}
+	sort.Strings(failed)
+	if !reflect.DeepEqual(failed, []string{"web-2", "web-3"}) {
+		t.Errorf("The failures of web-2 and web-3 are expected to be reported, but got %v", failed)
+	}
+}
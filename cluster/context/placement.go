@@ -0,0 +1,178 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+// placements counts the running containers of the groups on the machines. The containers loaded are counted once
+// the first container is placed, and the ones run and stopped in the deploy are counted as they change.
+type placements struct {
+	lock     sync.Mutex
+	loaded   bool
+	counts   map[string]map[string]int // the group to the machine to the number of the containers
+	deltas   map[string]map[string]int
+	excluded map[string]bool // the machines no new container runs on, such as the ones being drained
+}
+
+func newPlacements() *placements {
+	return &placements{
+		counts:   map[string]map[string]int{},
+		deltas:   map[string]map[string]int{},
+		excluded: map[string]bool{},
+	}
+}
+
+func (p *placements) exclude(machine string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.excluded[machine] = true
+}
+
+func (p *placements) excludedMachines() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	machines := []string{}
+	for machine := range p.excluded {
+		machines = append(machines, machine)
+	}
+	sort.Strings(machines)
+	return machines
+}
+
+func addCount(counts map[string]map[string]int, group, machine string, n int) {
+	if _, ok := counts[group]; !ok {
+		counts[group] = map[string]int{}
+	}
+	counts[group][machine] += n
+}
+
+func (p *placements) add(group, machine string, n int) {
+	if machine == "" {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	addCount(p.deltas, group, machine, n)
+}
+
+func (p *placements) count(group, machine string) int {
+	return p.counts[group][machine] + p.deltas[group][machine]
+}
+
+// load the running containers, all of them even if they are filtered in the deploy.
+func (ctx *ClusterContext) loadPlacements() error {
+	p := ctx.placements
+	if p.loaded {
+		return nil
+	}
+	infos := ctx.containerInfos
+	if len(ctx.filters) > 0 {
+		all, err := ctx.loadAllContainers()
+		if err != nil {
+			return err
+		}
+		infos = all
+	}
+	for _, c := range infos {
+		if c.IsUp() {
+			addCount(p.counts, c.Group, c.Node, 1)
+		}
+	}
+	p.loaded = true
+	return nil
+}
+
+// the groups whose containers never share a machine with the ones of the group, named by either side.
+func (ctx *ClusterContext) antiAffinityGroups(group string, placement *dcluster.Placement) []string {
+	groups := append([]string{}, placement.AntiAffinity...)
+	for _, cd := range ctx.clusterDesc.Container.Topology {
+		for _, g := range cd.Placement.AntiAffinity {
+			if g == group {
+				groups = append(groups, cd.Group)
+			}
+		}
+	}
+	return groups
+}
+
+// placeContainer chooses the machine a new container of the group runs on, the one with the fewest containers
+// of the group among the machines satisfying the placement. It returns empty if the group has no placement,
+// and swarm chooses the machine then.
+func (ctx *ClusterContext) placeContainer(cd *dcluster.ContainerDescription, group string) (string, error) {
+	placement := &cd.Placement
+	avoided := ctx.antiAffinityGroups(group, placement)
+	if !placement.IsSet() && len(avoided) == 0 {
+		return "", nil
+	}
+	md, exists := ctx.clusterDesc.Machine.Topology.GetDescription(cd.Machine)
+	if !exists {
+		return "", fmt.Errorf("Machine group '%s' of container group '%s' is not defined", cd.Machine, group)
+	}
+	if err := placement.Matches(md); err != nil {
+		return "", fmt.Errorf("Container group '%s' can not be placed: %s", group, err.Error())
+	}
+
+	p := ctx.placements
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := ctx.loadPlacements(); err != nil {
+		return "", fmt.Errorf("Failed to load the containers to place group '%s': %s", group, err.Error())
+	}
+	machines := ctx.getMachines(func(mi *dmachine.MachineInfo) bool {
+		return mi.Group == cd.Machine && mi.IsRunning()
+	})
+	sort.Sort(sortMachineByName(machines))
+	node, fewest := "", 0
+	for _, m := range machines {
+		if p.excluded[m.Name] {
+			continue
+		}
+		n := p.count(group, m.Name)
+		if placement.MaxPerMachine > 0 && n >= placement.MaxPerMachine {
+			continue
+		}
+		shared := false
+		for _, g := range avoided {
+			if p.count(g, m.Name) > 0 {
+				shared = true
+				break
+			}
+		}
+		if shared {
+			continue
+		}
+		if node == "" || n < fewest {
+			node, fewest = m.Name, n
+		}
+	}
+	if node == "" {
+		return "", fmt.Errorf("No machine of group '%s' satisfies the placement of container group '%s', scale the machines out or relax the placement", cd.Machine, group)
+	}
+	addCount(p.deltas, group, node, 1)
+	log.Debugf("Container of group '%s' placed on machine '%s', %d containers of the group on it before.", group, node, fewest)
+	return node, nil
+}
+
+// the container stopped or started in the deploy.
+func (ctx *ClusterContext) updatePlacement(c *dcontainer.ContainerInfo, n int) {
+	ctx.placements.add(c.Group, c.Node, n)
+}
+
+type sortMachineByName []dmachine.MachineInfo
+
+func (s sortMachineByName) Len() int {
+	return len(s)
+}
+func (s sortMachineByName) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortMachineByName) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
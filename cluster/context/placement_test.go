@@ -0,0 +1,132 @@
+package context
+
+import (
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+func newTestMachine(group, name, state string) dmachine.MachineInfo {
+	return dmachine.MachineInfo{Name: name, Group: group, State: state}
+}
+
+func newPlacedContainer(group, node string) dcontainer.ContainerInfo {
+	c := newTestContainer(group, group+"-"+node, group+":1", "Up 2 hours")
+	c.Node = node
+	return c
+}
+
+func TestPlaceContainer(t *testing.T) {
+	machines := []dmachine.MachineInfo{
+		newTestMachine("redis", "redis-3", "Running"),
+		newTestMachine("redis", "redis-1", "Running"),
+		newTestMachine("redis", "redis-2", "Running"),
+		newTestMachine("redis", "redis-4", "Stopped"),
+		newTestMachine("web", "web-1", "Running"),
+	}
+	tests := []struct {
+		name       string
+		placement  dcluster.Placement
+		containers []dcontainer.ContainerInfo
+		excluded   []string
+		// the other group, which is anti-affinity with the placed group if it names it.
+		other    dcluster.Placement
+		expected []string // the machines the containers are placed on in order, empty for an error
+	}{
+		{
+			name:     "no placement",
+			expected: []string{"", ""},
+		},
+		{
+			name:      "spread",
+			placement: dcluster.Placement{Spread: true},
+			containers: []dcontainer.ContainerInfo{
+				newPlacedContainer("first", "redis-1"),
+				newPlacedContainer("first", "redis-1"),
+				newPlacedContainer("first", "redis-2"),
+			},
+			expected: []string{"redis-3", "redis-2", "redis-3", "redis-1"},
+		},
+		{
+			name:      "max per machine",
+			placement: dcluster.Placement{MaxPerMachine: 1},
+			containers: []dcontainer.ContainerInfo{
+				newPlacedContainer("first", "redis-2"),
+			},
+			expected: []string{"redis-1", "redis-3", ""},
+		},
+		{
+			name:      "anti-affinity",
+			placement: dcluster.Placement{AntiAffinity: []string{"second"}},
+			containers: []dcontainer.ContainerInfo{
+				newPlacedContainer("second", "redis-1"),
+				newPlacedContainer("second", "redis-3"),
+			},
+			expected: []string{"redis-2", "redis-2"},
+		},
+		{
+			name:  "anti-affinity named by the other group",
+			other: dcluster.Placement{AntiAffinity: []string{"first"}},
+			containers: []dcontainer.ContainerInfo{
+				newPlacedContainer("second", "redis-1"),
+				newPlacedContainer("second", "redis-2"),
+				newPlacedContainer("second", "redis-3"),
+			},
+			expected: []string{""},
+		},
+		{
+			name:      "excluded",
+			placement: dcluster.Placement{Spread: true},
+			excluded:  []string{"redis-1", "redis-2"},
+			expected:  []string{"redis-3", "redis-3"},
+		},
+		{
+			name:      "labels not matched",
+			placement: dcluster.Placement{Labels: map[string]string{"disk": "hdd"}},
+			expected:  []string{""},
+		},
+		{
+			name:      "region",
+			placement: dcluster.Placement{Spread: true, Region: "cn-beijing", Labels: map[string]string{"disk": "ssd"}},
+			expected:  []string{"redis-1"},
+		},
+	}
+	for _, test := range tests {
+		first := dcluster.ContainerDescription{Group: "first", Machine: "redis", Placement: test.placement}
+		second := dcluster.ContainerDescription{Group: "second", Machine: "redis", Placement: test.other}
+		ctx := &ClusterContext{
+			clusterDesc: &dcluster.Cluster{
+				Machine: dcluster.MachineCluster{
+					Topology: dcluster.MachineTopology{
+						{Group: "redis", Region: "cn-beijing", Labels: map[string]string{"disk": "ssd"}},
+						{Group: "web"},
+					},
+				},
+				Container: dcluster.ContainerCluster{
+					Topology: dcluster.ContainerTopology{first, second},
+				},
+			},
+			machineInfos:   machines,
+			containerInfos: test.containers,
+			placements:     newPlacements(),
+		}
+		for _, machine := range test.excluded {
+			ctx.placements.exclude(machine)
+		}
+		noPlacement := !test.placement.IsSet() && len(test.other.AntiAffinity) == 0
+		for i, expected := range test.expected {
+			node, err := ctx.placeContainer(&first, "first")
+			if expected == "" && !noPlacement {
+				if err == nil {
+					t.Errorf("%s: container %d is expected to be not placed, but placed on '%s'", test.name, i, node)
+				}
+				continue
+			}
+			if err != nil || node != expected {
+				t.Errorf("%s: container %d is expected to be placed on '%s', but got '%s', %v", test.name, i, expected, node, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package context
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+const (
+	PLAN_MASTER_CREATE = "create"
+	PLAN_MASTER_START  = "start"
+)
+
+type MachineGroupPlan struct {
+	Group   string   `json:"group" yaml:"group"`
+	MinNum  int      `json:"min-num" yaml:"min-num"`
+	MaxNum  int      `json:"max-num" yaml:"max-num"`
+	Running []string `json:"running" yaml:"running"`
+	// the cordoned machines, which are not counted as running.
+	Cordoned []string `json:"cordoned" yaml:"cordoned"`
+	Start    []string `json:"start" yaml:"start"`
+	Create   int      `json:"create" yaml:"create"`
+	Destroy  []string `json:"destroy" yaml:"destroy"`
+}
+
+func (mp *MachineGroupPlan) HasChanges() bool {
+	return len(mp.Start) > 0 || mp.Create > 0 || len(mp.Destroy) > 0
+}
+
+type ContainerGroupPlan struct {
+	Group     string   `json:"group" yaml:"group"`
+	Image     string   `json:"image" yaml:"image"`
+	Num       int      `json:"num" yaml:"num"`
+	Running   []string `json:"running" yaml:"running"`
+	Unchanged []string `json:"unchanged" yaml:"unchanged"`
+	Restart   []string `json:"restart" yaml:"restart"`
+	Replace   []string `json:"replace" yaml:"replace"`
+	ScaleOut  int      `json:"scale-out" yaml:"scale-out"`
+	ScaleIn   []string `json:"scale-in" yaml:"scale-in"`
+	Remove    []string `json:"remove" yaml:"remove"`
+}
+
+func (cp *ContainerGroupPlan) HasChanges() bool {
+	return len(cp.Restart) > 0 || len(cp.Replace) > 0 || cp.ScaleOut > 0 || len(cp.ScaleIn) > 0 || len(cp.Remove) > 0
+}
+
+// ClusterPlan is the full change set a deploy would apply to the cluster.
+type ClusterPlan struct {
+	Master       string   `json:"master" yaml:"master"`
+	MasterAction string   `json:"master-action" yaml:"master-action"`
+	ConsulCreate []string `json:"consul-create" yaml:"consul-create"`
+	ConsulStart  []string `json:"consul-start" yaml:"consul-start"`
+	// false when the master is not running, so the containers can not be listed.
+	ContainersLoaded bool                 `json:"containers-loaded" yaml:"containers-loaded"`
+	Machines         []MachineGroupPlan   `json:"machines" yaml:"machines"`
+	Containers       []ContainerGroupPlan `json:"containers" yaml:"containers"`
+}
+
+func (p *ClusterPlan) HasChanges() bool {
+	if p.MasterAction != "" || len(p.ConsulCreate) > 0 || len(p.ConsulStart) > 0 {
+		return true
+	}
+	for _, mp := range p.Machines {
+		if mp.HasChanges() {
+			return true
+		}
+	}
+	for _, cp := range p.Containers {
+		if cp.HasChanges() {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan computes what a deploy would do, following the same rules as
+// ensureMachineCapacity, initServiceDiscovery and deployContainers.
+func (ctx *ClusterContext) Plan() (*ClusterPlan, error) {
+	plan := &ClusterPlan{
+		Master:           ctx.clusterDesc.Master,
+		ContainersLoaded: ctx.cProxy != nil,
+	}
+	if master, exists := ctx.getMaster(); !exists {
+		plan.MasterAction = PLAN_MASTER_CREATE
+	} else if !master.IsRunning() {
+		plan.MasterAction = PLAN_MASTER_START
+	}
+
+	if err := ctx.planConsulCluster(plan); err != nil {
+		return nil, err
+	}
+
+	for _, md := range ctx.clusterDesc.Machine.Topology {
+		mp, err := ctx.planMachineGroup(md, plan.MasterAction)
+		if err != nil {
+			return nil, err
+		}
+		plan.Machines = append(plan.Machines, mp)
+	}
+
+	descriptions := ctx.getSortedSDDescriptionByType()
+	descriptions = append(descriptions, ctx.getSortedBizDescriptionByType()...)
+	for _, description := range descriptions {
+		plan.Containers = append(plan.Containers, ctx.planContainerGroup(&description))
+	}
+	return plan, nil
+}
+
+func (ctx *ClusterContext) planConsulCluster(plan *ClusterPlan) error {
+	server := ctx.clusterDesc.ConsulCluster.Server
+	if len(server.IPs) > 0 || len(server.Nodes) == 0 {
+		return nil
+	}
+	serverMachineInfos, err := ctx.mProxy.Proxy.List(func(mi *dmachine.MachineInfo) bool {
+		for _, node := range server.Nodes {
+			if node == mi.Name {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if len(serverMachineInfos) == 0 {
+		plan.ConsulCreate = append(plan.ConsulCreate, server.Nodes...)
+		return nil
+	}
+	for _, m := range serverMachineInfos {
+		if !m.IsRunning() {
+			plan.ConsulStart = append(plan.ConsulStart, m.Name)
+		}
+	}
+	return nil
+}
+
+func (ctx *ClusterContext) planMachineGroup(md dcluster.MachineDescription, masterAction string) (MachineGroupPlan, error) {
+	machines, err := ctx.mProxy.ListByGroup(md.Group)
+	if err != nil {
+		return MachineGroupPlan{Group: md.Group, MinNum: md.MinNum, MaxNum: md.MaxNum}, err
+	}
+	return ctx.planMachines(md, machines, masterAction), nil
+}
+
+// plan the machines of a group as ensureMachineCapacity and scaleMachineInByGroup would change them.
+func (ctx *ClusterContext) planMachines(md dcluster.MachineDescription, machines []dmachine.MachineInfo, masterAction string) MachineGroupPlan {
+	mp := MachineGroupPlan{
+		Group:  md.Group,
+		MinNum: md.MinNum,
+		MaxNum: md.MaxNum,
+	}
+	candidates := []dmachine.MachineInfo{}
+	stopped := []dmachine.MachineInfo{}
+	for _, m := range machines {
+		if ctx.isCordoned(m.Name) {
+			// the cordoned machines are neither started nor destroyed, and not counted toward the bounds.
+			mp.Cordoned = append(mp.Cordoned, m.Name)
+		} else if m.IsRunning() || (m.Name == ctx.clusterDesc.Master && masterAction == PLAN_MASTER_START) {
+			// the master is started before the machine capacity is ensured.
+			mp.Running = append(mp.Running, m.Name)
+			candidates = append(candidates, m)
+		} else {
+			stopped = append(stopped, m)
+		}
+	}
+	running := len(mp.Running)
+	if masterAction == PLAN_MASTER_CREATE {
+		if group, _ := dmachine.ParseMachineName(ctx.clusterDesc.Master); group == md.Group {
+			running++
+		}
+	}
+
+	if ctx.mScaleOut && running < md.MinNum {
+		need := md.MinNum - running
+		if need < len(stopped) {
+			stopped = stopped[:need]
+		}
+		for _, m := range stopped {
+			mp.Start = append(mp.Start, m.Name)
+			candidates = append(candidates, m)
+		}
+		running += len(mp.Start)
+		if running < md.MinNum {
+			mp.Create = md.MinNum - running
+			running = md.MinNum
+		}
+	}
+
+	if ctx.mScaleIn && running > md.MaxNum {
+		containers := map[string][]dcontainer.ContainerInfo{}
+		for _, c := range ctx.containerInfos {
+			if c.IsUp() {
+				containers[c.Node] = append(containers[c.Node], c)
+			}
+		}
+		for _, m := range chooseMachinesToDrain(candidates, containers, running-md.MaxNum) {
+			mp.Destroy = append(mp.Destroy, m.Name)
+		}
+	}
+	return mp
+}
+
+func (ctx *ClusterContext) planContainerGroup(description *dcluster.ContainerDescription) ContainerGroupPlan {
+	group := description.Group
+	cp := ContainerGroupPlan{
+		Group: group,
+		Image: description.Image,
+		Num:   description.Num,
+	}
+	containers := ctx.getContainerByGroup(group)
+	running := []dcontainer.ContainerInfo{}
+	for _, c := range containers {
+		if c.IsUp() {
+			running = append(running, c)
+			cp.Running = append(cp.Running, c.Name[0])
+		} else if ctx.rmc {
+			cp.Remove = append(cp.Remove, c.Name[0])
+		}
+	}
+
+	for _, c := range running {
+		if c.Image == description.Image {
+			if description.Restart {
+				cp.Restart = append(cp.Restart, c.Name[0])
+			} else {
+				cp.Unchanged = append(cp.Unchanged, c.Name[0])
+			}
+		} else {
+			cp.Replace = append(cp.Replace, c.Name[0])
+		}
+	}
+
+	if ctx.cScaleOut && description.Num > len(running) {
+		cp.ScaleOut = description.Num - len(running)
+	}
+	if ctx.cScaleIn && len(running) > description.Num {
+		for _, c := range running[:len(running)-description.Num] {
+			cp.ScaleIn = append(cp.ScaleIn, c.Name[0])
+		}
+	}
+	return cp
+}
+
+func (p *ClusterPlan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Plan of the cluster. master: %s\n", p.Master)
+	if p.MasterAction != "" {
+		fmt.Fprintf(w, "  master: %s\n", p.MasterAction)
+	}
+	printNames(w, "  consul servers to create", p.ConsulCreate)
+	printNames(w, "  consul servers to start", p.ConsulStart)
+
+	fmt.Fprintf(w, "\nMachines:\n")
+	for _, mp := range p.Machines {
+		fmt.Fprintf(w, "  %s (running:%d, min:%d, max:%d)\n", mp.Group, len(mp.Running), mp.MinNum, mp.MaxNum)
+		printNames(w, "    cordoned", mp.Cordoned)
+		if !mp.HasChanges() {
+			fmt.Fprintf(w, "    no changes\n")
+			continue
+		}
+		printNames(w, "    start", mp.Start)
+		if mp.Create > 0 {
+			fmt.Fprintf(w, "    create: %d\n", mp.Create)
+		}
+		printNames(w, "    destroy", mp.Destroy)
+	}
+
+	fmt.Fprintf(w, "\nContainers:\n")
+	if !p.ContainersLoaded {
+		fmt.Fprintf(w, "  master is not running, the existing containers are unknown.\n")
+	}
+	for _, cp := range p.Containers {
+		fmt.Fprintf(w, "  %s (running:%d, num:%d, image:%s)\n", cp.Group, len(cp.Running), cp.Num, cp.Image)
+		if !cp.HasChanges() {
+			fmt.Fprintf(w, "    no changes\n")
+			continue
+		}
+		printNames(w, "    restart", cp.Restart)
+		printNames(w, "    replace", cp.Replace)
+		if cp.ScaleOut > 0 {
+			fmt.Fprintf(w, "    scale out: %d\n", cp.ScaleOut)
+		}
+		printNames(w, "    scale in", cp.ScaleIn)
+		printNames(w, "    remove", cp.Remove)
+	}
+
+	if !p.HasChanges() {
+		fmt.Fprintf(w, "\nNo changes. The cluster is up to date.\n")
+	}
+}
+
+func printNames(w io.Writer, title string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s: %s\n", title, strings.Join(names, ", "))
+}
@@ -0,0 +1,213 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+func newTestContainer(group, name, image, status string) dcontainer.ContainerInfo {
+	return dcontainer.ContainerInfo{
+		ID:     name,
+		Image:  image,
+		Status: status,
+		Name:   []string{name},
+		Group:  group,
+	}
+}
+
+func TestPlanContainerGroup(t *testing.T) {
+	containers := []dcontainer.ContainerInfo{
+		newTestContainer("web", "web-1", "web:1", "Up 2 hours"),
+		newTestContainer("web", "web-2", "web:1", "Up 2 hours"),
+		newTestContainer("web", "web-3", "web:1", "Exited (0) 1 hour ago"),
+		newTestContainer("db", "db-1", "db:1", "Up 2 hours"),
+	}
+	tests := []struct {
+		name     string
+		image    string
+		num      int
+		restart  bool
+		scaleIn  bool
+		scaleOut bool
+		rmc      bool
+		changed  bool
+		expected ContainerGroupPlan
+	}{
+		{
+			name:     "unchanged",
+			image:    "web:1",
+			num:      2,
+			expected: ContainerGroupPlan{Unchanged: []string{"web-1", "web-2"}},
+		},
+		{
+			name:     "restart",
+			image:    "web:1",
+			num:      2,
+			restart:  true,
+			changed:  true,
+			expected: ContainerGroupPlan{Restart: []string{"web-1", "web-2"}},
+		},
+		{
+			name:     "replace",
+			image:    "web:2",
+			num:      2,
+			changed:  true,
+			expected: ContainerGroupPlan{Replace: []string{"web-1", "web-2"}},
+		},
+		{
+			name:     "scale out",
+			image:    "web:1",
+			num:      5,
+			scaleOut: true,
+			changed:  true,
+			expected: ContainerGroupPlan{Unchanged: []string{"web-1", "web-2"}, ScaleOut: 3},
+		},
+		{
+			name:     "scale out not allowed",
+			image:    "web:1",
+			num:      5,
+			expected: ContainerGroupPlan{Unchanged: []string{"web-1", "web-2"}},
+		},
+		{
+			name:     "scale in",
+			image:    "web:1",
+			num:      1,
+			scaleIn:  true,
+			changed:  true,
+			expected: ContainerGroupPlan{Unchanged: []string{"web-1", "web-2"}, ScaleIn: []string{"web-1"}},
+		},
+		{
+			name:     "remove stopped",
+			image:    "web:1",
+			num:      2,
+			rmc:      true,
+			changed:  true,
+			expected: ContainerGroupPlan{Unchanged: []string{"web-1", "web-2"}, Remove: []string{"web-3"}},
+		},
+	}
+	for _, test := range tests {
+		ctx := &ClusterContext{
+			cScaleIn:       test.scaleIn,
+			cScaleOut:      test.scaleOut,
+			rmc:            test.rmc,
+			containerInfos: containers,
+		}
+		cd := &dcluster.ContainerDescription{Group: "web", Image: test.image, Num: test.num, Restart: test.restart}
+		cp := ctx.planContainerGroup(cd)
+
+		expected := test.expected
+		expected.Group, expected.Image, expected.Num = "web", test.image, test.num
+		expected.Running = []string{"web-1", "web-2"}
+		if !reflect.DeepEqual(cp, expected) {
+			t.Errorf("%s: expected plan %+v, but got %+v", test.name, expected, cp)
+		}
+		if cp.HasChanges() != test.changed {
+			t.Errorf("%s: expected changes %v, but got %v", test.name, test.changed, cp.HasChanges())
+		}
+	}
+}
+
+func TestClusterPlanHasChanges(t *testing.T) {
+	tests := []struct {
+		plan     ClusterPlan
+		expected bool
+	}{
+		{ClusterPlan{}, false},
+		{ClusterPlan{MasterAction: PLAN_MASTER_START}, true},
+		{ClusterPlan{ConsulCreate: []string{"consul-1"}}, true},
+		{ClusterPlan{Machines: []MachineGroupPlan{{Group: "web", Running: []string{"web-1"}}}}, false},
+		{ClusterPlan{Machines: []MachineGroupPlan{{Group: "web", Create: 1}}}, true},
+		{ClusterPlan{Containers: []ContainerGroupPlan{{Group: "web", Unchanged: []string{"web-1"}}}}, false},
+		{ClusterPlan{Containers: []ContainerGroupPlan{{Group: "web", ScaleIn: []string{"web-1"}}}}, true},
+	}
+	for idx, test := range tests {
+		if changed := test.plan.HasChanges(); changed != test.expected {
+			t.Errorf("plan %d: expected changes %v, but got %v", idx, test.expected, changed)
+		}
+	}
+}
+
+func TestPlanMachines(t *testing.T) {
+	machines := []dmachine.MachineInfo{
+		newTestMachine("web", "web-1", "Running"),
+		newTestMachine("web", "web-2", "Running"),
+		newTestMachine("web", "web-3", "Running"),
+		newTestMachine("web", "web-4", "Stopped"),
+		newTestMachine("web", "web-5", "Stopped"),
+	}
+	containers := []dcontainer.ContainerInfo{
+		newPlacedContainer("nginx", "web-1"),
+		newPlacedContainer("redis", "web-1"),
+		newPlacedContainer("nginx", "web-3"),
+	}
+	tests := []struct {
+		name     string
+		min      int
+		max      int
+		cordoned []string
+		expected MachineGroupPlan
+	}{
+		{
+			name:     "unchanged",
+			min:      1,
+			max:      3,
+			expected: MachineGroupPlan{Running: []string{"web-1", "web-2", "web-3"}},
+		},
+		{
+			name:     "start",
+			min:      4,
+			max:      5,
+			expected: MachineGroupPlan{Running: []string{"web-1", "web-2", "web-3"}, Start: []string{"web-4"}},
+		},
+		{
+			name:     "create",
+			min:      6,
+			max:      6,
+			expected: MachineGroupPlan{Running: []string{"web-1", "web-2", "web-3"}, Start: []string{"web-4", "web-5"}, Create: 1},
+		},
+		{
+			name:     "uneven spread",
+			min:      1,
+			max:      1,
+			expected: MachineGroupPlan{Running: []string{"web-1", "web-2", "web-3"}, Destroy: []string{"web-2", "web-3"}},
+		},
+		{
+			name:     "cordoned not counted",
+			min:      3,
+			max:      3,
+			cordoned: []string{"web-2"},
+			expected: MachineGroupPlan{Running: []string{"web-1", "web-3"}, Cordoned: []string{"web-2"}, Start: []string{"web-4"}},
+		},
+		{
+			name:     "cordoned not destroyed",
+			min:      1,
+			max:      1,
+			cordoned: []string{"web-2", "web-4"},
+			expected: MachineGroupPlan{Running: []string{"web-1", "web-3"}, Cordoned: []string{"web-2", "web-4"}, Destroy: []string{"web-3"}},
+		},
+	}
+	for _, test := range tests {
+		ctx := &ClusterContext{
+			clusterDesc:    &dcluster.Cluster{Master: "master-1"},
+			mScaleIn:       true,
+			mScaleOut:      true,
+			containerInfos: containers,
+			cordons:        map[string]CordonInfo{},
+		}
+		for _, name := range test.cordoned {
+			ctx.cordons[name] = CordonInfo{Machine: name}
+		}
+		md := dcluster.MachineDescription{Group: "web", MinNum: test.min, MaxNum: test.max}
+		mp := ctx.planMachines(md, machines, "")
+
+		expected := test.expected
+		expected.Group, expected.MinNum, expected.MaxNum = "web", test.min, test.max
+		if !reflect.DeepEqual(mp, expected) {
+			t.Errorf("%s: expected plan %+v, but got %+v", test.name, expected, mp)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package context
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+)
+
+const (
+	REPORT_REGISTER   = "register"
+	REPORT_UNREGISTER = "unregister"
+
+	ERROR_SEPARATOR = "---"
+
+	GROUP_SUCCEEDED = "succeeded"
+	GROUP_FAILED    = "failed"
+	GROUP_SKIPPED   = "skipped"
+
+	EXIT_OK      = 0
+	EXIT_FAILED  = 1 // nothing is deployed
+	EXIT_PARTIAL = 2 // some groups are deployed, but some are failed or skipped
+)
+
+type ContainerEvent struct {
+	Group string `json:"group" yaml:"group"`
+	ID    string `json:"id" yaml:"id"`
+	Name  string `json:"name" yaml:"name"`
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+}
+
+type RegistrationEvent struct {
+	Action          string `json:"action" yaml:"action"`
+	Group           string `json:"group" yaml:"group"`
+	ServiceDiscover string `json:"service-discover" yaml:"service-discover"`
+	Container       string `json:"container,omitempty" yaml:"container,omitempty"`
+	Host            string `json:"host" yaml:"host"`
+	Port            int    `json:"port" yaml:"port"`
+	Error           string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type ContainerFailure struct {
+	Group     string `json:"group" yaml:"group"`
+	Container string `json:"container,omitempty" yaml:"container,omitempty"`
+	Error     string `json:"error" yaml:"error"`
+}
+
+type GroupResult struct {
+	Group  string   `json:"group" yaml:"group"`
+	Status string   `json:"status" yaml:"status"`
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// DeployReport records what a cluster context has changed on the cluster.
+type DeployReport struct {
+	lock          sync.Mutex
+	Groups        []string            `json:"groups" yaml:"groups"`
+	Started       []ContainerEvent    `json:"started" yaml:"started"`
+	Stopped       []ContainerEvent    `json:"stopped" yaml:"stopped"`
+	Removed       []ContainerEvent    `json:"removed" yaml:"removed"`
+	Registrations []RegistrationEvent `json:"registrations" yaml:"registrations"`
+	Results       []GroupResult       `json:"results" yaml:"results"`
+	Failures      []ContainerFailure  `json:"failures" yaml:"failures"`
+	Errors        []string            `json:"errors" yaml:"errors"`
+}
+
+func newContainerEvent(c *dcontainer.ContainerInfo) ContainerEvent {
+	return ContainerEvent{Group: c.Group, ID: c.ID, Name: c.Name[0], Image: c.Image}
+}
+
+func newRegistrationEvent(action string, cd *dcluster.ContainerDescription, sd string, container string, host string, port int, err error) RegistrationEvent {
+	e := RegistrationEvent{
+		Action:          action,
+		Group:           cd.Group,
+		ServiceDiscover: sd,
+		Container:       container,
+		Host:            host,
+		Port:            port,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// NewDeployReport is an empty report, where the errors of a command without a cluster context are reported too.
+func NewDeployReport() *DeployReport {
+	return &DeployReport{
+		Groups:        []string{},
+		Started:       []ContainerEvent{},
+		Stopped:       []ContainerEvent{},
+		Removed:       []ContainerEvent{},
+		Registrations: []RegistrationEvent{},
+		Results:       []GroupResult{},
+		Failures:      []ContainerFailure{},
+		Errors:        []string{},
+	}
+}
+
+func (r *DeployReport) addGroup(group string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, g := range r.Groups {
+		if g == group {
+			return
+		}
+	}
+	r.Groups = append(r.Groups, group)
+}
+
+func (r *DeployReport) addStarted(e ContainerEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Started = append(r.Started, e)
+}
+
+func (r *DeployReport) addStopped(e ContainerEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Stopped = append(r.Stopped, e)
+}
+
+func (r *DeployReport) addRemoved(e ContainerEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Removed = append(r.Removed, e)
+}
+
+func (r *DeployReport) addRegistration(e RegistrationEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Registrations = append(r.Registrations, e)
+}
+
+// a container operation failed. The name of the container is empty if it is never created.
+func (r *DeployReport) addFailure(group, container string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Failures = append(r.Failures, ContainerFailure{Group: group, Container: container, Error: err.Error()})
+}
+
+func (r *DeployReport) setGroupResult(group, status string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := GroupResult{Group: group, Status: status}
+	if err != nil {
+		result.Errors = strings.Split(err.Error(), ERROR_SEPARATOR)
+	}
+	for idx, gr := range r.Results {
+		if gr.Group == group {
+			r.Results[idx] = result
+			return
+		}
+	}
+	r.Results = append(r.Results, result)
+}
+
+func (r *DeployReport) getGroupStatus(group string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, gr := range r.Results {
+		if gr.Group == group {
+			return gr.Status
+		}
+	}
+	return ""
+}
+
+// ExitCode is EXIT_OK if everything succeeded, EXIT_PARTIAL if some groups succeeded, or EXIT_FAILED.
+func (r *DeployReport) ExitCode() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	succeeded, failed := 0, 0
+	for _, gr := range r.Results {
+		if gr.Status == GROUP_SUCCEEDED {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	if failed == 0 && len(r.Failures) == 0 && len(r.Errors) == 0 {
+		return EXIT_OK
+	}
+	if succeeded > 0 {
+		return EXIT_PARTIAL
+	}
+	return EXIT_FAILED
+}
+
+// HasChanges tells if anything is started, stopped, removed or registered, or anything failed.
+func (r *DeployReport) HasChanges() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.Started)+len(r.Stopped)+len(r.Removed)+len(r.Registrations)+len(r.Failures)+len(r.Errors) > 0
+}
+
+func (r *DeployReport) AddError(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Errors = append(r.Errors, err.Error())
+}
+
+func (r *DeployReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Groups deployed: %d, containers started: %d, stopped: %d, removed: %d, registrations: %d, failures: %d, errors: %d\n",
+		len(r.Groups), len(r.Started), len(r.Stopped), len(r.Removed), len(r.Registrations), len(r.Failures), len(r.Errors))
+	if len(r.Results) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "GROUP\tSTATUS\tERRORS\t")
+		for _, gr := range r.Results {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t\n", gr.Group, gr.Status, len(gr.Errors))
+		}
+		tw.Flush()
+	}
+	for _, f := range r.Failures {
+		fmt.Fprintf(w, "  failed: group:%s, container:%s, error:%s\n", f.Group, f.Container, f.Error)
+	}
+	for _, e := range r.Errors {
+		fmt.Fprintf(w, "  error: %s\n", e)
+	}
+}
+
+func (ctx *ClusterContext) Report() *DeployReport {
+	return ctx.report
+}
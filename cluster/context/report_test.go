@@ -0,0 +1,83 @@
+package context
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  map[string]string
+		failures int
+		errors   int
+		expected int
+	}{
+		{"nothing deployed", nil, 0, 0, EXIT_OK},
+		{"all succeeded", map[string]string{"nginx": GROUP_SUCCEEDED, "redis": GROUP_SUCCEEDED}, 0, 0, EXIT_OK},
+		{"one failed", map[string]string{"nginx": GROUP_SUCCEEDED, "redis": GROUP_FAILED}, 0, 0, EXIT_PARTIAL},
+		{"one skipped", map[string]string{"nginx": GROUP_SUCCEEDED, "redis": GROUP_SKIPPED}, 0, 0, EXIT_PARTIAL},
+		{"all failed", map[string]string{"nginx": GROUP_FAILED, "redis": GROUP_SKIPPED}, 0, 0, EXIT_FAILED},
+		{"container failed", map[string]string{"nginx": GROUP_SUCCEEDED}, 1, 0, EXIT_PARTIAL},
+		{"errors only", nil, 0, 1, EXIT_FAILED},
+		{"errors after deployed", map[string]string{"nginx": GROUP_SUCCEEDED}, 0, 1, EXIT_PARTIAL},
+	}
+	for _, test := range tests {
+		r := NewDeployReport()
+		for group, status := range test.results {
+			r.setGroupResult(group, status, nil)
+		}
+		for i := 0; i < test.failures; i++ {
+			r.addFailure("nginx", "nginx-1", errors.New("Failed to start."))
+		}
+		for i := 0; i < test.errors; i++ {
+			r.AddError(errors.New("Failed to load containers."))
+		}
+		if code := r.ExitCode(); code != test.expected {
+			t.Errorf("%s: expected exit code %d, but got %d", test.name, test.expected, code)
+		}
+	}
+}
+
+func TestSetGroupResult(t *testing.T) {
+	r := NewDeployReport()
+	r.setGroupResult("nginx", GROUP_FAILED, errors.New("first"+ERROR_SEPARATOR+"second"))
+	r.setGroupResult("redis", GROUP_SUCCEEDED, nil)
+	if !reflect.DeepEqual(r.Results[0].Errors, []string{"first", "second"}) {
+		t.Errorf("The collected errors are expected to be split, but got %v", r.Results[0].Errors)
+	}
+	r.setGroupResult("nginx", GROUP_SUCCEEDED, nil)
+	if len(r.Results) != 2 || r.getGroupStatus("nginx") != GROUP_SUCCEEDED || r.Results[0].Errors != nil {
+		t.Errorf("The result of group nginx is expected to be replaced, but got %+v", r.Results)
+	}
+	if status := r.getGroupStatus("mysql"); status != "" {
+		t.Errorf("The group not deployed is expected to have no status, but got '%s'", status)
+	}
+}
+
+func TestGetFailedDep(t *testing.T) {
+	ctx := &ClusterContext{report: NewDeployReport()}
+	ctx.report.setGroupResult("redis", GROUP_SUCCEEDED, nil)
+	ctx.report.setGroupResult("mysql", GROUP_FAILED, errors.New("failed"))
+	ctx.report.setGroupResult("memcache", GROUP_SKIPPED, errors.New("skipped"))
+	tests := []struct {
+		deps     []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"redis"}, ""},
+		{[]string{"redis", "mysql"}, "mysql"},
+		{[]string{"memcache", "mysql"}, "memcache"},
+		{[]string{"mq"}, ""},
+	}
+	for _, test := range tests {
+		description := &dcluster.ContainerDescription{Group: "nginx", Deps: test.deps}
+		dep, failed := ctx.getFailedDep(description)
+		if dep != test.expected || failed != (test.expected != "") {
+			t.Errorf("deps %v: expected the failed dep '%s', but got '%s', %v", test.deps, test.expected, dep, failed)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	consul "github.com/hashicorp/consul/api"
+	dcluster "github.com/weibocom/dockerf/cluster"
+	"github.com/weibocom/dockerf/dlog"
+)
+
+// Revision is the image, env and ports of a group deployed at a time. The other fields of the container
+// description, such as the command, the limits and the volumes, are not recorded, and a rollback keeps the current ones.
+// The secrets in the env are recorded in the encrypted syntax, never the decrypted values.
+type Revision struct {
+	Number  int                        `json:"number" yaml:"number"`
+	Group   string                     `json:"group" yaml:"group"`
+	Image   string                     `json:"image" yaml:"image"`
+	Env     []string                   `json:"env" yaml:"env"`
+	Port    string                     `json:"port" yaml:"port"`
+	Ports   []dcluster.PortDescription `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Profile string                     `json:"profile" yaml:"profile"`
+	Time    time.Time                  `json:"time" yaml:"time"`
+}
+
+func newRevision(description *dcluster.ContainerDescription, profile string) Revision {
+	return Revision{
+		Group:   description.Group,
+		Image:   description.Image,
+		Env:     encryptSecrets(description.Env),
+		Port:    description.Port,
+		Ports:   description.Ports,
+		Profile: profile,
+		Time:    time.Now(),
+	}
+}
+
+func encryptSecrets(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	encrypted := []string{}
+	for _, e := range env {
+		encrypted = append(encrypted, dcluster.EncryptSecrets(e))
+	}
+	return encrypted
+}
+
+func decryptSecrets(env []string) ([]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+	decrypted := []string{}
+	for _, e := range env {
+		d, err := dcluster.DecryptSecrets(e)
+		if err != nil {
+			return nil, err
+		}
+		decrypted = append(decrypted, d)
+	}
+	return decrypted, nil
+}
+
+func (r *Revision) sameDescription(o *Revision) bool {
+	return r.Image == o.Image && r.Port == o.Port && reflect.DeepEqual(r.Ports, o.Ports) && reflect.DeepEqual(r.Env, o.Env)
+}
+
+// apply the recorded image, env and ports to the description, with the secrets in the env decrypted.
+func (r *Revision) apply(description *dcluster.ContainerDescription) error {
+	env, err := decryptSecrets(r.Env)
+	if err != nil {
+		return fmt.Errorf("Failed to decrypt the env of revision %d: %s", r.Number, err.Error())
+	}
+	applied := *description
+	applied.Image = r.Image
+	applied.Env = env
+	applied.Port = r.Port
+	applied.Ports = r.Ports
+	if err := applied.ParsePorts(); err != nil {
+		return err
+	}
+	*description = applied
+	return nil
+}
+
+type RevisionHistory struct {
+	Group     string     `json:"group" yaml:"group"`
+	Revisions []Revision `json:"revisions" yaml:"revisions"`
+}
+
+func (h *RevisionHistory) Print(w io.Writer) {
+	if len(h.Revisions) == 0 {
+		fmt.Fprintf(w, "No revision recorded for group '%s'.\n", h.Group)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REVISION\tTIME\tPROFILE\tPORT\tIMAGE\t")
+	for _, r := range h.Revisions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t\n", r.Number, r.Time.Format(time.RFC3339), r.Profile, r.Port, r.Image)
+	}
+	tw.Flush()
+}
+
+// the revisions are stored in the consul kv of the cluster as 'dockerf/MASTER/revisions/GROUP/NUMBER'.
+type revisionStore struct {
+	kv     *consul.KV
+	prefix string
+}
+
+func (ctx *ClusterContext) getRevisionStore() (*revisionStore, error) {
+	client, err := ctx.newConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	return &revisionStore{
+		kv:     client.KV(),
+		prefix: ctx.kvKey("revisions"),
+	}, nil
+}
+
+func (rs *revisionStore) groupPrefix(group string) string {
+	return rs.prefix + KV_SEPARATOR + group + KV_SEPARATOR
+}
+
+// the revisions of the group. The keys are listed in order, so are the numbers.
+func (rs *revisionStore) list(group string) ([]Revision, error) {
+	pairs, _, err := rs.kv.List(rs.groupPrefix(group), nil)
+	if err != nil {
+		return nil, err
+	}
+	revisions := []Revision{}
+	for _, pair := range pairs {
+		r := Revision{}
+		if err := json.Unmarshal(pair.Value, &r); err != nil {
+			log.Warnf("Ignore an invalid revision. key:%s, err:%s", pair.Key, err.Error())
+			continue
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, nil
+}
+
+// save the revision as the next number of the group. The numbers are padded, so the keys are listed in order.
+func (rs *revisionStore) save(r *Revision, last int) error {
+	r.Number = last + 1
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := rs.groupPrefix(r.Group) + fmt.Sprintf("%010d", r.Number)
+	// ModifyIndex 0 means the key is written only if it does not exist.
+	ok, _, err := rs.kv.CAS(&consul.KVPair{Key: key, Value: value, ModifyIndex: 0}, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("Revision %d of group '%s' is saved by someone else.", r.Number, r.Group)
+	}
+	return nil
+}
+
+// record a new revision of the group if its image, env or ports are changed since the last one.
+func (ctx *ClusterContext) recordRevision(description *dcluster.ContainerDescription) error {
+	rs, err := ctx.getRevisionStore()
+	if err != nil {
+		return err
+	}
+	revisions, err := rs.list(description.Group)
+	if err != nil {
+		return err
+	}
+	r := newRevision(description, ctx.clusterDesc.ActiveProfile)
+	last := 0
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		if latest.sameDescription(&r) {
+			log.Debugf("The description of group '%s' is not changed since revision %d.", description.Group, latest.Number)
+			return nil
+		}
+		last = latest.Number
+	}
+	if err := rs.save(&r, last); err != nil {
+		return err
+	}
+	log.Infof("Revision %d of group '%s' recorded. image:%s", r.Number, r.Group, r.Image)
+	return nil
+}
+
+func (ctx *ClusterContext) History(group string) (*RevisionHistory, error) {
+	rs, err := ctx.getRevisionStore()
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := rs.list(group)
+	if err != nil {
+		return nil, err
+	}
+	return &RevisionHistory{Group: group, Revisions: revisions}, nil
+}
+
+// Rollback redeploys the group with the description recorded by the revision through the rolling deploy,
+// the one before the latest revision if the revision number is not positive.
+func (ctx *ClusterContext) Rollback(group string, number int) error {
+	description, ok := ctx.clusterDesc.Container.Topology.GetDescription(group)
+	if !ok {
+		return fmt.Errorf("No container description found for group '%s'", group)
+	}
+	history, err := ctx.History(group)
+	if err != nil {
+		return err
+	}
+	revisions := history.Revisions
+	var target *Revision
+	if number > 0 {
+		for idx := range revisions {
+			if revisions[idx].Number == number {
+				target = &revisions[idx]
+				break
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("Revision %d of group '%s' not found.", number, group)
+		}
+	} else {
+		if len(revisions) < 2 {
+			return fmt.Errorf("No previous revision of group '%s' to roll back to.", group)
+		}
+		target = &revisions[len(revisions)-2]
+	}
+
+	if ctx.cProxy == nil {
+		return fmt.Errorf("Master '%s' is not running, group '%s' can not be rolled back.", ctx.clusterDesc.Master, group)
+	}
+	// the containers replaced are unregistered from, and the new ones registered with the running service discovery.
+	if err := ctx.ensureServiceRegistries(); err != nil {
+		return err
+	}
+
+	dlog.Printf("Roll back group '%s' to revision %d. image:%s\n", group, target.Number, target.Image)
+	if err := target.apply(description); err != nil {
+		return err
+	}
+	if err := ctx.deployContainersByDescription(description); err != nil {
+		return err
+	}
+	if err := ctx.loadContainers(); err != nil {
+		return errors.New("Failed to load containers:" + err.Error())
+	}
+	dlog.Printf("Group '%s' rolled back to revision %d successfully.\n", group, target.Number)
+	return nil
+}
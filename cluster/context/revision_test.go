@@ -0,0 +1,56 @@
+package context
+
+import (
+	"encoding/base64"
+	"os"
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func TestRevisionSecrets(t *testing.T) {
+	key, err := dcluster.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate the secret key: %s", err.Error())
+	}
+	os.Setenv(dcluster.SECRET_KEY_ENV, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(dcluster.SECRET_KEY_ENV)
+	encrypted, err := key.Encrypt("redis-password")
+	if err != nil {
+		t.Fatalf("Failed to encrypt the secret: %s", err.Error())
+	}
+	// the secret is decrypted as the cluster files are loaded.
+	password, err := dcluster.DecryptSecrets(encrypted)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the secret: %s", err.Error())
+	}
+
+	tests := []struct {
+		env      []string
+		recorded []string
+	}{
+		{nil, nil},
+		{[]string{"NAME=usertag"}, []string{"NAME=usertag"}},
+		{[]string{"NAME=usertag", "PASS=" + password}, []string{"NAME=usertag", "PASS=" + encrypted}},
+	}
+	for _, test := range tests {
+		description := &dcluster.ContainerDescription{Group: "web", Image: "web:1", Port: "80:80", Env: test.env}
+		r := newRevision(description, "test")
+		if !reflect.DeepEqual(r.Env, test.recorded) {
+			t.Errorf("env %v is expected to be recorded as %v, but got %v", test.env, test.recorded, r.Env)
+		}
+		if again := newRevision(description, "test"); !r.sameDescription(&again) {
+			t.Errorf("env %v is recorded as another revision", test.env)
+		}
+
+		applied := &dcluster.ContainerDescription{Group: "web", Image: "web:2", Env: []string{"NAME=changed"}}
+		if err := r.apply(applied); err != nil {
+			t.Errorf("Failed to apply the revision of env %v: %s", test.env, err.Error())
+			continue
+		}
+		if applied.Image != "web:1" || !reflect.DeepEqual(applied.Env, test.env) {
+			t.Errorf("Expected image web:1 and env %v applied, but got image %s and env %v", test.env, applied.Image, applied.Env)
+		}
+	}
+}
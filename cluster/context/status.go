@@ -0,0 +1,143 @@
+package context
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+type MachineGroupStatus struct {
+	Group   string   `json:"group" yaml:"group"`
+	MinNum  int      `json:"min-num" yaml:"min-num"`
+	MaxNum  int      `json:"max-num" yaml:"max-num"`
+	Running []string `json:"running" yaml:"running"`
+	Stopped []string `json:"stopped" yaml:"stopped"`
+	Errored []string `json:"errored" yaml:"errored"`
+	// the running or stopped machines taken out of the scheduling.
+	Cordoned []string `json:"cordoned" yaml:"cordoned"`
+}
+
+type ContainerGroupStatus struct {
+	Group    string   `json:"group" yaml:"group"`
+	Num      int      `json:"num" yaml:"num"`
+	Image    string   `json:"image" yaml:"image"`
+	Running  []string `json:"running" yaml:"running"`
+	Stopped  []string `json:"stopped" yaml:"stopped"`
+	Outdated []string `json:"outdated" yaml:"outdated"`
+}
+
+// ClusterStatus is the desired state in cluster.yml against the actual state of every group.
+type ClusterStatus struct {
+	Master      string `json:"master" yaml:"master"`
+	MasterState string `json:"master-state" yaml:"master-state"`
+	// false when the master is not running, so the containers can not be listed.
+	ContainersLoaded bool                   `json:"containers-loaded" yaml:"containers-loaded"`
+	Machines         []MachineGroupStatus   `json:"machines" yaml:"machines"`
+	Containers       []ContainerGroupStatus `json:"containers" yaml:"containers"`
+}
+
+func isMachineStopped(mi *dmachine.MachineInfo) bool {
+	switch strings.ToUpper(mi.State) {
+	case "STOPPED", "PAUSED", "SAVED", "STOPPING":
+		return true
+	default:
+		return false
+	}
+}
+
+func (ctx *ClusterContext) Status() (*ClusterStatus, error) {
+	machines, err := ctx.mProxy.Proxy.List(func(mi *dmachine.MachineInfo) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ctx.newClusterStatus(machines), nil
+}
+
+// the status of the groups, with the machines of all the groups listed.
+func (ctx *ClusterContext) newClusterStatus(machines []dmachine.MachineInfo) *ClusterStatus {
+	status := &ClusterStatus{
+		Master:           ctx.clusterDesc.Master,
+		MasterState:      "None",
+		ContainersLoaded: ctx.cProxy != nil,
+	}
+	if master, exists := ctx.getMaster(); exists {
+		status.MasterState = master.State
+	}
+
+	for _, md := range ctx.clusterDesc.Machine.Topology {
+		ms := MachineGroupStatus{
+			Group:  md.Group,
+			MinNum: md.MinNum,
+			MaxNum: md.MaxNum,
+		}
+		for _, m := range machines {
+			if m.Group != md.Group {
+				continue
+			}
+			if ctx.isCordoned(m.Name) {
+				ms.Cordoned = append(ms.Cordoned, m.Name)
+			}
+			if m.IsRunning() {
+				ms.Running = append(ms.Running, m.Name)
+			} else if isMachineStopped(&m) {
+				ms.Stopped = append(ms.Stopped, m.Name)
+			} else {
+				ms.Errored = append(ms.Errored, m.Name)
+			}
+		}
+		status.Machines = append(status.Machines, ms)
+	}
+
+	for _, description := range ctx.clusterDesc.Container.Topology {
+		cs := ContainerGroupStatus{
+			Group: description.Group,
+			Num:   description.Num,
+			Image: description.Image,
+		}
+		for _, c := range ctx.getContainerByGroup(description.Group) {
+			if !c.IsUp() {
+				cs.Stopped = append(cs.Stopped, c.Name[0])
+				continue
+			}
+			cs.Running = append(cs.Running, c.Name[0])
+			if c.Image != description.Image {
+				cs.Outdated = append(cs.Outdated, c.Name[0])
+			}
+		}
+		status.Containers = append(status.Containers, cs)
+	}
+	return status
+}
+
+func (s *ClusterStatus) Print(w io.Writer) {
+	fmt.Fprintf(w, "Cluster master: %s (%s)\n\n", s.Master, s.MasterState)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MACHINE GROUP\tMIN\tMAX\tRUNNING\tSTOPPED\tERROR\tCORDONED\t")
+	cordoned := []string{}
+	for _, ms := range s.Machines {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n", ms.Group, ms.MinNum, ms.MaxNum, len(ms.Running), len(ms.Stopped), len(ms.Errored), len(ms.Cordoned))
+		cordoned = append(cordoned, ms.Cordoned...)
+	}
+	tw.Flush()
+	if len(cordoned) > 0 {
+		fmt.Fprintf(w, "Cordoned machines: %s\n", strings.Join(cordoned, ", "))
+	}
+	fmt.Fprintln(w)
+
+	if !s.ContainersLoaded {
+		fmt.Fprintf(w, "Master is not running, the containers are unknown.\n")
+		return
+	}
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER GROUP\tNUM\tRUNNING\tSTOPPED\tOUTDATED\tIMAGE\t")
+	for _, cs := range s.Containers {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t\n", cs.Group, cs.Num, len(cs.Running), len(cs.Stopped), len(cs.Outdated), cs.Image)
+	}
+	tw.Flush()
+}
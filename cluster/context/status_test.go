@@ -0,0 +1,78 @@
+package context
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	dmachine "github.com/weibocom/dockerf/machine"
+)
+
+func TestNewClusterStatus(t *testing.T) {
+	master := dmachine.MachineInfo{Name: "test-master", Master: "test-master", Group: "master", State: "Running"}
+	machines := []dmachine.MachineInfo{
+		master,
+		newTestMachine("web", "web-1", "Running"),
+		newTestMachine("web", "web-2", "Stopped"),
+		newTestMachine("web", "web-3", "Error"),
+		newTestMachine("web", "web-4", "Running"),
+		newTestMachine("redis", "redis-1", "Paused"),
+	}
+	ctx := &ClusterContext{
+		clusterDesc: &dcluster.Cluster{
+			Master: "test-master",
+			Machine: dcluster.MachineCluster{
+				Topology: dcluster.MachineTopology{
+					{Group: "web", MinNum: 2, MaxNum: 4},
+					{Group: "redis", MinNum: 1, MaxNum: 1},
+				},
+			},
+			Container: dcluster.ContainerCluster{
+				Topology: dcluster.ContainerTopology{
+					{Group: "nginx", Num: 3, Image: "nginx:2"},
+					{Group: "mysql", Num: 1, Image: "mysql:5"},
+				},
+			},
+		},
+		machineInfos: []dmachine.MachineInfo{master},
+		containerInfos: []dcontainer.ContainerInfo{
+			newTestContainer("nginx", "nginx-1", "nginx:2", "Up 2 hours"),
+			newTestContainer("nginx", "nginx-2", "nginx:1", "Up 2 hours"),
+			newTestContainer("nginx", "nginx-3", "nginx:1", "Exited (1) 2 hours ago"),
+			newTestContainer("web", "web-1", "web:1", "Up 2 hours"),
+		},
+		cProxy:  &dcontainer.DockerProxy{},
+		cordons: map[string]CordonInfo{"web-4": {Machine: "web-4"}},
+	}
+	status := ctx.newClusterStatus(machines)
+
+	if status.MasterState != "Running" || !status.ContainersLoaded {
+		t.Errorf("The master is expected to be running with the containers loaded, but got %+v", status)
+	}
+	expectedMachines := []MachineGroupStatus{
+		{Group: "web", MinNum: 2, MaxNum: 4, Running: []string{"web-1", "web-4"}, Stopped: []string{"web-2"}, Errored: []string{"web-3"}, Cordoned: []string{"web-4"}},
+		{Group: "redis", MinNum: 1, MaxNum: 1, Stopped: []string{"redis-1"}},
+	}
+	if !reflect.DeepEqual(status.Machines, expectedMachines) {
+		t.Errorf("The machine groups are expected to be %+v, but got %+v", expectedMachines, status.Machines)
+	}
+	expectedContainers := []ContainerGroupStatus{
+		{Group: "nginx", Num: 3, Image: "nginx:2", Running: []string{"nginx-1", "nginx-2"}, Stopped: []string{"nginx-3"}, Outdated: []string{"nginx-2"}},
+		{Group: "mysql", Num: 1, Image: "mysql:5"},
+	}
+	if !reflect.DeepEqual(status.Containers, expectedContainers) {
+		t.Errorf("The container groups are expected to be %+v, but got %+v", expectedContainers, status.Containers)
+	}
+
+	ctx.cProxy = nil
+	ctx.machineInfos = nil
+	status = ctx.newClusterStatus(machines)
+	buf := &bytes.Buffer{}
+	status.Print(buf)
+	if status.MasterState != "None" || !strings.Contains(buf.String(), "the containers are unknown") || !strings.Contains(buf.String(), "Cordoned machines: web-4") {
+		t.Errorf("The status without the master is expected to tell the containers are unknown, but got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,232 @@
+package context
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+const (
+	WATCH_INTERVAL    = 30 * time.Second
+	WATCH_MAX_BACKOFF = 10 * time.Minute
+)
+
+// a service registered by the watch, which is unregistered once its container is gone.
+type registration struct {
+	sd          string
+	host        string
+	port        int
+	description *dcluster.ContainerDescription
+}
+
+func (r *registration) key() string {
+	return fmt.Sprintf("%s/%s:%d", r.sd, r.host, r.port)
+}
+
+// Watch keeps the cluster as described, round by round: the machines of every group are started or created up to
+// the minnum, the containers of every group are run up to the num, and the services of the running containers are
+// registered again. The running containers are never replaced or stopped, which is done by deploy. A round is
+// skipped while someone else holds the deploy lock, and the next round is delayed twice as long after a failed one,
+// up to maxBackoff. The report of every round is passed to done. Watch returns only once interrupted in a round.
+func (ctx *ClusterContext) Watch(interval, maxBackoff time.Duration, done func(report *DeployReport)) {
+	registered := map[string]registration{}
+	wait := interval
+	for round := 1; ; round++ {
+		log.Infof("Watch round %d started.", round)
+		ctx.report = NewDeployReport()
+		err := protect(func() error {
+			current, err := ctx.reconcile(registered)
+			if current != nil {
+				registered = current
+			}
+			return err
+		})
+		wait = nextWait(wait, interval, maxBackoff, err != nil)
+		if err != nil {
+			ctx.report.AddError(err)
+			log.Errorf("Watch round %d failed, the next round starts in %s. err:%s", round, wait, err.Error())
+		} else {
+			log.Infof("Watch round %d completed, the next round starts in %s.", round, wait)
+		}
+		done(ctx.report)
+		if ctx.isInterrupted() {
+			log.Warnf("Watch stopped in round %d, as it is interrupted.", round)
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// the wait before the next round, which is doubled after a failed round up to maxBackoff, or back to the interval.
+func nextWait(wait, interval, maxBackoff time.Duration, failed bool) time.Duration {
+	if !failed {
+		return interval
+	}
+	wait *= 2
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// one round of the watch, under the deploy lock. It returns the services registered, which is nil if the round
+// is skipped or failed before the services are registered.
+func (ctx *ClusterContext) reconcile(registered map[string]registration) (map[string]registration, error) {
+	status, err := ctx.LockStatus()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check the cluster lock: %s", err.Error())
+	}
+	if status.Locked {
+		log.Infof("The cluster is locked by %s@%s, command: '%s'. The round is skipped.", status.Holder.Owner, status.Holder.Host, status.Holder.Command)
+		return nil, nil
+	}
+	if err := ctx.acquireLock(); err != nil {
+		return nil, err
+	}
+	defer ctx.Close()
+
+	if err := ctx.reloadMachineInfos(); err != nil {
+		return nil, fmt.Errorf("Failed to list the machines: %s", err.Error())
+	}
+	ctx.initMachineSequence(ctx.machineInfos)
+	// the containers are counted again for the placement, and the machines cordoned since the last round are excluded.
+	ctx.placements = newPlacements()
+	if err := ctx.loadCordons(); err != nil {
+		return nil, fmt.Errorf("Failed to load the cordoned machines: %s", err.Error())
+	}
+	if err := ctx.startMaster(); err != nil {
+		return nil, fmt.Errorf("Start cluster master failed: %s", err.Error())
+	}
+	if ctx.cProxy == nil {
+		if err := ctx.initContainerProxy(); err != nil {
+			return nil, err
+		}
+	}
+
+	ec := &errorCollector{}
+	// the containers are still run on the machines running, even if some machines can not be started or created.
+	if err := ctx.scaleMachineOut(); err != nil {
+		ec.add(err)
+	}
+	if err := ctx.reloadMachineInfos(); err != nil {
+		return nil, fmt.Errorf("Failed to list the machines: %s", err.Error())
+	}
+	ctx.initMachineSequence(ctx.machineInfos)
+
+	if err := ctx.loadContainers(); err != nil {
+		return nil, fmt.Errorf("Failed to load containers: %s", err.Error())
+	}
+	if err := ctx.initContainerSequences(); err != nil {
+		return nil, fmt.Errorf("Failed to init container seqs: %s", err.Error())
+	}
+	for _, description := range ctx.getSortedSDDescriptionByType() {
+		if err := ctx.reconcileGroup(&description); err != nil {
+			ec.add(fmt.Errorf("Failed to run the containers of service discovery group '%s'. err:%s", description.Group, err.Error()))
+		}
+	}
+	// the service discovery containers may be moved, so the registries are loaded in every round.
+	if err := ctx.loadServiceRegistries(); err != nil {
+		ec.add(err)
+		return nil, ec.err()
+	}
+	for _, description := range ctx.getSortedBizDescriptionByType() {
+		if err := ctx.checkLock(); err != nil {
+			ctx.report.setGroupResult(description.Group, GROUP_SKIPPED, err)
+			continue
+		}
+		if dep, failed := ctx.getFailedDep(&description); failed {
+			ctx.report.setGroupResult(description.Group, GROUP_SKIPPED, fmt.Errorf("Group '%s' skipped, as the group '%s' it depends on is not running.", description.Group, dep))
+			continue
+		}
+		if err := ctx.reconcileGroup(&description); err != nil {
+			ec.add(fmt.Errorf("Failed to run the containers of group '%s'. err:%s", description.Group, err.Error()))
+		}
+	}
+
+	if err := ctx.checkLock(); err != nil {
+		ec.add(err)
+		return nil, ec.err()
+	}
+
+	if err := ctx.loadContainers(); err != nil {
+		ec.add(fmt.Errorf("Failed to load containers: %s", err.Error()))
+		return nil, ec.err()
+	}
+	current, err := ctx.reconcileRegistrations(registered)
+	if err != nil {
+		ec.add(err)
+	}
+	return current, ec.err()
+}
+
+// run the containers of the group up to its num, and record the result in the report.
+func (ctx *ClusterContext) reconcileGroup(description *dcluster.ContainerDescription) error {
+	ctx.report.addGroup(description.Group)
+	err := ctx.scaleOutContainersByDescription(description)
+	if ctx.rmc && err == nil {
+		err = ctx.removeStoppedContainerByGroup(description.Group)
+	}
+	if err != nil {
+		ctx.report.setGroupResult(description.Group, GROUP_FAILED, err)
+	} else {
+		ctx.report.setGroupResult(description.Group, GROUP_SUCCEEDED, nil)
+	}
+	return err
+}
+
+// register the services of all the running containers again, as the service discovery may lose them when it is
+// restarted, and unregister the ones registered in the last round whose containers are gone. The drivers can not
+// list what is registered, so the services left by the containers gone before the watch started are kept.
+func (ctx *ClusterContext) reconcileRegistrations(registered map[string]registration) (map[string]registration, error) {
+	current := map[string]registration{}
+	ec := &errorCollector{}
+	for _, c := range ctx.containerInfos {
+		if !c.IsUp() {
+			continue
+		}
+		cd, exists := ctx.clusterDesc.Container.Topology.GetDescription(c.Group)
+		if !exists {
+			continue
+		}
+		for _, binding := range cd.PortBindings {
+			if binding.ServiceDiscover == "" {
+				continue
+			}
+			host, port, find := getPublicPort(&c, binding.ContainerPort)
+			if !find {
+				log.Warnf("Container does not expose port %d as a service. name:%s", binding.ContainerPort, c.Name[0])
+				continue
+			}
+			r := registration{sd: binding.ServiceDiscover, host: host, port: port, description: cd}
+			driver, ok := ctx.serviceRegistries[r.sd]
+			if !ok {
+				ec.add(fmt.Errorf("No service register driver available for '%s'", r.sd))
+				continue
+			}
+			err := (*driver).Register(host, port)
+			_, known := registered[r.key()]
+			if err != nil || !known {
+				// the services registered in the last round are not reported again.
+				ctx.report.addRegistration(newRegistrationEvent(REPORT_REGISTER, cd, r.sd, c.Name[0], host, port, err))
+			}
+			if err != nil {
+				ec.add(fmt.Errorf("Failed to register container '%s' with '%s': %s", c.Name[0], r.sd, err.Error()))
+				continue
+			}
+			current[r.key()] = r
+		}
+	}
+	for key, r := range registered {
+		if _, exists := current[key]; exists {
+			continue
+		}
+		if err := ctx.unregisterService(r.host, r.port, r.sd, r.description); err != nil {
+			// unregistered again in the next round.
+			current[key] = r
+			ec.add(fmt.Errorf("Failed to unregister %s:%d from '%s': %s", r.host, r.port, r.sd, err.Error()))
+		}
+	}
+	return current, ec.err()
+}
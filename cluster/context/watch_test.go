@@ -0,0 +1,165 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/discovery"
+)
+
+func TestNextWait(t *testing.T) {
+	interval, maxBackoff := 30*time.Second, 2*time.Minute
+	tests := []struct {
+		wait     time.Duration
+		failed   bool
+		expected time.Duration
+	}{
+		{interval, false, interval},
+		{interval, true, time.Minute},
+		{time.Minute, true, 2 * time.Minute},
+		{90 * time.Second, true, maxBackoff},
+		{maxBackoff, true, maxBackoff},
+		{maxBackoff, false, interval},
+	}
+	for _, test := range tests {
+		if wait := nextWait(test.wait, interval, maxBackoff, test.failed); wait != test.expected {
+			t.Errorf("wait %s, failed %v: expected the next wait %s, but got %s", test.wait, test.failed, test.expected, wait)
+		}
+	}
+}
+
+func newWatchedContainer(name, status string, publicPort int) dcontainer.ContainerInfo {
+	c := newTestContainer("web", name, "web:1", status)
+	c.IpPorts = []dcontainer.IPPort{{IP: "10.0.0.1", PublicPort: publicPort, PrivatePort: 8080}}
+	return c
+}
+
+func registrationKeys(registered map[string]registration) []string {
+	keys := []string{}
+	for key := range registered {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestReconcileRegistrations(t *testing.T) {
+	web := dcluster.ContainerDescription{Group: "web", PortBindings: []dcluster.PortBinding{{ContainerPort: 8080, ServiceDiscover: "nginx"}}}
+	nginx := newFakeRegistry()
+	ctx := &ClusterContext{
+		clusterDesc: &dcluster.Cluster{
+			Container: dcluster.ContainerCluster{Topology: dcluster.ContainerTopology{web}},
+		},
+		serviceRegistries: map[string]*discovery.ServiceRegisterDriver{"nginx": nginx},
+	}
+	rounds := []struct {
+		name       string
+		containers []dcontainer.ContainerInfo
+		failed     bool // the registry fails
+		registered []string
+		addresses  []string
+		reported   []string // the registrations reported, as 'ACTION PORT'
+		valid      bool
+	}{
+		{
+			name: "first round",
+			containers: []dcontainer.ContainerInfo{
+				newWatchedContainer("web-1", "Up 2 hours", 8001),
+				newWatchedContainer("web-2", "Up 2 hours", 8002),
+				newWatchedContainer("web-3", "Exited (0) 2 hours ago", 8003),
+				newTestContainer("mysql", "mysql-1", "mysql:5", "Up 2 hours"),
+			},
+			registered: []string{"nginx/10.0.0.1:8001", "nginx/10.0.0.1:8002"},
+			addresses:  []string{"10.0.0.1:8001", "10.0.0.1:8002"},
+			reported:   []string{REPORT_REGISTER + " 8001", REPORT_REGISTER + " 8002"},
+			valid:      true,
+		},
+		{
+			name:       "container gone",
+			containers: []dcontainer.ContainerInfo{newWatchedContainer("web-1", "Up 2 hours", 8001)},
+			registered: []string{"nginx/10.0.0.1:8001"},
+			addresses:  []string{"10.0.0.1:8001"},
+			reported:   []string{REPORT_UNREGISTER + " 8002"},
+			valid:      true,
+		},
+		{
+			name:       "container moved",
+			containers: []dcontainer.ContainerInfo{newWatchedContainer("web-4", "Up 1 minute", 8004)},
+			registered: []string{"nginx/10.0.0.1:8004"},
+			addresses:  []string{"10.0.0.1:8004"},
+			reported:   []string{REPORT_REGISTER + " 8004", REPORT_UNREGISTER + " 8001"},
+			valid:      true,
+		},
+		{
+			name:       "unregister failed",
+			containers: []dcontainer.ContainerInfo{},
+			failed:     true,
+			registered: []string{"nginx/10.0.0.1:8004"},
+			addresses:  []string{"10.0.0.1:8004"},
+			reported:   []string{REPORT_UNREGISTER + " 8004"},
+			valid:      false,
+		},
+		{
+			name:       "unregistered again",
+			containers: []dcontainer.ContainerInfo{},
+			registered: []string{},
+			addresses:  []string{},
+			reported:   []string{REPORT_UNREGISTER + " 8004"},
+			valid:      true,
+		},
+	}
+	registered := map[string]registration{}
+	for _, round := range rounds {
+		ctx.containerInfos = round.containers
+		ctx.report = NewDeployReport()
+		if round.failed {
+			fakeRegistryOf(nginx).err = errors.New("unavailable")
+		} else {
+			fakeRegistryOf(nginx).err = nil
+		}
+		current, err := ctx.reconcileRegistrations(registered)
+		if (err == nil) != round.valid {
+			t.Errorf("%s: expected succeeded %v, but got error %v", round.name, round.valid, err)
+		}
+		registered = current
+		if keys := registrationKeys(registered); !reflect.DeepEqual(keys, round.registered) {
+			t.Errorf("%s: expected %v registered by the watch, but got %v", round.name, round.registered, keys)
+		}
+		if addresses := fakeRegistryOf(nginx).addresses(); !reflect.DeepEqual(addresses, round.addresses) {
+			t.Errorf("%s: expected %v registered with nginx, but got %v", round.name, round.addresses, addresses)
+		}
+		reported := []string{}
+		for _, e := range ctx.report.Registrations {
+			reported = append(reported, fmt.Sprintf("%s %d", e.Action, e.Port))
+		}
+		if !reflect.DeepEqual(reported, round.reported) {
+			t.Errorf("%s: expected the registrations %v reported, but got %v", round.name, round.reported, reported)
+		}
+	}
+}
+
+func TestReconcileSkippedWhileLocked(t *testing.T) {
+	store := newMemKVStore()
+	holder := newLockTestContext(store)
+	if err := holder.acquireLock(); err != nil {
+		t.Fatalf("Failed to acquire the unlocked cluster: %s", err.Error())
+	}
+	defer holder.Close()
+
+	ctx := newLockTestContext(store)
+	ctx.report = NewDeployReport()
+	registered := map[string]registration{"nginx/10.0.0.1:8001": {sd: "nginx", host: "10.0.0.1", port: 8001}}
+	current, err := ctx.reconcile(registered)
+	if current != nil || err != nil {
+		t.Errorf("The round is expected to be skipped while the cluster is locked, but got %v, %v", current, err)
+	}
+	if ctx.lock != nil {
+		t.Errorf("The skipped round is expected not to lock the cluster")
+	}
+}
@@ -0,0 +1,295 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// INCLUDE_KEY is the key of the files included by a cluster file, which are merged before it.
+// The paths are relative to the cluster file.
+const INCLUDE_KEY = "include"
+
+// the lists merged by the group names of their items, the others are replaced.
+var groupedLists = map[string]bool{
+	"machine.topology":   true,
+	"container.topology": true,
+}
+
+// configLoader loads the cluster files with the files they include, applies the profile to them,
+// and deep-merges them in order. The problems found are added to the report.
+type configLoader struct {
+	report      *ValidationReport
+	profile     Profile
+	profileName string
+	merged      map[interface{}]interface{}
+	origins     map[string]position // the paths in the merged config to where they are defined
+	loading     []string
+	last        string
+	failed      bool
+}
+
+func newConfigLoader(report *ValidationReport, profile Profile, profileName string) *configLoader {
+	return &configLoader{
+		report:      report,
+		profile:     profile,
+		profileName: profileName,
+		merged:      map[interface{}]interface{}{},
+		origins:     map[string]position{},
+		loading:     []string{},
+	}
+}
+
+// load the files in order, and merge them. The merged config is nil if any file can not be decoded.
+// The error is returned only if the files can not be read.
+func (l *configLoader) load(files []string) (map[interface{}]interface{}, error) {
+	for _, file := range files {
+		l.last = file
+		if err := l.loadFile(file, nil); err != nil {
+			return nil, err
+		}
+	}
+	if l.failed {
+		return nil, nil
+	}
+	return l.merged, nil
+}
+
+// the included is where the file is included, nil for the files given.
+func (l *configLoader) loadFile(file string, included *position) error {
+	file = filepath.Clean(file)
+	v := &validator{report: l.report, file: file}
+	for idx, loading := range l.loading {
+		if loading == file {
+			v.addAt(SEVERITY_ERROR, *included, "file '%s' is included recursively: %s -> %s", file, strings.Join(l.loading[idx:], " -> "), file)
+			l.failed = true
+			return nil
+		}
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if included == nil {
+			return err
+		}
+		v.addAt(SEVERITY_ERROR, *included, "can not read the included file: %s", err.Error())
+		l.failed = true
+		return nil
+	}
+	l.loading = append(l.loading, file)
+	defer func() {
+		l.loading = l.loading[:len(l.loading)-1]
+	}()
+
+	content := string(b)
+	v = newValidator(l.report, file, content)
+	content = v.applyProfile(l.profile, l.profileName, content)
+	raw := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &raw); err != nil {
+		v.yamlError(err)
+		l.failed = true
+		return nil
+	}
+	v.checkKeys("", raw, reflect.TypeOf(Cluster{}), nil)
+	// the values of wrong types are reported with the lines of the file, which are lost once merged.
+	if err := yaml.Unmarshal([]byte(content), &Cluster{}); err != nil {
+		v.yamlError(err)
+	}
+
+	includes := map[string]string{} // the path of the include to the file
+	paths := []string{}
+	switch value := raw[INCLUDE_KEY].(type) {
+	case nil:
+	case string:
+		includes[INCLUDE_KEY] = value
+		paths = append(paths, INCLUDE_KEY)
+	case []interface{}:
+		for i, include := range value {
+			path := joinPath(INCLUDE_KEY, strconv.Itoa(i))
+			includes[path] = fmt.Sprint(include)
+			paths = append(paths, path)
+		}
+	default:
+		v.errorf(INCLUDE_KEY, "'%s' is expected to be a file or a list of files", INCLUDE_KEY)
+	}
+	delete(raw, INCLUDE_KEY)
+	for _, path := range paths {
+		include := includes[path]
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+		pos := v.locate(path)
+		if err := l.loadFile(include, &pos); err != nil {
+			return err
+		}
+	}
+
+	l.merge(l.merged, raw, "", "", v)
+	return nil
+}
+
+// deep-merge the src into the dst, the values in the src override the ones in the dst.
+func (l *configLoader) merge(dst, src map[interface{}]interface{}, dstPath, srcPath string, v *validator) {
+	for k, sv := range src {
+		key := fmt.Sprint(k)
+		dp, sp := joinPath(dstPath, key), joinPath(srcPath, key)
+		switch s := sv.(type) {
+		case map[interface{}]interface{}:
+			if d, ok := dst[k].(map[interface{}]interface{}); ok {
+				l.origins[dp] = v.locate(sp)
+				l.merge(d, s, dp, sp, v)
+				continue
+			}
+		case []interface{}:
+			if d, ok := dst[k].([]interface{}); ok && groupedLists[dp] {
+				l.origins[dp] = v.locate(sp)
+				dst[k] = l.mergeGroups(d, s, dp, sp, v)
+				continue
+			}
+		}
+		dst[k] = sv
+		l.relocate(dp, sp, sv, v)
+	}
+}
+
+// the items of the src override the items of the dst in the same group, and the others are appended.
+func (l *configLoader) mergeGroups(dst, src []interface{}, dstPath, srcPath string, v *validator) []interface{} {
+	for i, item := range src {
+		sp := joinPath(srcPath, strconv.Itoa(i))
+		if s, ok := item.(map[interface{}]interface{}); ok && s["group"] != nil {
+			if j := groupIndex(dst, s["group"]); j >= 0 {
+				dp := joinPath(dstPath, strconv.Itoa(j))
+				l.origins[dp] = v.locate(sp)
+				l.merge(dst[j].(map[interface{}]interface{}), s, dp, sp, v)
+				continue
+			}
+		}
+		dst = append(dst, item)
+		l.relocate(joinPath(dstPath, strconv.Itoa(len(dst)-1)), sp, item, v)
+	}
+	return dst
+}
+
+func groupIndex(items []interface{}, group interface{}) int {
+	for i, item := range items {
+		if m, ok := item.(map[interface{}]interface{}); ok && fmt.Sprint(m["group"]) == fmt.Sprint(group) {
+			return i
+		}
+	}
+	return -1
+}
+
+// record where the node and all the values in it are defined, in place of the ones it replaces.
+func (l *configLoader) relocate(dstPath, srcPath string, node interface{}, v *validator) {
+	for path := range l.origins {
+		if strings.HasPrefix(path, dstPath+PATH_SEPARATOR) {
+			delete(l.origins, path)
+		}
+	}
+	l.origins[dstPath] = v.locate(srcPath)
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		for k, value := range n {
+			key := fmt.Sprint(k)
+			l.relocate(joinPath(dstPath, key), joinPath(srcPath, key), value, v)
+		}
+	case []interface{}:
+		for i, value := range n {
+			l.relocate(joinPath(dstPath, strconv.Itoa(i)), joinPath(srcPath, strconv.Itoa(i)), value, v)
+		}
+	}
+}
+
+// where the path of the merged config is defined, or its closest parent.
+func (l *configLoader) locate(path string) position {
+	for path != "" {
+		if pos, ok := l.origins[path]; ok {
+			return pos
+		}
+		idx := strings.LastIndex(path, PATH_SEPARATOR)
+		if idx < 0 {
+			break
+		}
+		path = path[:idx]
+	}
+	return position{file: l.last}
+}
+
+func decodeCluster(merged map[interface{}]interface{}) (*Cluster, error) {
+	b, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return nil, err
+		}
+		// the values of wrong types are reported by the loader already.
+	}
+	return c, nil
+}
+
+// ClusterConfig is the cluster files merged in order, with the profile applied.
+type ClusterConfig struct {
+	config map[interface{}]interface{}
+}
+
+func (c *ClusterConfig) MarshalYAML() (interface{}, error) {
+	return c.config, nil
+}
+
+// the keys of the maps in json are strings.
+func jsonValue(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, value := range n {
+			m[fmt.Sprint(k)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(n))
+		for i, value := range n {
+			items[i] = jsonValue(value)
+		}
+		return items
+	}
+	return node
+}
+
+func (c *ClusterConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonValue(c.config))
+}
+
+func (c *ClusterConfig) Print(w io.Writer) {
+	b, err := yaml.Marshal(c.config)
+	if err != nil {
+		fmt.Fprintf(w, "Failed to print the cluster config: %s\n", err.Error())
+		return
+	}
+	w.Write(b)
+}
+
+// LoadClusterConfig merges the cluster files in order, and applies the profile, as the cluster is built from.
+func LoadClusterConfig(configFiles []string, profileName, profileFileName string) (*ClusterConfig, error) {
+	profile, activeProfile, err := loadProfile(profileName, profileFileName)
+	if err != nil {
+		return nil, err
+	}
+	report := &ValidationReport{}
+	merged, err := newConfigLoader(report, profile, activeProfile).load(configFiles)
+	if err != nil {
+		return nil, err
+	}
+	if err := report.err(); err != nil {
+		return nil, err
+	}
+	return &ClusterConfig{config: merged}, nil
+}
@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOverride = `container:
+   topology:
+      - group: nginx
+        image: nginx:1.10
+        num: 2
+      - group: redis
+        image: redis:3
+        num: 1
+        port: 6379:6379
+        machine: web
+`
+
+func TestLoadClusterFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		loaded []string
+		// the groups of the container topology, with their images and nums.
+		expected map[string]ContainerDescription
+	}{
+		{
+			name:   "override",
+			files:  map[string]string{"base.yml": testCluster, "prod.yml": testOverride},
+			loaded: []string{"base.yml", "prod.yml"},
+			expected: map[string]ContainerDescription{
+				"nginx": {Image: "nginx:1.10", Num: 2, Machine: "web"},
+				"redis": {Image: "redis:3", Num: 1, Machine: "web"},
+			},
+		},
+		{
+			name:   "in order",
+			files:  map[string]string{"base.yml": testCluster, "prod.yml": testOverride},
+			loaded: []string{"prod.yml", "base.yml"},
+			expected: map[string]ContainerDescription{
+				"nginx": {Image: "nginx:1.9", Num: 1, Machine: "web"},
+				"redis": {Image: "redis:3", Num: 1, Machine: "web"},
+			},
+		},
+		{
+			name: "include",
+			files: map[string]string{
+				"common/base.yml": testCluster,
+				"cluster.yml":     "include: common/base.yml\n" + testOverride,
+			},
+			loaded: []string{"cluster.yml"},
+			expected: map[string]ContainerDescription{
+				"nginx": {Image: "nginx:1.10", Num: 2, Machine: "web"},
+				"redis": {Image: "redis:3", Num: 1, Machine: "web"},
+			},
+		},
+		{
+			name: "included in order",
+			files: map[string]string{
+				"common/base.yml":  testCluster,
+				"common/redis.yml": "container:\n   topology:\n      - group: redis\n        num: 2\n",
+				"cluster.yml":      "include:\n   - common/base.yml\n   - common/redis.yml\n" + testOverride,
+			},
+			loaded: []string{"cluster.yml"},
+			expected: map[string]ContainerDescription{
+				"nginx": {Image: "nginx:1.10", Num: 2, Machine: "web"},
+				"redis": {Image: "redis:3", Num: 1, Machine: "web"},
+			},
+		},
+	}
+	for _, test := range tests {
+		dir, remove := writeTestFiles(t, test.files)
+		files := []string{}
+		for _, file := range test.loaded {
+			files = append(files, filepath.Join(dir, file))
+		}
+		c, err := NewClusterFromFiles(files, "", filepath.Join(dir, "profile.yml"))
+		remove()
+		if err != nil {
+			t.Errorf("%s: failed to load the cluster: %s", test.name, err.Error())
+			continue
+		}
+		if len(c.Machine.Topology) != 1 || c.Machine.Topology[0].Group != "web" {
+			t.Errorf("%s: expected machine group 'web', but got %+v", test.name, c.Machine.Topology)
+		}
+		groups := map[string]ContainerDescription{}
+		for _, cd := range c.Container.Topology {
+			groups[cd.Group] = ContainerDescription{Image: cd.Image, Num: cd.Num, Machine: cd.Machine}
+		}
+		if !reflect.DeepEqual(groups, test.expected) {
+			t.Errorf("%s: expected container groups %+v, but got %+v", test.name, test.expected, groups)
+		}
+	}
+}
+
+func TestLoadClusterFilesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name: "recursive include",
+			files: map[string]string{
+				"cluster.yml": "include: common.yml\n" + testCluster,
+				"common.yml":  "include: cluster.yml\n",
+			},
+			expected: []string{
+				"common.yml:1: error: file 'cluster.yml' is included recursively: cluster.yml -> common.yml -> cluster.yml",
+			},
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"cluster.yml": "include:\n   - missing.yml\n" + testCluster,
+			},
+			expected: []string{
+				"cluster.yml:2: error: can not read the included file",
+			},
+		},
+		{
+			name: "error in the included file",
+			files: map[string]string{
+				"cluster.yml": "include: common.yml\n" + testOverride,
+				"common.yml":  strings.Replace(testCluster, "memory: 1g", "memroy: 1g", 1),
+			},
+			expected: []string{
+				"common.yml:7: error: unknown key 'memroy' in 'machine.topology.0', did you mean 'memory'?",
+			},
+		},
+		{
+			name: "merged error at the overriding file",
+			files: map[string]string{
+				"cluster.yml": "include: common.yml\n" + strings.Replace(testOverride, "machine: web", "machine: db", 1),
+				"common.yml":  testCluster,
+			},
+			expected: []string{
+				"cluster.yml:11: error: machine group 'db' of container group 'redis' is not defined under 'machine.topology'",
+			},
+		},
+	}
+	for _, test := range tests {
+		dir, remove := writeTestFiles(t, test.files)
+		report, err := Validate([]string{filepath.Join(dir, "cluster.yml")}, "", filepath.Join(dir, "profile.yml"))
+		remove()
+		if err != nil {
+			t.Errorf("%s: failed to validate: %s", test.name, err.Error())
+			continue
+		}
+		problems := problemStrings(report, dir)
+		if len(problems) != len(test.expected) {
+			t.Errorf("%s: expected problems:\n%s\nbut got:\n%s", test.name, strings.Join(test.expected, "\n"), strings.Join(problems, "\n"))
+			continue
+		}
+		for i, expected := range test.expected {
+			if !strings.HasPrefix(problems[i], expected) {
+				t.Errorf("%s: expected problem '%s', but got '%s'", test.name, expected, problems[i])
+			}
+		}
+	}
+}
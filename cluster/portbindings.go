@@ -70,10 +70,11 @@ func (hp *HostPortRange) hostPort() int {
 }
 
 type PortBinding struct {
-	Protocal      string
-	hostPortRange HostPortRange
-	HostPort      int
-	ContainerPort int
+	Protocal        string
+	hostPortRange   HostPortRange
+	HostPort        int
+	ContainerPort   int
+	ServiceDiscover string // the service discover the port is registered with, not registered if empty
 }
 
 func (pb *PortBinding) GetHostPort() int {
@@ -159,7 +160,7 @@ func (pb *PortBinding) parseHostPortRange(portStr string) error {
 	minPort, minErr := strconv.ParseInt(minPortStr, 10, 32)
 	maxPort, maxErr := strconv.ParseInt(maxPortStr, 10, 32)
 	if minPort > maxPort || minErr != nil || maxErr != nil {
-		return errors.New(fmt.Sprintf("Parse host port(%s) range error:%s", portStr))
+		return errors.New(fmt.Sprintf("Parse host port range error. %s", portStr))
 	}
 	pb.hostPortRange = HostPortRange{
 		min: int(minPort),
@@ -0,0 +1,265 @@
+package cluster
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	ENCRYPTED_PREFIX        = "encrypted:"
+	SECRET_KEY_ENV          = "DOCKERF_SECRET_KEY"      // the key encoded in base64
+	SECRET_KEY_FILE_ENV     = "DOCKERF_SECRET_KEY_FILE" // the file of the key
+	DEFAULT_SECRET_KEY_FILE = ".dockerf/secret.key"     // in the home directory
+	SECRET_KEY_SIZE         = 32                        // AES-256
+	SECRET_MASK             = "******"
+	MIN_MASKED_SECRET_SIZE  = 4 // the shorter secrets are not masked, which would mask everything
+)
+
+var encryptedPattern = regexp.MustCompile(ENCRYPTED_PREFIX + `[A-Za-z0-9_\-]+=*`)
+
+// SecretKey encrypts and decrypts the secret values in the cluster files with AES-GCM.
+type SecretKey []byte
+
+func GenerateSecretKey() (SecretKey, error) {
+	key := make(SecretKey, SECRET_KEY_SIZE)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseSecretKey(encoded string) (SecretKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("The secret key is not in base64: %s", err.Error())
+	}
+	if len(key) != SECRET_KEY_SIZE {
+		return nil, fmt.Errorf("The secret key is %d bytes, %d expected", len(key), SECRET_KEY_SIZE)
+	}
+	return SecretKey(key), nil
+}
+
+// SecretKeyFile is the file of the key, given by the environment variable or the default one in the home directory.
+func SecretKeyFile() string {
+	if file := os.Getenv(SECRET_KEY_FILE_ENV); file != "" {
+		return file
+	}
+	return filepath.Join(os.Getenv("HOME"), DEFAULT_SECRET_KEY_FILE)
+}
+
+// LoadSecretKey reads the key from the file. If the file is empty, the key is read from the environment variable,
+// or the file SecretKeyFile tells.
+func LoadSecretKey(file string) (SecretKey, error) {
+	if file == "" {
+		if encoded := os.Getenv(SECRET_KEY_ENV); encoded != "" {
+			return parseSecretKey(encoded)
+		}
+		file = SecretKeyFile()
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseSecretKey(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return key, nil
+}
+
+// Save writes the key to the file, which is readable by the owner only.
+func (k SecretKey) Save(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(k)+"\n"), 0600)
+}
+
+func (k SecretKey) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt returns the value in the encrypted syntax, 'encrypted:' followed by the nonce and the sealed value in base64.
+func (k SecretKey) Encrypt(value string) (string, error) {
+	gcm, err := k.gcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return ENCRYPTED_PREFIX + base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+func (k SecretKey) Decrypt(encrypted string) (string, error) {
+	if !strings.HasPrefix(encrypted, ENCRYPTED_PREFIX) {
+		return "", fmt.Errorf("'%s' is not an encrypted value", encrypted)
+	}
+	sealed, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(encrypted, ENCRYPTED_PREFIX))
+	if err != nil {
+		return "", fmt.Errorf("the encrypted value is broken: %s", err.Error())
+	}
+	gcm, err := k.gcm()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("the encrypted value is broken")
+	}
+	value, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("the encrypted value can not be decrypted with the secret key")
+	}
+	return string(value), nil
+}
+
+// ReplaceEncrypted replaces all the encrypted values in the content with the ones the replace function returns,
+// such as re-encrypting them with a new key.
+func ReplaceEncrypted(content string, replace func(encrypted string) (string, error)) (string, int, error) {
+	var replaceErr error
+	n := 0
+	result := encryptedPattern.ReplaceAllStringFunc(content, func(encrypted string) string {
+		if replaceErr != nil {
+			return encrypted
+		}
+		value, err := replace(encrypted)
+		if err != nil {
+			replaceErr = err
+			return encrypted
+		}
+		n++
+		return value
+	})
+	return result, n, replaceErr
+}
+
+var (
+	defaultKey     SecretKey
+	defaultKeyErr  error
+	defaultKeyOnce sync.Once
+
+	secretsLock sync.RWMutex
+	secrets     = map[string]string{} // the decrypted values to the encrypted ones they are decrypted from
+	maskOnce    sync.Once
+)
+
+// decrypt the value with the default key, and remember it to be masked.
+func decryptSecret(encrypted string) (string, error) {
+	defaultKeyOnce.Do(func() {
+		defaultKey, defaultKeyErr = LoadSecretKey("")
+	})
+	if defaultKeyErr != nil {
+		return "", fmt.Errorf("Failed to load the secret key to decrypt the values, set %s or %s: %s", SECRET_KEY_ENV, SECRET_KEY_FILE_ENV, defaultKeyErr.Error())
+	}
+	value, err := defaultKey.Decrypt(encrypted)
+	if err != nil {
+		return "", err
+	}
+	registerSecret(value, encrypted)
+	return value, nil
+}
+
+// the secrets are masked in the logs once any secret long enough is decrypted.
+func registerSecret(value string, encrypted string) {
+	if value == "" {
+		return
+	}
+	secretsLock.Lock()
+	secrets[value] = encrypted
+	secretsLock.Unlock()
+	if len(value) < MIN_MASKED_SECRET_SIZE {
+		return
+	}
+	maskOnce.Do(func() {
+		log.SetFormatter(&SecretMaskingFormatter{Formatter: log.StandardLogger().Formatter})
+	})
+}
+
+// MaskSecrets replaces the secrets decrypted in the text with the mask.
+func MaskSecrets(text string) string {
+	return replaceSecrets(text, MIN_MASKED_SECRET_SIZE, func(value string, encrypted string) string {
+		return SECRET_MASK
+	})
+}
+
+// EncryptSecrets replaces the secrets decrypted in the text with the encrypted values they are decrypted from,
+// so the text can be stored and decrypted again by DecryptSecrets.
+func EncryptSecrets(text string) string {
+	return replaceSecrets(text, 1, func(value string, encrypted string) string {
+		return encrypted
+	})
+}
+
+// DecryptSecrets decrypts the encrypted values in the text with the default key.
+func DecryptSecrets(text string) (string, error) {
+	result, _, err := ReplaceEncrypted(text, decryptSecret)
+	return result, err
+}
+
+// replace the secrets of minSize bytes at least in the text.
+func replaceSecrets(text string, minSize int, replace func(value string, encrypted string) string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	// the longer secrets first, the ones containing the others are replaced as a whole.
+	values := []string{}
+	for value := range secrets {
+		if len(value) >= minSize {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return text
+	}
+	sort.Sort(sort.Reverse(sortByLength(values)))
+	// replaced in one pass, so the replacements are not replaced again.
+	oldnew := []string{}
+	for _, value := range values {
+		oldnew = append(oldnew, value, replace(value, secrets[value]))
+	}
+	return strings.NewReplacer(oldnew...).Replace(text)
+}
+
+type sortByLength []string
+
+func (s sortByLength) Len() int {
+	return len(s)
+}
+func (s sortByLength) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortByLength) Less(i, j int) bool {
+	return len(s[i]) < len(s[j])
+}
+
+// SecretMaskingFormatter masks the secrets decrypted in the log entries formatted.
+type SecretMaskingFormatter struct {
+	Formatter log.Formatter
+}
+
+func (f *SecretMaskingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(entry)
+	if err != nil {
+		return b, err
+	}
+	return []byte(MaskSecrets(string(b))), nil
+}
@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+)
+
+// make the key the default one the encrypted values in the cluster files are decrypted with.
+func useTestSecretKey(t *testing.T) SecretKey {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate the secret key: %s", err.Error())
+	}
+	defaultKeyOnce.Do(func() {})
+	defaultKey, defaultKeyErr = key, nil
+	return key
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate the secret key: %s", err.Error())
+	}
+	other, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate the secret key: %s", err.Error())
+	}
+	for _, value := range []string{"", "p", "redis-password", "a: b # c", "multi\nline", "中文"} {
+		encrypted, err := key.Encrypt(value)
+		if err != nil {
+			t.Errorf("Failed to encrypt '%s': %s", value, err.Error())
+			continue
+		}
+		if !encryptedPattern.MatchString(encrypted) || encryptedPattern.FindString(encrypted) != encrypted {
+			t.Errorf("'%s' is not in the encrypted syntax", encrypted)
+		}
+		if decrypted, err := key.Decrypt(encrypted); err != nil || decrypted != value {
+			t.Errorf("'%s' is expected to be decrypted to '%s', but got '%s', %v", encrypted, value, decrypted, err)
+		}
+		if _, err := other.Decrypt(encrypted); err == nil {
+			t.Errorf("'%s' is decrypted with another key", encrypted)
+		}
+	}
+
+	for _, invalid := range []string{"redis-password", ENCRYPTED_PREFIX + "!!!", ENCRYPTED_PREFIX + "YWJj"} {
+		if _, err := key.Decrypt(invalid); err == nil {
+			t.Errorf("'%s' is expected to fail the decryption", invalid)
+		}
+	}
+}
+
+func TestRotateEncrypted(t *testing.T) {
+	oldKey, _ := GenerateSecretKey()
+	newKey, _ := GenerateSecretKey()
+	values := []string{"redis-password", "mysql-password"}
+	lines := []string{"env:"}
+	for _, value := range values {
+		encrypted, err := oldKey.Encrypt(value)
+		if err != nil {
+			t.Fatalf("Failed to encrypt '%s': %s", value, err.Error())
+		}
+		lines = append(lines, "   - PASS="+encrypted+" # a comment")
+	}
+	content := strings.Join(lines, "\n")
+
+	rotated, n, err := ReplaceEncrypted(content, func(encrypted string) (string, error) {
+		value, err := oldKey.Decrypt(encrypted)
+		if err != nil {
+			return "", err
+		}
+		return newKey.Encrypt(value)
+	})
+	if err != nil || n != len(values) {
+		t.Fatalf("Expected %d values rotated, but got %d, %v", len(values), n, err)
+	}
+	decrypted, _, err := ReplaceEncrypted(rotated, newKey.Decrypt)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the rotated values with the new key: %s", err.Error())
+	}
+	expected := "env:\n   - PASS=redis-password # a comment\n   - PASS=mysql-password # a comment"
+	if decrypted != expected {
+		t.Errorf("Expected the rotated content to be decrypted to:\n%s\nbut got:\n%s", expected, decrypted)
+	}
+	if _, _, err := ReplaceEncrypted(rotated, oldKey.Decrypt); err == nil {
+		t.Errorf("The rotated values are decrypted with the old key")
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	key := useTestSecretKey(t)
+	for _, value := range []string{"redis-password", "redis-password-2", "abc"} {
+		encrypted, err := key.Encrypt(value)
+		if err != nil {
+			t.Fatalf("Failed to encrypt '%s': %s", value, err.Error())
+		}
+		if _, err := decryptSecret(encrypted); err != nil {
+			t.Fatalf("Failed to decrypt '%s': %s", encrypted, err.Error())
+		}
+	}
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"PASS=redis-password", "PASS=" + SECRET_MASK},
+		{"PASS=redis-password-2", "PASS=" + SECRET_MASK},
+		{"PASS=redis-password, PASS2=redis-password-2", "PASS=" + SECRET_MASK + ", PASS2=" + SECRET_MASK},
+		{"abc is too short to be masked", "abc is too short to be masked"},
+		{"no secret", "no secret"},
+	}
+	for _, test := range tests {
+		if masked := MaskSecrets(test.text); masked != test.expected {
+			t.Errorf("'%s' is expected to be masked as '%s', but got '%s'", test.text, test.expected, masked)
+		}
+	}
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	key := useTestSecretKey(t)
+	encrypted := map[string]string{}
+	for _, value := range []string{"redis-password", "abc"} {
+		e, err := key.Encrypt(value)
+		if err != nil {
+			t.Fatalf("Failed to encrypt '%s': %s", value, err.Error())
+		}
+		if _, err := decryptSecret(e); err != nil {
+			t.Fatalf("Failed to decrypt '%s': %s", e, err.Error())
+		}
+		encrypted[value] = e
+	}
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"PASS=redis-password", "PASS=" + encrypted["redis-password"]},
+		{"KEY=abc", "KEY=" + encrypted["abc"]},
+		{"NAME=dockerf", "NAME=dockerf"},
+	}
+	for _, test := range tests {
+		text := EncryptSecrets(test.text)
+		if text != test.expected {
+			t.Errorf("'%s' is expected to be encrypted as '%s', but got '%s'", test.text, test.expected, text)
+		}
+		if decrypted, err := DecryptSecrets(text); err != nil || decrypted != test.text {
+			t.Errorf("'%s' is expected to be decrypted to '%s', but got '%s', %v", text, test.text, decrypted, err)
+		}
+	}
+}
@@ -0,0 +1,844 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	dutils "github.com/weibocom/dockerf/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	SEVERITY_ERROR   = "error"   // the cluster can not be deployed
+	SEVERITY_WARNING = "warning" // the cluster can be deployed, but may not be what is expected
+	PATH_SEPARATOR   = "."
+)
+
+// StrictDecoding fails the decoding of the cluster files with unknown keys, which are typos mostly.
+// The unknown keys are ignored with warnings if it is turned off.
+var StrictDecoding = true
+
+var (
+	yamlKeyPattern  = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s#'"][^:#]*?)\s*:(\s|$)`)
+	yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+type ValidationProblem struct {
+	File     string `json:"file" yaml:"file"`
+	Line     int    `json:"line,omitempty" yaml:"line,omitempty"` // 0 if the line is unknown
+	Severity string `json:"severity" yaml:"severity"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+func (p ValidationProblem) String() string {
+	if p.Line <= 0 {
+		return fmt.Sprintf("%s: %s: %s", p.File, p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", p.File, p.Line, p.Severity, p.Message)
+}
+
+// ValidationReport is all the problems found in the cluster file and the profile file.
+type ValidationReport struct {
+	Valid    bool                `json:"valid" yaml:"valid"`
+	Problems []ValidationProblem `json:"problems" yaml:"problems"`
+
+	unknownKeys int // the unknown keys failing the strict decoding
+}
+
+func (r *ValidationReport) count(severity string) int {
+	n := 0
+	for _, p := range r.Problems {
+		if p.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *ValidationReport) HasErrors() bool {
+	return r.count(SEVERITY_ERROR) > 0
+}
+
+func (r *ValidationReport) Print(w io.Writer) {
+	for _, p := range r.Problems {
+		fmt.Fprintln(w, p.String())
+	}
+	if len(r.Problems) == 0 {
+		fmt.Fprintf(w, "The cluster is valid.\n")
+		return
+	}
+	fmt.Fprintf(w, "%d error(s), %d warning(s).\n", r.count(SEVERITY_ERROR), r.count(SEVERITY_WARNING))
+}
+
+// the errors in the report in one, nil if there is no error. The warnings are logged.
+func (r *ValidationReport) err() error {
+	sort.Stable(SortValidationProblemByLine(r.Problems))
+	errs := []string{}
+	for _, p := range r.Problems {
+		if p.Severity == SEVERITY_ERROR {
+			errs = append(errs, p.String())
+		} else {
+			log.Warn(p.String())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if r.unknownKeys > 0 {
+		errs = append(errs, "Fix the unknown keys, or run with '--strict=false' to ignore them.")
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
+
+type SortValidationProblemByLine []ValidationProblem
+
+func (s SortValidationProblemByLine) Len() int {
+	return len(s)
+}
+func (s SortValidationProblemByLine) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s SortValidationProblemByLine) Less(i, j int) bool {
+	if s[i].File != s[j].File {
+		return s[i].File < s[j].File
+	}
+	return s[i].Line < s[j].Line
+}
+
+// lineIndex maps the paths of the keys and the sequence items in a yaml file, such as 'container.topology.0.port',
+// to the lines they are at. Only the block style is indexed, which is what the cluster files are written in.
+type lineIndex map[string]int
+
+func joinPath(path ...string) string {
+	parts := []string{}
+	for _, p := range path {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, PATH_SEPARATOR)
+}
+
+func newLineIndex(content string) lineIndex {
+	type entry struct {
+		indent int
+		path   string
+		item   bool
+	}
+	index := lineIndex{}
+	items := map[string]int{}
+	stack := []entry{}
+	parent := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1].path
+	}
+	for n, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		rest := line[indent:]
+		for rest == "-" || strings.HasPrefix(rest, "- ") {
+			// an item may be at the same indent as the key of its sequence.
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if top.indent < indent || (top.indent == indent && !top.item) {
+					break
+				}
+				stack = stack[:len(stack)-1]
+			}
+			seq := parent()
+			path := joinPath(seq, strconv.Itoa(items[seq]))
+			items[seq]++
+			index[path] = n + 1
+			stack = append(stack, entry{indent: indent, path: path, item: true})
+			rest = rest[1:]
+			spaces := len(rest) - len(strings.TrimLeft(rest, " "))
+			indent += 1 + spaces
+			rest = rest[spaces:]
+		}
+		m := yamlKeyPattern.FindStringSubmatch(rest)
+		if m == nil {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		path := joinPath(parent(), strings.Trim(m[1], `"'`))
+		index[path] = n + 1
+		stack = append(stack, entry{indent: indent, path: path})
+	}
+	return index
+}
+
+// the line of the path, or of its closest parent indexed.
+func (li lineIndex) line(path string) int {
+	for path != "" {
+		if n, ok := li[path]; ok {
+			return n
+		}
+		idx := strings.LastIndex(path, PATH_SEPARATOR)
+		if idx < 0 {
+			break
+		}
+		path = path[:idx]
+	}
+	return 0
+}
+
+// the names of the keys decoded into the fields of the struct type, the same as yaml does.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// where a key is defined.
+type position struct {
+	file string
+	line int
+}
+
+type validator struct {
+	report *ValidationReport
+	file   string
+	locate func(path string) position
+}
+
+func newValidator(report *ValidationReport, file, content string) *validator {
+	lines := newLineIndex(content)
+	return &validator{
+		report: report,
+		file:   file,
+		locate: func(path string) position {
+			return position{file: file, line: lines.line(path)}
+		},
+	}
+}
+
+func (v *validator) addAt(severity string, pos position, format string, args ...interface{}) {
+	v.report.Problems = append(v.report.Problems, ValidationProblem{
+		File:     pos.file,
+		Line:     pos.line,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) add(severity string, line int, format string, args ...interface{}) {
+	v.addAt(severity, position{file: v.file, line: line}, format, args...)
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.addAt(SEVERITY_ERROR, v.locate(path), format, args...)
+}
+
+func (v *validator) warnf(path string, format string, args ...interface{}) {
+	v.addAt(SEVERITY_WARNING, v.locate(path), format, args...)
+}
+
+// the yaml errors carry the lines already.
+func (v *validator) yamlError(err error) {
+	messages := []string{err.Error()}
+	if te, ok := err.(*yaml.TypeError); ok {
+		messages = te.Errors
+	}
+	for _, msg := range messages {
+		if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			v.add(SEVERITY_ERROR, line, "%s", m[2])
+		} else {
+			v.add(SEVERITY_ERROR, 0, "%s", msg)
+		}
+	}
+}
+
+// the fields of a struct the keys are decoded into.
+type keyScope struct {
+	path   string
+	fields map[string]reflect.Type
+}
+
+// the known field closest to the key, if it is close enough to be a typo.
+func closestField(key string, fields map[string]reflect.Type) (string, bool) {
+	closest, distance := "", -1
+	for name := range fields {
+		d := dutils.EditDistance(strings.ToLower(key), name)
+		if distance < 0 || d < distance || (d == distance && name < closest) {
+			closest, distance = name, d
+		}
+	}
+	return closest, distance >= 0 && distance <= dutils.MaxInt(2, len(key)/3)
+}
+
+func (v *validator) unknownKey(path, key string, t reflect.Type, scopes []keyScope) {
+	keyPath := joinPath(path, key)
+	if path == "" && t == reflect.TypeOf(Cluster{}) {
+		if key == INCLUDE_KEY {
+			return
+		}
+		if _, isProfile := yamlFields(reflect.TypeOf(ClusterProfiles{}))[key]; isProfile {
+			v.warnf(keyPath, "key '%s' is ignored, the profiles are read from the profile file", key)
+			return
+		}
+	}
+	msg := fmt.Sprintf("unknown key '%s'", key)
+	if path != "" {
+		msg = fmt.Sprintf("unknown key '%s' in '%s'", key, path)
+	}
+	misplaced := false
+	// a key at the wrong indent is a field of an outer struct.
+	for i := len(scopes) - 2; i >= 0 && !misplaced; i-- {
+		if _, misplaced = scopes[i].fields[key]; misplaced {
+			msg = fmt.Sprintf("%s, it belongs to '%s', check its indent", msg, scopes[i].path)
+		}
+	}
+	if name, ok := closestField(key, scopes[len(scopes)-1].fields); ok && !misplaced {
+		msg = fmt.Sprintf("%s, did you mean '%s'?", msg, name)
+	}
+	if StrictDecoding {
+		v.report.unknownKeys++
+		v.errorf(keyPath, "%s", msg)
+	} else {
+		v.warnf(keyPath, "%s", msg)
+	}
+}
+
+// report the keys in the node which are not decoded into any field of the type.
+func (v *validator) checkKeys(path string, node interface{}, t reflect.Type, scopes []keyScope) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		v.checkKeys(path, node, t.Elem(), scopes)
+	case reflect.Struct:
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		fields := yamlFields(t)
+		scopes = append(scopes[:len(scopes):len(scopes)], keyScope{path: path, fields: fields})
+		for k, value := range m {
+			key := fmt.Sprint(k)
+			ft, ok := fields[key]
+			if !ok {
+				v.unknownKey(path, key, t, scopes)
+				continue
+			}
+			v.checkKeys(joinPath(path, key), value, ft, scopes)
+		}
+	case reflect.Slice:
+		items, ok := node.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			v.checkKeys(joinPath(path, strconv.Itoa(i)), item, t.Elem(), scopes)
+		}
+	case reflect.Map:
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		for k, value := range m {
+			v.checkKeys(joinPath(path, fmt.Sprint(k)), value, t.Elem(), scopes)
+		}
+	}
+}
+
+// checkUnknownKeys fails if there is any unknown key in the content decoded into out, in strict decoding.
+// The unknown keys are logged as warnings otherwise.
+func checkUnknownKeys(file, content string, out interface{}) error {
+	raw := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &raw); err != nil {
+		return err
+	}
+	report := &ValidationReport{}
+	newValidator(report, file, content).checkKeys("", raw, reflect.TypeOf(out), nil)
+	return report.err()
+}
+
+// decode the content, and report the unknown keys and the values of wrong types.
+func (v *validator) decode(content string, out interface{}) bool {
+	raw := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &raw); err != nil {
+		v.yamlError(err)
+		return false
+	}
+	v.checkKeys("", raw, reflect.TypeOf(out), nil)
+	if err := yaml.Unmarshal([]byte(content), out); err != nil {
+		// the values of wrong types are skipped, and the others are decoded.
+		v.yamlError(err)
+	}
+	return true
+}
+
+// apply the profile, and report the placeholders not resolved, which are left as they are.
+func (v *validator) applyProfile(profile Profile, profileName string, content string) string {
+	lines := strings.Split(content, "\n")
+	for n, line := range lines {
+		lines[n] = applyProfileLine(profile, profileName, line, func(err error) {
+			v.add(SEVERITY_ERROR, n+1, "%s", err.Error())
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks the cluster files merged in order and the profile file, and reports all the problems found in one pass.
+// The error is returned only if the files can not be read.
+func Validate(configFiles []string, profileName, profileFileName string) (*ValidationReport, error) {
+	report := &ValidationReport{Problems: []ValidationProblem{}}
+
+	profile, activeProfile, err := validateProfile(report, profileName, profileFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := newConfigLoader(report, profile, activeProfile)
+	merged, err := loader.load(configFiles)
+	if err != nil {
+		return nil, err
+	}
+	if merged != nil {
+		c, err := decodeCluster(merged)
+		if err != nil {
+			return nil, err
+		}
+		v := &validator{report: report, file: configFiles[len(configFiles)-1], locate: loader.locate}
+		v.checkCluster(c)
+	}
+
+	sort.Stable(SortValidationProblemByLine(report.Problems))
+	report.Valid = !report.HasErrors()
+	return report, nil
+}
+
+// validate the profile file, and return the active profile in it. The profile is nil if no profile file is found.
+func validateProfile(report *ValidationReport, profileName, profileFileName string) (Profile, string, error) {
+	b, err := ioutil.ReadFile(profileFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	v := newValidator(report, profileFileName, string(b))
+	profiles := &ClusterProfiles{}
+	if !v.decode(string(b), profiles) {
+		return Profile{}, profileName, nil
+	}
+	names := []string{}
+	for name := range profiles.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if profiles.Profiles[name][PROFILE_EXTENDS_KEY] == "" {
+			continue
+		}
+		if _, err := profiles.resolveProfile(name, []string{}); err != nil {
+			v.errorf(joinPath("profiles", name, PROFILE_EXTENDS_KEY), "%s", err.Error())
+		}
+	}
+	profile, err := profiles.findProfile(profileName)
+	if err != nil {
+		if _, exist := profiles.Profiles[profiles.ActiveProfile]; !exist {
+			v.errorf("activeprofile", "profile '%s' is not defined under 'profiles'", profiles.ActiveProfile)
+		}
+		return Profile{}, profiles.ActiveProfile, nil
+	}
+	return profile, profiles.ActiveProfile, nil
+}
+
+// the host ports bound by the containers of a group.
+type hostPortUsage struct {
+	path     string
+	group    string
+	num      int
+	protocol string
+	min      int
+	max      int
+}
+
+func (u *hostPortUsage) String() string {
+	if u.min == u.max {
+		return fmt.Sprintf("%d/%s", u.min, u.protocol)
+	}
+	return fmt.Sprintf("%d~%d/%s", u.min, u.max, u.protocol)
+}
+
+func (v *validator) checkCluster(c *Cluster) {
+	machines := map[string]*MachineDescription{}
+	for i := range c.Machine.Topology {
+		md := &c.Machine.Topology[i]
+		path := joinPath("machine.topology", strconv.Itoa(i))
+		if md.Group == "" {
+			v.errorf(path, "machine group has no name")
+		} else if _, exists := machines[md.Group]; exists {
+			v.errorf(joinPath(path, "group"), "machine group '%s' is defined more than once", md.Group)
+		} else {
+			machines[md.Group] = md
+		}
+		if md.MinNum > md.MaxNum {
+			v.errorf(joinPath(path, "minnum"), "minnum %d of machine group '%s' is greater than maxnum %d", md.MinNum, md.Group, md.MaxNum)
+		}
+		if _, err := md.GetMemInBytes(); err != nil {
+			v.errorf(joinPath(path, "memory"), "'%s' is not a valid memory of machine group '%s'", md.Memory, md.Group)
+		}
+		if _, err := md.GetDiskCapacityInBytes(); err != nil {
+			v.errorf(joinPath(path, "disk.capacity"), "'%s' is not a valid disk capacity of machine group '%s'", md.Disk.Capacity, md.Group)
+		}
+		if md.Cloud != "" {
+			if _, exists := c.Machine.Cloud[md.Cloud]; !exists {
+				v.errorf(joinPath(path, "cloud"), "cloud '%s' of machine group '%s' is not defined under 'machine.cloud'", md.Cloud, md.Group)
+			}
+		}
+		for _, key := range reservedLabels {
+			if _, exists := md.Labels[key]; exists {
+				v.errorf(joinPath(path, "labels", key), "label '%s' of machine group '%s' is reserved by dockerf", key, md.Group)
+			}
+		}
+	}
+
+	groups := map[string]string{} // the group name to its path
+	deps := map[string][]string{}
+	usages := map[string][]*hostPortUsage{} // the machine group to the host ports used on it
+	antiAffinities := []*antiAffinity{}
+	for i, cd := range c.Container.Topology {
+		path := joinPath("container.topology", strconv.Itoa(i))
+		if cd.Image == "" {
+			v.errorf(path, "container group '%s' has no image", cd.Group)
+		}
+		if cd.Machine == "" {
+			v.errorf(path, "container group '%s' has no machine group", cd.Group)
+		} else if _, exists := machines[cd.Machine]; !exists {
+			v.errorf(joinPath(path, "machine"), "machine group '%s' of container group '%s' is not defined under 'machine.topology'", cd.Machine, cd.Group)
+		}
+		if cd.ServiceDiscover != "" {
+			if _, exists := c.ServiceDiscover[cd.ServiceDiscover]; !exists {
+				v.errorf(joinPath(path, "servicediscover"), "servicediscover '%s' of container group '%s' is not defined under 'servicediscover'", cd.ServiceDiscover, cd.Group)
+			}
+		}
+		if p := cd.GetHookPolicy(); p != HOOK_POLICY_IGNORE && p != HOOK_POLICY_ABORT {
+			v.errorf(joinPath(path, "hook-policy"), "hook-policy '%s' of container group '%s' is neither '%s' nor '%s'", p, cd.Group, HOOK_POLICY_IGNORE, HOOK_POLICY_ABORT)
+		}
+		if _, err := cd.GetHookTimeout(); err != nil {
+			v.errorf(joinPath(path, "hook-timeout"), "'%s' is not a valid hook-timeout of container group '%s'", cd.HookTimeout, cd.Group)
+		}
+		if _, err := cd.HealthCheck.GetTimeout(); err != nil {
+			v.errorf(joinPath(path, "healthcheck.timeout"), "'%s' is not a valid health check timeout of container group '%s'", cd.HealthCheck.Timeout, cd.Group)
+		}
+		if _, err := cd.HealthCheck.GetInterval(); err != nil {
+			v.errorf(joinPath(path, "healthcheck.interval"), "'%s' is not a valid health check interval of container group '%s'", cd.HealthCheck.Interval, cd.Group)
+		}
+		if hc := cd.HealthCheck; hc.HTTP != "" {
+			if hc.Port < 0 {
+				v.errorf(joinPath(path, "healthcheck.port"), "%d is not a valid health check port of container group '%s'", hc.Port, cd.Group)
+			} else if hc.Port == 0 && cd.PortBinding.ContainerPort <= 0 {
+				v.errorf(joinPath(path, "healthcheck.port"), "container group '%s' has no port, the http health check must give one", cd.Group)
+			}
+		}
+
+		if _, _, err := cd.GetRestartPolicy(); err != nil {
+			v.errorf(joinPath(path, "restart-policy"), "%s in container group '%s'", err.Error(), cd.Group)
+		}
+
+		v.checkResources(path, &cd)
+		v.checkRuntime(path, &cd)
+		if md, exists := machines[cd.Machine]; exists {
+			v.checkPlacement(path, &cd, md)
+		}
+
+		portsValid := v.checkPorts(path, c, &cd)
+
+		for _, expanded := range c.parseMultiPort(cd) {
+			if expanded.Port != "" {
+				binding := PortBinding{}
+				if err := binding.Parse(expanded.Port); err != nil {
+					v.errorf(joinPath(path, "port"), "'%s' is not a valid port of container group '%s': %s", expanded.Port, cd.Group, err.Error())
+					continue
+				}
+			}
+			if !portsValid || expanded.ParsePorts() != nil {
+				continue
+			}
+			expanded = c.replaceContainerPlaceholder(expanded)
+			if _, exists := groups[expanded.Group]; exists {
+				v.errorf(joinPath(path, "group"), "container group '%s' is defined more than once", expanded.Group)
+				continue
+			}
+			groups[expanded.Group] = path
+			deps[expanded.Group] = expanded.Deps
+			for j, other := range expanded.Placement.AntiAffinity {
+				antiAffinities = append(antiAffinities, &antiAffinity{path: joinPath(path, "placement.anti-affinity", strconv.Itoa(j)), group: expanded.Group, other: other})
+			}
+			bound := map[string]bool{}
+			for j, binding := range expanded.PortBindings {
+				portPath := joinPath(path, "port")
+				if expanded.Port == "" {
+					portPath = joinPath(path, "ports", strconv.Itoa(j))
+				} else if j > 0 {
+					portPath = joinPath(path, "ports", strconv.Itoa(j-1))
+				}
+				u := &hostPortUsage{
+					path:     portPath,
+					group:    expanded.Group,
+					num:      expanded.Num,
+					protocol: binding.Protocal,
+					min:      binding.hostPortRange.min,
+					max:      binding.hostPortRange.max,
+				}
+				if u.min == u.max {
+					if bound[u.String()] {
+						v.errorf(portPath, "host port %s is bound more than once by container group '%s'", u, expanded.Group)
+						continue
+					}
+					bound[u.String()] = true
+				}
+				usages[cd.Machine] = append(usages[cd.Machine], u)
+			}
+		}
+	}
+
+	v.checkDeps(groups, deps)
+	apart := map[string]bool{} // the pairs of the groups never sharing a machine
+	for _, a := range antiAffinities {
+		if a.other == a.group {
+			v.errorf(a.path, "container group '%s' is anti-affine to itself, set 'max-per-machine: 1' instead", a.group)
+		} else if _, exists := groups[a.other]; !exists {
+			v.errorf(a.path, "anti-affinity group '%s' of container group '%s' is not defined", a.other, a.group)
+		}
+		apart[a.group+"\x00"+a.other] = true
+		apart[a.other+"\x00"+a.group] = true
+	}
+	for machine, us := range usages {
+		if md, exists := machines[machine]; exists {
+			v.checkHostPorts(md, us, apart)
+		}
+	}
+}
+
+// check the ports besides the port of the group, which is checked with its multiple host ports.
+func (v *validator) checkPorts(path string, c *Cluster, cd *ContainerDescription) bool {
+	if cd.Port == "" && len(cd.Ports) == 0 {
+		v.errorf(path, "container group '%s' has no port, 'port' or 'ports' expected", cd.Group)
+		return false
+	}
+	valid := true
+	for i, p := range cd.Ports {
+		portPath := joinPath(path, "ports", strconv.Itoa(i))
+		if p.Protocol != "" && p.Protocol != "tcp" && p.Protocol != "udp" {
+			v.errorf(joinPath(portPath, "protocol"), "protocol '%s' of container group '%s' is neither 'tcp' nor 'udp'", p.Protocol, cd.Group)
+			valid = false
+		}
+		binding := PortBinding{}
+		if err := binding.Parse(p.spec()); err != nil {
+			v.errorf(portPath, "'%s' is not a valid port of container group '%s': %s", p.Port, cd.Group, err.Error())
+			valid = false
+		}
+		if p.ServiceDiscover != "" {
+			if _, exists := c.ServiceDiscover[p.ServiceDiscover]; !exists {
+				v.errorf(joinPath(portPath, "servicediscover"), "servicediscover '%s' of container group '%s' is not defined under 'servicediscover'", p.ServiceDiscover, cd.Group)
+			}
+		}
+	}
+	return valid
+}
+
+// the engine labels set by dockerf on the machines.
+var reservedLabels = []string{"role", "group", "region"}
+
+type antiAffinity struct {
+	path  string
+	group string
+	other string
+}
+
+func (v *validator) checkPlacement(path string, cd *ContainerDescription, md *MachineDescription) {
+	p := &cd.Placement
+	path = joinPath(path, "placement")
+	if err := p.Matches(md); err != nil {
+		v.errorf(path, "container group '%s' can never be placed: %s", cd.Group, err.Error())
+	}
+	if p.MaxPerMachine < 0 {
+		v.errorf(joinPath(path, "max-per-machine"), "max-per-machine %d of container group '%s' is negative", p.MaxPerMachine, cd.Group)
+	} else if p.MaxPerMachine > 0 && md.MaxNum > 0 && cd.Num > p.MaxPerMachine*md.MaxNum {
+		v.errorf(joinPath(path, "max-per-machine"), "%d containers of group '%s' can not be placed, at most %d per machine on %d machines of group '%s'", cd.Num, cd.Group, p.MaxPerMachine, md.MaxNum, md.Group)
+	}
+}
+
+var cpusetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+func (v *validator) checkResources(path string, cd *ContainerDescription) {
+	memory, err := cd.GetMemInBytes()
+	if err != nil || memory < 0 {
+		v.errorf(joinPath(path, "memory"), "'%s' is not a valid memory of container group '%s'", cd.Memory, cd.Group)
+	}
+	memorySwap, err := cd.GetMemorySwapInBytes()
+	if err != nil || memorySwap < -1 {
+		v.errorf(joinPath(path, "memory-swap"), "'%s' is not a valid memory-swap of container group '%s'", cd.MemorySwap, cd.Group)
+	} else if memorySwap > 0 && memorySwap < memory {
+		v.errorf(joinPath(path, "memory-swap"), "memory-swap %s of container group '%s' is less than its memory %s", cd.MemorySwap, cd.Group, cd.Memory)
+	} else if memorySwap != 0 && memory == 0 {
+		v.errorf(joinPath(path, "memory-swap"), "memory-swap of container group '%s' is set without memory", cd.Group)
+	}
+	if cd.CpuShares < 0 {
+		v.errorf(joinPath(path, "cpu-shares"), "cpu-shares %d of container group '%s' is negative", cd.CpuShares, cd.Group)
+	}
+	if cd.Cpuset != "" && !cpusetPattern.MatchString(cd.Cpuset) {
+		v.errorf(joinPath(path, "cpuset"), "'%s' is not a valid cpuset of container group '%s', such as 0-2 or 0,1 expected", cd.Cpuset, cd.Group)
+	}
+}
+
+func (v *validator) checkRuntime(path string, cd *ContainerDescription) {
+	for i, u := range cd.Ulimits {
+		if _, err := ParseUlimit(u); err != nil {
+			v.errorf(joinPath(path, "ulimits", strconv.Itoa(i)), "%s in container group '%s'", err.Error(), cd.Group)
+		}
+	}
+	for i, host := range cd.ExtraHosts {
+		idx := strings.Index(host, ":")
+		if idx <= 0 || net.ParseIP(host[idx+1:]) == nil {
+			v.errorf(joinPath(path, "extra-hosts", strconv.Itoa(i)), "'%s' is not a valid extra host of container group '%s', such as db:10.0.0.2 expected", host, cd.Group)
+		}
+	}
+	checkCaps := func(key string, caps []string) {
+		for i, c := range caps {
+			if strings.TrimSpace(c) == "" {
+				v.errorf(joinPath(path, key, strconv.Itoa(i)), "an empty capability in %s of container group '%s'", key, cd.Group)
+			}
+		}
+	}
+	checkCaps("cap-add", cd.CapAdd)
+	checkCaps("cap-drop", cd.CapDrop)
+}
+
+func allApart(usages []*hostPortUsage, apart map[string]bool) bool {
+	for i, u := range usages {
+		for _, other := range usages[:i] {
+			if !apart[u.group+"\x00"+other.group] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (v *validator) checkDeps(groups map[string]string, deps map[string][]string) {
+	names := []string{}
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	for _, group := range names {
+		for _, dep := range deps[group] {
+			if _, exists := groups[dep]; !exists {
+				v.errorf(joinPath(groups[group], "deps"), "dependency group '%s' of container group '%s' is not defined", dep, group)
+			}
+		}
+	}
+
+	// depth first, a group visiting is met again if there is a cycle.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := map[string]int{}
+	var visit func(group string, trace []string)
+	visit = func(group string, trace []string) {
+		states[group] = visiting
+		trace = append(trace, group)
+		for _, dep := range deps[group] {
+			if _, exists := groups[dep]; !exists {
+				continue
+			}
+			switch states[dep] {
+			case visiting:
+				for i, g := range trace {
+					if g == dep {
+						cycle := append(append([]string{}, trace[i:]...), dep)
+						v.errorf(joinPath(groups[group], "deps"), "dependency cycle detected: %s", strings.Join(cycle, " -> "))
+						break
+					}
+				}
+			case 0:
+				visit(dep, trace)
+			}
+		}
+		states[group] = visited
+	}
+	for _, group := range names {
+		if states[group] == 0 {
+			visit(group, []string{})
+		}
+	}
+}
+
+// one host port is bound by one container on a machine. The fixed host ports bound by more containers than the machines
+// of the group are errors, and the ones shared by several groups are warnings, as well as the overlapped port ranges.
+// the groups apart never share a machine, so they may bind the same host ports.
+func (v *validator) checkHostPorts(md *MachineDescription, usages []*hostPortUsage, apart map[string]bool) {
+	fixed := map[string][]*hostPortUsage{}
+	keys := []string{}
+	for _, u := range usages {
+		if u.min == u.max {
+			key := u.String()
+			if _, exists := fixed[key]; !exists {
+				keys = append(keys, key)
+			}
+			fixed[key] = append(fixed[key], u)
+		}
+	}
+	for _, key := range keys {
+		us := fixed[key]
+		num := 0
+		names := []string{}
+		for _, u := range us {
+			num += u.num
+			names = append(names, "'"+u.group+"'")
+		}
+		last := us[len(us)-1]
+		if md.MaxNum > 0 && num > md.MaxNum {
+			v.errorf(last.path, "host port %s is bound by %d containers of group %s, but machine group '%s' has at most %d machines", key, num, strings.Join(names, ", "), md.Group, md.MaxNum)
+		} else if len(us) > 1 && !allApart(us, apart) {
+			v.warnf(last.path, "host port %s is shared by groups %s on machine group '%s', their containers must run on different machines", key, strings.Join(names, ", "), md.Group)
+		}
+	}
+
+	for i, u := range usages {
+		for _, other := range usages[:i] {
+			if u.min == u.max && other.min == other.max {
+				continue
+			}
+			if u.protocol == other.protocol && u.min <= other.max && other.min <= u.max {
+				v.warnf(u.path, "host ports %s of group '%s' overlap %s of group '%s' on machine group '%s'", u, u.group, other, other.group, md.Group)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCluster = `master: web-1
+machine:
+   topology:
+      - group: web
+        minnum: 1
+        maxnum: 2
+        memory: 1g
+container:
+   topology:
+      - group: nginx
+        image: nginx:1.9
+        num: 1
+        port: 80:80
+        machine: web
+`
+
+// write the files into a temporary directory, which is removed by the returned function.
+func writeTestFiles(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "dockerf-test")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %s", err.Error())
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create the directory of %s: %s", name, err.Error())
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err.Error())
+		}
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// the problems of the report as 'FILE:LINE: SEVERITY: MESSAGE', with the files relative to the dir.
+func problemStrings(report *ValidationReport, dir string) []string {
+	problems := []string{}
+	for _, p := range report.Problems {
+		problems = append(problems, strings.Replace(p.String(), dir+string(filepath.Separator), "", -1))
+	}
+	return problems
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cluster  string
+		expected []string
+	}{
+		{
+			name:     "valid",
+			cluster:  testCluster,
+			expected: []string{},
+		},
+		{
+			name:    "invalid memory",
+			cluster: strings.Replace(testCluster, "memory: 1g", "memory: 1x", 1),
+			expected: []string{
+				"cluster.yml:7: error: '1x' is not a valid memory of machine group 'web'",
+			},
+		},
+		{
+			name:    "minnum greater than maxnum",
+			cluster: strings.Replace(testCluster, "minnum: 1", "minnum: 3", 1),
+			expected: []string{
+				"cluster.yml:5: error: minnum 3 of machine group 'web' is greater than maxnum 2",
+			},
+		},
+		{
+			name:    "undefined machine group",
+			cluster: strings.Replace(testCluster, "machine: web", "machine: db", 1),
+			expected: []string{
+				"cluster.yml:14: error: machine group 'db' of container group 'nginx' is not defined under 'machine.topology'",
+			},
+		},
+		{
+			name:    "all the problems in one pass",
+			cluster: strings.Replace(strings.Replace(testCluster, "memory: 1g", "memory: 1x", 1), "        image: nginx:1.9\n", "", 1),
+			expected: []string{
+				"cluster.yml:7: error: '1x' is not a valid memory of machine group 'web'",
+				"cluster.yml:10: error: container group 'nginx' has no image",
+			},
+		},
+	}
+	for _, test := range tests {
+		dir, remove := writeTestFiles(t, map[string]string{"cluster.yml": test.cluster})
+		report, err := Validate([]string{filepath.Join(dir, "cluster.yml")}, "", filepath.Join(dir, "profile.yml"))
+		remove()
+		if err != nil {
+			t.Errorf("%s: failed to validate: %s", test.name, err.Error())
+			continue
+		}
+		problems := problemStrings(report, dir)
+		if strings.Join(problems, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: expected problems:\n%s\nbut got:\n%s", test.name, strings.Join(test.expected, "\n"), strings.Join(problems, "\n"))
+		}
+		if report.Valid != (len(test.expected) == 0) {
+			t.Errorf("%s: expected valid %v, but got %v", test.name, len(test.expected) == 0, report.Valid)
+		}
+	}
+}
+
+func TestMachineDescriptionCapacity(t *testing.T) {
+	tests := []struct {
+		memory   string
+		disk     string
+		mem      int64
+		capacity int64
+		valid    bool
+	}{
+		{"", "", 512 * 1024 * 1024, 20 * 1024 * 1024 * 1024, true},
+		{"2g", "40g", 2 * 1024 * 1024 * 1024, 40 * 1024 * 1024 * 1024, true},
+		{"2x", "40g", 0, 40 * 1024 * 1024 * 1024, false},
+		{"2g", "forty", 2 * 1024 * 1024 * 1024, 0, false},
+	}
+	for _, test := range tests {
+		md := MachineDescription{Group: "web", Memory: test.memory}
+		md.Disk.Capacity = test.disk
+		mem, memErr := md.GetMemInBytes()
+		capacity, diskErr := md.GetDiskCapacityInBytes()
+		if valid := memErr == nil && diskErr == nil; valid != test.valid {
+			t.Errorf("memory '%s', disk '%s': expected valid %v, but got memory error %v, disk error %v", test.memory, test.disk, test.valid, memErr, diskErr)
+		}
+		if memErr == nil && mem != test.mem {
+			t.Errorf("memory '%s': expected %d bytes, but got %d", test.memory, test.mem, mem)
+		}
+		if diskErr == nil && capacity != test.capacity {
+			t.Errorf("disk '%s': expected %d bytes, but got %d", test.disk, test.capacity, capacity)
+		}
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		cluster  string
+		strict   bool
+		expected []string
+	}{
+		{
+			name:    "misspelled",
+			cluster: strings.Replace(testCluster, "maxnum: 2", "maxnmu: 2", 1),
+			strict:  true,
+			expected: []string{
+				"cluster.yml:5: error: minnum 1 of machine group 'web' is greater than maxnum 0",
+				"cluster.yml:6: error: unknown key 'maxnmu' in 'machine.topology.0', did you mean 'maxnum'?",
+			},
+		},
+		{
+			name:    "wrong indent",
+			cluster: strings.Replace(testCluster, "        num: 1\n", "        healthcheck:\n           num: 1\n", 1),
+			strict:  true,
+			expected: []string{
+				"cluster.yml:13: error: unknown key 'num' in 'container.topology.0.healthcheck', it belongs to 'container.topology.0', check its indent",
+			},
+		},
+		{
+			name:    "not strict",
+			cluster: strings.Replace(testCluster, "        num: 1", "        nmu: 1", 1),
+			strict:  false,
+			expected: []string{
+				"cluster.yml:12: warning: unknown key 'nmu' in 'container.topology.0', did you mean 'num'?",
+			},
+		},
+		{
+			name:     "alias",
+			cluster:  strings.Replace(testCluster, "        machine: web\n", "        machine: web\n        volumes:\n           - /data:/data\n", 1),
+			strict:   true,
+			expected: []string{},
+		},
+	}
+	defer func(strict bool) {
+		StrictDecoding = strict
+	}(StrictDecoding)
+	for _, test := range tests {
+		StrictDecoding = test.strict
+		dir, remove := writeTestFiles(t, map[string]string{"cluster.yml": test.cluster})
+		report, err := Validate([]string{filepath.Join(dir, "cluster.yml")}, "", filepath.Join(dir, "profile.yml"))
+		remove()
+		if err != nil {
+			t.Errorf("%s: failed to validate: %s", test.name, err.Error())
+			continue
+		}
+		problems := problemStrings(report, dir)
+		if strings.Join(problems, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: expected problems:\n%s\nbut got:\n%s", test.name, strings.Join(test.expected, "\n"), strings.Join(problems, "\n"))
+		}
+	}
+}
@@ -43,6 +43,19 @@ type ContainerRunConfig struct {
 	Bindings      []string
 	DNS           []string
 	RestartPolicy RestartPolicy
+	Memory        int64 // in bytes, 0 if not limited
+	MemorySwap    int64 // in bytes, -1 if the swap is not limited
+	CpuShares     int64
+	CpusetCpus    string
+	Entrypoint    []string
+	Labels        map[string]string
+	User          string
+	WorkingDir    string
+	Privileged    bool
+	CapAdd        []string
+	CapDrop       []string
+	Ulimits       []dcluster.Ulimit
+	ExtraHosts    []string
 }
 
 type Container struct {
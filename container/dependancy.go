@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+
+	"github.com/weibocom/dockerf/dlog"
 )
 
 type ContainerGroupDepsNode struct {
@@ -59,19 +61,22 @@ func (cpd *ContainerGroupDeps) CreateNode(group string, deps []string, nodeConta
 	return node, nil
 }
 
-func (cpd *ContainerGroupDeps) SetLevel(node *ContainerGroupDepsNode, lvl int, cycle map[string]bool) {
+func (cpd *ContainerGroupDeps) SetLevel(node *ContainerGroupDepsNode, lvl int, cycle map[string]bool) error {
 
 	if lvl <= node.level {
-		return
+		return nil
 	}
 	node.level = lvl
 	if _, ok := cycle[node.group]; ok {
-		panic("Cycle detected, when set level for group: " + node.group)
+		return errors.New("Cycle detected, when set level for group: " + node.group)
 	}
 	cycle[node.group] = true
 	for _, dn := range node.deps {
-		cpd.SetLevel(dn, lvl+1, cycle)
+		if err := cpd.SetLevel(dn, lvl+1, cycle); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // visit from bottom to top
@@ -86,7 +91,9 @@ func (cpd *ContainerGroupDeps) VisitByLevel(visit func(lvl int, groups []string)
 
 	for _, node := range nodeContainer {
 		cycleDetect := map[string]bool{}
-		cpd.SetLevel(node, 1, cycleDetect)
+		if err := cpd.SetLevel(node, 1, cycleDetect); err != nil {
+			return err
+		}
 	}
 
 	nodesByLevel := map[int][]string{}
@@ -109,7 +116,7 @@ func (cpd *ContainerGroupDeps) VisitByLevel(visit func(lvl int, groups []string)
 		lvl := sortedLevels[idx]
 		deps, _ := nodesByLevel[lvl]
 		if err := visit(lvl, deps); err != nil {
-			fmt.Printf("Visit by level failed. Level:%d, Deps:%+v, Continue:%t, Error:%s\n", lvl, deps, continueOnError, err.Error())
+			dlog.Printf("Visit by level failed. Level:%d, Deps:%+v, Continue:%t, Error:%s\n", lvl, deps, continueOnError, err.Error())
 			if !continueOnError {
 				return err
 			}
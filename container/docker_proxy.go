@@ -2,12 +2,13 @@ package container
 
 import (
 	"errors"
-	"flag"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/samalba/dockerclient"
+	"github.com/weibocom/dockerf/dlog"
+	"github.com/weibocom/dockerf/machine"
 )
 
 type DockerProxy struct {
@@ -18,36 +19,20 @@ const (
 	requestTimeout = 10
 )
 
-func NewDockerProxy(tlsConfig string) (*DockerProxy, error) {
-	tlsFlagset := flag.NewFlagSet("tls-docker-machine", flag.ExitOnError)
-	flTlsVerify := tlsFlagset.Bool("tlsverify", false, "Use TLS and verify the remote")
-	flCa := tlsFlagset.String("tlscacert", "", "Trust certs signed only by this CA")
-	flCert := tlsFlagset.String("tlscert", "", "Path to TLS certificate file")
-	flKey := tlsFlagset.String("tlskey", "", "Path to TLS key file")
-	host := tlsFlagset.String("H", "", "docker daemon host")
-	err := tlsFlagset.Parse(strings.Split(tlsConfig, " "))
+// NewDockerProxy connects to the docker daemon or the swarm master of the machine config, with tls verified.
+func NewDockerProxy(mc *machine.MachineConfig) (*DockerProxy, error) {
+	config, err := loadTLSConfig(mc.CaCertPath, mc.ClientCertPath, mc.ClientKeyPath, true)
 	if err != nil {
-		fmt.Errorf("Fail to parse machine config, data: %s, error: %s", tlsConfig, err.Error())
-		return nil, err
-	}
-	config, err := loadTLSConfig(normalizeString(*flCa), normalizeString(*flCert), normalizeString(*flKey), *flTlsVerify)
-	if err != nil {
-		fmt.Errorf("Fail to load tls config, error: %s", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("Fail to load tls config of machine '%s', error: %s", mc.Name, err.Error())
 	}
 
-	client, err := dockerclient.NewDockerClientTimeout(*host, config, time.Duration(requestTimeout*time.Second))
+	client, err := dockerclient.NewDockerClientTimeout(mc.URL, config, time.Duration(requestTimeout*time.Second))
 	if err != nil {
-		fmt.Errorf("Fail to build a docker client to %s, error: %s", *host, err.Error())
-		return nil, err
+		return nil, fmt.Errorf("Fail to build a docker client to %s, error: %s", mc.URL, err.Error())
 	}
 	return &DockerProxy{client}, nil
 }
 
-func normalizeString(param string) string {
-	return strings.TrimPrefix(strings.TrimSuffix(param, "\""), "\"")
-}
-
 func (d *DockerProxy) RunByConfig(runConfig ContainerRunConfig) (string, error) {
 	portBingds := map[string][]dockerclient.PortBinding{}
 	exposedPorts := map[string]struct{}{}
@@ -66,6 +51,10 @@ func (d *DockerProxy) RunByConfig(runConfig ContainerRunConfig) (string, error)
 	config.Env = runConfig.Envs
 	config.Cmd = runConfig.Cmds
 	config.Hostname = runConfig.Hostname
+	config.Entrypoint = runConfig.Entrypoint
+	config.Labels = runConfig.Labels
+	config.User = runConfig.User
+	config.WorkingDir = runConfig.WorkingDir
 
 	config.ExposedPorts = exposedPorts
 
@@ -78,6 +67,22 @@ func (d *DockerProxy) RunByConfig(runConfig ContainerRunConfig) (string, error)
 		Name:              runConfig.RestartPolicy.Name,
 		MaximumRetryCount: int64(runConfig.RestartPolicy.MaxTry),
 	}
+	hostConfig.Memory = runConfig.Memory
+	hostConfig.MemorySwap = runConfig.MemorySwap
+	hostConfig.CpuShares = runConfig.CpuShares
+	hostConfig.CpusetCpus = runConfig.CpusetCpus
+	hostConfig.Privileged = runConfig.Privileged
+	hostConfig.CapAdd = runConfig.CapAdd
+	hostConfig.CapDrop = runConfig.CapDrop
+	hostConfig.ExtraHosts = runConfig.ExtraHosts
+	for _, u := range runConfig.Ulimits {
+		hostConfig.Ulimits = append(hostConfig.Ulimits, dockerclient.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+	// the daemons before API v1.18 read the limits from the container config.
+	config.Memory = runConfig.Memory
+	config.MemorySwap = runConfig.MemorySwap
+	config.CpuShares = runConfig.CpuShares
+	config.Cpuset = runConfig.CpusetCpus
 
 	config.HostConfig = *hostConfig
 
@@ -85,13 +90,13 @@ func (d *DockerProxy) RunByConfig(runConfig ContainerRunConfig) (string, error)
 	if err != nil {
 		return "", errors.New(fmt.Sprintf("Failed to create a container. name: %s, error: %s", runConfig.Name, err.Error()))
 	}
-	fmt.Printf("Container created. name:%s, id:%s\n", runConfig.Name, cid)
+	dlog.Printf("Container created. name:%s, id:%s\n", runConfig.Name, cid)
 
 	if err := d.StartContainer(cid, hostConfig); err != nil {
-		fmt.Printf("Failed to start container. name:%s, id:%s.\n", runConfig.Name, cid)
+		dlog.Printf("Failed to start container. name:%s, id:%s.\n", runConfig.Name, cid)
 		return cid, err
 	}
-	fmt.Printf("Container start successfully. name:%s, id:%s.\n", runConfig.Name, cid)
+	dlog.Printf("Container start successfully. name:%s, id:%s.\n", runConfig.Name, cid)
 
 	return cid, nil
 }
@@ -160,7 +165,7 @@ func (d *DockerProxy) ListByGroup(group string) ([]ContainerInfo, error) {
 func (d *DockerProxy) GetContainerByID(id string) (ContainerInfo, bool) {
 	cs, err := d.ListAll()
 	if err != nil {
-		fmt.Printf("Load container info('%s') error:%s\n", id, err.Error())
+		dlog.Printf("Load container info('%s') error:%s\n", id, err.Error())
 		return ContainerInfo{}, false
 	}
 	for _, c := range cs {
@@ -176,7 +181,7 @@ func (d *DockerProxy) CreateContainer(config *dockerclient.ContainerConfig, name
 		err error
 		id  string
 	)
-	fmt.Printf("Create a new contianer. name:%s. container config:%+v\n", name, config)
+	dlog.Printf("Create a new contianer. name:%s. container config:%+v\n", name, config)
 	if id, err = d.client.CreateContainer(config, name); err != nil {
 
 		if err != dockerclient.ErrNotFound {
@@ -194,7 +199,7 @@ func (d *DockerProxy) CreateContainer(config *dockerclient.ContainerConfig, name
 }
 
 func (d *DockerProxy) StartContainer(id string, hostConfig *dockerclient.HostConfig) error {
-	fmt.Printf("Start container. cid:%s, host config:%+v\n", id, hostConfig)
+	dlog.Printf("Start container. cid:%s, host config:%+v\n", id, hostConfig)
 	return d.client.StartContainer(id, hostConfig)
 }
 
@@ -4,6 +4,7 @@ import (
 	// "encoding/json"
 	"fmt"
 	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
 )
 
 type Filter interface {
@@ -32,7 +33,7 @@ func (f *FilterChain) Filter(filterKVs map[string]string) ([]dcontainer.Containe
 	}
 	containers, err := f.filters[GroupFilterName].filter(groupFilterKey, nil)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Fail to execute group filter, error: %s, group: %s", err.Error(), groupFilterKey))
+		dlog.Println(fmt.Sprintf("Fail to execute group filter, error: %s, group: %s", err.Error(), groupFilterKey))
 		return nil, err
 	}
 
@@ -43,7 +44,7 @@ func (f *FilterChain) Filter(filterKVs map[string]string) ([]dcontainer.Containe
 		filter, _ := f.filters[key]
 		containers, err = filter.filter(value, containers)
 		if err != nil {
-			fmt.Println(fmt.Sprintf("Fail to execute filter, name: %s, filterKey: %s, error: %s", key, value, err.Error()))
+			dlog.Println(fmt.Sprintf("Fail to execute filter, name: %s, filterKey: %s, error: %s", key, value, err.Error()))
 			return nil, err
 		}
 	}
@@ -58,7 +59,7 @@ func init() {
 
 func registerFilter(filter Filter) {
 	if _, exist := filterMap[filter.name()]; exist {
-		fmt.Println(fmt.Sprintf("Filter is already registered, name: %s", filter.name()))
+		dlog.Println(fmt.Sprintf("Filter is already registered, name: %s", filter.name()))
 		return
 	}
 	filterMap[filter.name()] = filter
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
 )
 
 const (
@@ -21,9 +22,9 @@ func init() {
 func (g *GroupFilter) filter(groupName string, containers []dcontainer.ContainerInfo) ([]dcontainer.ContainerInfo, error) {
 	m := map[string][]string{"name": []string{g.buildGroupFilterKey(groupName)}}
 	filter, err := json.Marshal(m)
-	fmt.Println(fmt.Sprintf("Apply a group filter, groupName: %s, filter: %s", groupName, string(filter)))
+	dlog.Println(fmt.Sprintf("Apply a group filter, groupName: %s, filter: %s", groupName, string(filter)))
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Fail to build a group filter key, groupName: %s, error: %s", groupName, err.Error()))
+		dlog.Println(fmt.Sprintf("Fail to build a group filter key, groupName: %s, error: %s", groupName, err.Error()))
 		return g.dockerProxy.ListContainers(true, true, "")
 	}
 
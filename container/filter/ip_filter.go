@@ -3,6 +3,7 @@ package filter
 import (
 	"fmt"
 	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
 	"strings"
 )
 
@@ -20,7 +21,7 @@ func init() {
 func (f *IpFilter) filter(filteredIp string, containers []dcontainer.ContainerInfo) ([]dcontainer.ContainerInfo, error) {
 	result := []dcontainer.ContainerInfo{}
 
-	fmt.Println(fmt.Sprintf("Apply a ip filter, filter ips: %s", filteredIp))
+	dlog.Println(fmt.Sprintf("Apply a ip filter, filter ips: %s", filteredIp))
 
 	ips := strings.Split(filteredIp, ip_separator)
 
@@ -3,6 +3,7 @@ package filter
 import (
 	"fmt"
 	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
 	"strings"
 )
 
@@ -20,7 +21,7 @@ func init() {
 func (f *MachineNameFilter) filter(filteredMachineNames string, containers []dcontainer.ContainerInfo) ([]dcontainer.ContainerInfo, error) {
 	result := []dcontainer.ContainerInfo{}
 
-	fmt.Println(fmt.Sprintf("Apply a machine filter, filter machine names: %s", filteredMachineNames))
+	dlog.Println(fmt.Sprintf("Apply a machine filter, filter machine names: %s", filteredMachineNames))
 
 	names := strings.Split(filteredMachineNames, machine_name_separator)
 
@@ -3,6 +3,7 @@ package filter
 import (
 	"fmt"
 	dcontainer "github.com/weibocom/dockerf/container"
+	"github.com/weibocom/dockerf/dlog"
 	"strconv"
 )
 
@@ -21,7 +22,7 @@ func (p *PercentFilter) filter(percentStr string, containers []dcontainer.Contai
 	}
 	num := int(float64(total) * percent / float64(100))
 
-	fmt.Println(fmt.Sprintf("Apply a percent filter, percent: %s, num: %d", percentStr, num))
+	dlog.Println(fmt.Sprintf("Apply a percent filter, percent: %s, num: %d", percentStr, num))
 	return containers[0:num], nil
 }
 
@@ -11,6 +11,7 @@ import (
 	consul "github.com/hashicorp/consul/api"
 	dcluster "github.com/weibocom/dockerf/cluster"
 	"github.com/weibocom/dockerf/discovery"
+	"github.com/weibocom/dockerf/dlog"
 	dutils "github.com/weibocom/dockerf/utils"
 )
 
@@ -86,7 +87,7 @@ func (ngxDrv *NginxConsulRegisterDriver) operate(host string, port int, op Consu
 	kv := ngxDrv.client.KV()
 	err := callable(kv, address)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Fail to %s to consul cluster, address: %s, error: %s", op, address, err.Error()))
+		dlog.Println(fmt.Sprintf("Fail to %s to consul cluster, address: %s, error: %s", op, address, err.Error()))
 		return err
 	}
 
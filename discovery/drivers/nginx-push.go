@@ -11,6 +11,7 @@ import (
 
 	dcluster "github.com/weibocom/dockerf/cluster"
 	"github.com/weibocom/dockerf/discovery"
+	"github.com/weibocom/dockerf/dlog"
 	dutils "github.com/weibocom/dockerf/utils"
 )
 
@@ -53,7 +54,7 @@ func init() {
 }
 
 func (ngxDrv *NginxServiceRegisterDriver) Registry(urls []string) {
-	fmt.Printf("Nginx service register driver registry:%+v\n", urls)
+	dlog.Printf("Nginx service register driver registry:%+v\n", urls)
 	ngxDrv.urls = urls
 }
 
@@ -67,7 +68,7 @@ func (ngxDrv *NginxServiceRegisterDriver) buildError(prefix string, errs map[str
 }
 
 func (ngxDrv *NginxServiceRegisterDriver) Register(host string, port int) error {
-	fmt.Printf("Register service to nginx. nginx url:%+v, host:%s, port:%d\n", ngxDrv.urls, host, port)
+	dlog.Printf("Register service to nginx. nginx url:%+v, host:%s, port:%d\n", ngxDrv.urls, host, port)
 	address := fmt.Sprintf("%s:%d", host, port)
 	body := fmt.Sprintf("{\"upstream\":\"%s\",\"server\":[\"%s\"],\"method\":\"add\"}", ngxDrv.upstream, address)
 	errChans := make(map[string]chan error)
@@ -91,7 +92,7 @@ func (ngxDrv *NginxServiceRegisterDriver) Register(host string, port int) error
 	if len(errs) > 0 {
 		return ngxDrv.buildError("Nginx register error", errs)
 	}
-	fmt.Printf("Successfully Register service to nginx. nginx url:%+v, host:%s, port:%d\n", ngxDrv.urls, host, port)
+	dlog.Printf("Successfully Register service to nginx. nginx url:%+v, host:%s, port:%d\n", ngxDrv.urls, host, port)
 	return nil
 }
 
@@ -100,24 +101,24 @@ func (ngxDrv *NginxServiceRegisterDriver) register0(body string, url string, err
 	resp, err := ngxDrv.httpClient.Do(req)
 	defer wg.Done()
 	if err != nil {
-		fmt.Println(fmt.Sprintf("Register error, error: %s, body: %s, url: %s", err.Error(), body, url))
+		dlog.Println(fmt.Sprintf("Register error, error: %s, body: %s, url: %s", err.Error(), body, url))
 		errChan <- err
 		return
 	}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		resp.Body.Close()
-		fmt.Println(fmt.Sprintf("Read response from nginx error, error: %s, url: %s", err.Error(), url))
+		dlog.Println(fmt.Sprintf("Read response from nginx error, error: %s, url: %s", err.Error(), url))
 		errChan <- err
 		return
 	}
-	fmt.Println(fmt.Sprintf("Register node to nginx, result.  %s", string(b)))
+	dlog.Println(fmt.Sprintf("Register node to nginx, result.  %s", string(b)))
 	resp.Body.Close()
 	errChan <- nil
 }
 
 func (ngxDrv *NginxServiceRegisterDriver) UnRegister(host string, port int) error {
-	fmt.Printf("Ungreister service out of nginx(%+v). ip:%s, port:%d\n", ngxDrv.urls, host, port)
+	dlog.Printf("Ungreister service out of nginx(%+v). ip:%s, port:%d\n", ngxDrv.urls, host, port)
 	address := fmt.Sprintf("%s:%d", host, port)
 	body := fmt.Sprintf("{\"upstream\":\"%s\",\"server\":[\"%s\"],\"method\":\"del\"}", ngxDrv.upstream, address)
 
@@ -150,18 +151,18 @@ func (ngxDrv *NginxServiceRegisterDriver) unregister0(body string, url string, e
 	req, _ := http.NewRequest("POST", fmt.Sprintf("http://%s/upstream_add_server", url), strings.NewReader(body))
 	resp, err := ngxDrv.httpClient.Do(req)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("UnRegister error, error: %s, body: %s, url: %s", err.Error(), body, url))
+		dlog.Println(fmt.Sprintf("UnRegister error, error: %s, body: %s, url: %s", err.Error(), body, url))
 		errChan <- err
 		return
 	}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		resp.Body.Close()
-		fmt.Println(fmt.Sprintf("Read response from nginx error, error: %s, url: %s", err.Error(), url))
+		dlog.Println(fmt.Sprintf("Read response from nginx error, error: %s, url: %s", err.Error(), url))
 		errChan <- err
 		return
 	}
-	fmt.Println(fmt.Sprintf("UnRegister node to nginx, result: %s", string(b)))
+	dlog.Println(fmt.Sprintf("UnRegister node to nginx, result: %s", string(b)))
 	resp.Body.Close()
 	errChan <- nil
 }
@@ -53,7 +53,7 @@ func Debug(msg interface{}, data ...interface{}) {
 }
 
 func Debugf(msg string, data ...interface{}) {
-	debugLogger.Debugf(msg, data)
+	debugLogger.Debugf(msg, data...)
 }
 
 func Info(msg interface{}, data ...interface{}) {
@@ -61,7 +61,7 @@ func Info(msg interface{}, data ...interface{}) {
 }
 
 func Infof(msg string, data ...interface{}) {
-	infoLogger.Info(fmt.Printf(msg, data))
+	infoLogger.Info(fmt.Sprintf(msg, data...))
 }
 
 func Warn(msg interface{}, data ...interface{}) {
@@ -69,7 +69,7 @@ func Warn(msg interface{}, data ...interface{}) {
 }
 
 func Warnf(msg string, data ...interface{}) {
-	warnLogger.Warn(fmt.Printf(msg, data))
+	warnLogger.Warn(fmt.Sprintf(msg, data...))
 }
 
 func Error(msg interface{}, data ...interface{}) {
@@ -77,5 +77,5 @@ func Error(msg interface{}, data ...interface{}) {
 }
 
 func Errorf(msg string, data ...interface{}) {
-	errorLogger.Error(fmt.Printf(msg, data))
+	errorLogger.Error(fmt.Sprintf(msg, data...))
 }
@@ -0,0 +1,23 @@
+package dlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Out is where the progress messages are written, which is set to os.Stderr while the results are written to
+// os.Stdout as json or yaml documents.
+var Out io.Writer = os.Stdout
+
+func Print(a ...interface{}) {
+	fmt.Fprint(Out, a...)
+}
+
+func Printf(format string, a ...interface{}) {
+	fmt.Fprintf(Out, format, a...)
+}
+
+func Println(a ...interface{}) {
+	fmt.Fprintln(Out, a...)
+}
@@ -26,6 +26,8 @@ func init() {
 
 		for _, command := range [][]string{
 			{"cluster", "Deploy and manage a cluster of containers on containers which running on machines."},
+			{"machine", "Drain the machines of a cluster for maintenance."},
+			{"secret", "Encrypt, decrypt and rotate the secret values in the cluster files."},
 		} {
 			help += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
 		}
@@ -46,3 +46,27 @@ func NewCluster(gopt *options.Options) (*Cluster, error) {
 	c.LoadStates()
 	return c, nil
 }
+
+// Reload lists the machines in the store again, and loads their states.
+func (c *Cluster) Reload() error {
+	hosts, err := c.provider.List()
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	machines := make(map[string]*Machine, len(hosts))
+	for _, h := range hosts {
+		if m, ok := c.machines[h.Name]; ok {
+			m.Host = h
+			machines[h.Name] = m
+		} else {
+			machines[h.Name] = &Machine{
+				Host: h,
+			}
+		}
+	}
+	c.machines = machines
+	c.Unlock()
+	c.LoadStates()
+	return nil
+}
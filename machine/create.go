@@ -16,7 +16,7 @@ import (
 
 func (c *Cluster) Create(name, driverName string, d *MachineOptions) (*Machine, error) {
 	if _, ok := c.machines[name]; ok {
-		return nil, fmt.Errorf("machine name '%s' exists, remove it first or provide another name.")
+		return nil, fmt.Errorf("machine name '%s' exists, remove it first or provide another name.", name)
 	}
 	d.Options.Apply("engine-label", d.Options.String("engine-label")+" group="+d.Options.String("group"))
 
@@ -1,5 +1,11 @@
 package machine
 
 func (c *Cluster) Remove(m *Machine) error {
-	return m.Remove()
+	if err := m.Remove(); err != nil {
+		return err
+	}
+	c.Lock()
+	delete(c.machines, m.Name())
+	c.Unlock()
+	return nil
 }
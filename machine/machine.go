@@ -31,7 +31,7 @@ type MachineInfo struct {
 	IP        string
 	Group     string
 	Seq       int
-	TlsConfig tls.Config
+	TlsConfig *tls.Config
 	Host      *libmachine.Host
 }
 
@@ -53,6 +53,7 @@ type Machine struct {
 	Host        *libmachine.Host
 	CachedState state.State
 	CachedIp    string
+	CachedURL   string
 	StopTime    time.Time
 }
 
@@ -76,6 +77,19 @@ func (m *Machine) LoadIp() (string, error) {
 	return ip, err
 }
 
+// load the url of the docker daemon, and the ip in it.
+func (m *Machine) LoadURL() (string, error) {
+	url, err := m.Host.GetURL()
+	if err != nil {
+		return "", err
+	}
+	m.CachedURL = url
+	if ip, err := parseMachineIpFromUrl(url); err == nil && ip != "" {
+		m.CachedIp = ip
+	}
+	return url, nil
+}
+
 func (m *Machine) setCachedState(s state.State) {
 	if m.CachedState == state.Running && s != state.Running {
 		m.StopTime = time.Now()
@@ -98,14 +112,14 @@ func (m *Machine) LoadState() state.State {
 }
 
 // 1. start machine
-// 2. load ip and cache it
+// 2. load url and ip and cache them
 // 3. load state and cache it
 func (m *Machine) Start() error {
 	err := m.Host.Start()
 	if err == nil {
 		m.setCachedState(state.Running)
-		if _, e := m.LoadIp(); e != nil {
-			logrus.Warnf("machine '%s' started, but ip loading failed: ", m.Name(), err.Error())
+		if _, e := m.LoadURL(); e != nil {
+			logrus.Warnf("machine '%s' started, but url loading failed: %s", m.Name(), e.Error())
 		}
 	} else {
 		m.setCachedState(state.Error)
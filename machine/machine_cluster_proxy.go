@@ -2,8 +2,11 @@ package machine
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	dcluster "github.com/weibocom/dockerf/cluster"
+	"github.com/weibocom/dockerf/dlog"
 	dopts "github.com/weibocom/dockerf/machine/opts"
 	dseq "github.com/weibocom/dockerf/sequence"
 )
@@ -20,46 +23,70 @@ type MachineClusterProxy struct {
 	seqs          map[string]*dseq.Seq
 }
 
-func NewMachineClusterProxy(name, clusterBy, discovery, master string, drivers dcluster.CloudDrivers) *MachineClusterProxy {
+func NewMachineClusterProxy(clusterBy, discovery, master string, drivers dcluster.CloudDrivers) (*MachineClusterProxy, error) {
 	if clusterBy != "swarm" {
-		panic("'" + clusterBy + "' is not supported.")
+		return nil, fmt.Errorf("Cluster by '%s' is not supported, only 'swarm' is.", clusterBy)
 	}
-	mp := NewMachineProxy(name)
 	mcp := &MachineClusterProxy{
 		ClusterBy: clusterBy,
 		Discovery: discovery,
 		Master:    master,
-		Proxy:     mp,
+		Proxy:     NewMachineProxy(getStoreOptions(drivers)),
 		seqs:      map[string]*dseq.Seq{},
 		drivers:   drivers,
 	}
 	mcp.initSequences()
-	return mcp
+	return mcp, nil
 }
 
-func (mp *MachineClusterProxy) getDriver(md dcluster.MachineDescription) *dcluster.CloudDriverDescription {
-	name := mp.getDriverName(md)
-	if driver, exists := mp.drivers[name]; !exists {
-		panic(fmt.Sprintf("Cloud driver '%s' is not supported", name))
-	} else {
-		return &driver
+// the machines of all the drivers are kept in one store, which is configured by the global options of the default
+// driver, or of the first driver by name if none is the default.
+func getStoreOptions(drivers dcluster.CloudDrivers) []string {
+	names := []string{}
+	for name, driver := range drivers {
+		if driver.Default {
+			return driver.GetGlobalOptions()
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return []string{}
 	}
+	sort.Strings(names)
+	driver := drivers[names[0]]
+	return driver.GetGlobalOptions()
 }
 
-func (mp *MachineClusterProxy) getDriverName(md dcluster.MachineDescription) string {
+func (mp *MachineClusterProxy) getDriver(md dcluster.MachineDescription) (*dcluster.CloudDriverDescription, error) {
+	name, err := mp.getDriverName(md)
+	if err != nil {
+		return nil, err
+	}
+	driver, exists := mp.drivers[name]
+	if !exists {
+		return nil, fmt.Errorf("Cloud driver '%s' of machine group '%s' is not defined under 'machine.cloud'.", name, md.Group)
+	}
+	return &driver, nil
+}
+
+func (mp *MachineClusterProxy) getDriverName(md dcluster.MachineDescription) (string, error) {
 	if md.Cloud != "" {
-		return md.Cloud
+		return md.Cloud, nil
 	}
 	for name, driver := range mp.drivers {
 		if driver.Default {
-			return name
+			return name, nil
 		}
 	}
-	panic(fmt.Sprintf("No driver property or default driver provided."))
+	return "", fmt.Errorf("Machine group '%s' has no cloud, and no default cloud driver is provided.", md.Group)
 }
 
-func (mp *MachineClusterProxy) getMasterOptions(md dcluster.MachineDescription) []string {
-	masterOptions := []string{"-d", mp.getDriverName(md),
+func (mp *MachineClusterProxy) getMasterOptions(md dcluster.MachineDescription) ([]string, error) {
+	masterOptions, err := mp.getMachineOptions(md)
+	if err != nil {
+		return []string{}, err
+	}
+	masterOptions = append(masterOptions,
 		"--swarm",
 		"--swarm-master",
 		"--swarm-discovery", mp.Discovery,
@@ -67,32 +94,65 @@ func (mp *MachineClusterProxy) getMasterOptions(md dcluster.MachineDescription)
 		"--swarm-opt", "filter=port",
 		"--swarm-opt", "filter=affinity",
 		"--swarm-opt", "filter=constraint",
-	}
-	masterOptions = append(masterOptions, mp.getDriver(md).GetOptions()...)
-	return masterOptions
+	)
+	return masterOptions, nil
 }
 
-func (mp *MachineClusterProxy) getSlaveOptions(md dcluster.MachineDescription) []string {
-	slaveOptions := []string{"-d", mp.getDriverName(md),
+func (mp *MachineClusterProxy) getSlaveOptions(md dcluster.MachineDescription) ([]string, error) {
+	slaveOptions, err := mp.getMachineOptions(md)
+	if err != nil {
+		return []string{}, err
+	}
+	slaveOptions = append(slaveOptions,
 		"--swarm",
 		"--swarm-discovery", mp.Discovery,
 		"--engine-label", "role=slave",
 		// "--swarm-opt", "debug",
+	)
+	return slaveOptions, nil
+}
+
+// the region and the labels of the machine group as the engine labels, which the containers are placed by.
+func getLabelOptions(md dcluster.MachineDescription) []string {
+	opts := []string{}
+	if md.Region != "" {
+		opts = append(opts, "--engine-label", "region="+md.Region)
+	}
+	keys := []string{}
+	for k := range md.Labels {
+		keys = append(keys, k)
 	}
-	slaveOptions = append(slaveOptions, mp.getDriver(md).GetOptions()...)
-	return slaveOptions
+	sort.Strings(keys)
+	for _, k := range keys {
+		opts = append(opts, "--engine-label", k+"="+md.Labels[k])
+	}
+	return opts
 }
 
-func (mp *MachineClusterProxy) getMachineOptions(md dcluster.MachineDescription) []string {
-	noneOptions := []string{"-d", mp.getDriverName(md)}
-	noneOptions = append(noneOptions, mp.getDriver(md).GetOptions()...)
-	return noneOptions
+// the driver, the options of the cloud and the ones generated from the description, such as the instance type
+// and the region of aliyun. The options hand-written in the cloud are not generated.
+func (mp *MachineClusterProxy) getMachineOptions(md dcluster.MachineDescription) ([]string, error) {
+	name, err := mp.getDriverName(md)
+	if err != nil {
+		return []string{}, err
+	}
+	driver, err := mp.getDriver(md)
+	if err != nil {
+		return []string{}, err
+	}
+	noneOptions := []string{"-d", name}
+	noneOptions = append(noneOptions, driver.GetOptions()...)
+	extOpts, err := mp.GetOptionByDescription(md)
+	if err != nil {
+		return []string{}, err
+	}
+	return append(noneOptions, extOpts...), nil
 }
 
 func (mp *MachineClusterProxy) initSequences() {
 	mifs, err := mp.List()
 	if err != nil {
-		fmt.Printf("Failed to init machine group sequence. err:%s\n", err.Error())
+		dlog.Printf("Failed to init machine group sequence. err:%s\n", err.Error())
 	}
 	for _, mi := range mifs {
 		seq := mp.getSeq(mi.Group)
@@ -119,13 +179,15 @@ func (mp *MachineClusterProxy) IPs(machines []string) ([]string, error) {
 }
 
 func (mp *MachineClusterProxy) CreateMaster(md dcluster.MachineDescription) error {
-	opts := mp.getMasterOptions(md)
-	extOpts, err := mp.GetOptionByDescription(md)
+	opts, err := mp.getMasterOptions(md)
 	if err != nil {
 		return err
 	}
-	opts = append(opts, extOpts...)
-	return mp.Proxy.Create(mp.Master, mp.getDriver(md).GetGlobalOptions(), opts)
+	driver, err := mp.getDriver(md)
+	if err != nil {
+		return err
+	}
+	return mp.Proxy.Create(mp.Master, driver.GetGlobalOptions(), opts)
 }
 
 func (mp *MachineClusterProxy) generateName(group string) string {
@@ -134,56 +196,80 @@ func (mp *MachineClusterProxy) generateName(group string) string {
 }
 
 func (mp *MachineClusterProxy) CreateSlave(md dcluster.MachineDescription) (string, error) {
-	nodeName := mp.generateName(md.Group)
-	opts := []string{"--engine-label", "group=" + md.Group}
-	opts = append(opts, mp.getSlaveOptions(md)...)
-	extOpts, err := mp.GetOptionByDescription(md)
+	slaveOptions, err := mp.getSlaveOptions(md)
 	if err != nil {
 		return "", err
 	}
-	if len(extOpts) > 0 {
-		opts = append(opts, extOpts...)
+	driver, err := mp.getDriver(md)
+	if err != nil {
+		return "", err
 	}
-	return nodeName, mp.Proxy.Create(nodeName, mp.getDriver(md).GetGlobalOptions(), opts)
+	nodeName := mp.generateName(md.Group)
+	opts := []string{"--engine-label", "group=" + md.Group}
+	opts = append(opts, getLabelOptions(md)...)
+	opts = append(opts, slaveOptions...)
+	return nodeName, mp.Proxy.Create(nodeName, driver.GetGlobalOptions(), opts)
 }
 
 func (mp *MachineClusterProxy) CreateMachine(node string, md dcluster.MachineDescription, driverOptions []string) error {
-	opts := mp.getMachineOptions(md)
+	opts, err := mp.getMachineOptions(md)
+	if err != nil {
+		return err
+	}
 	if len(driverOptions) > 0 {
 		opts = append(opts, driverOptions...)
 	}
-	extOpts, err := mp.GetOptionByDescription(md)
+	driver, err := mp.getDriver(md)
 	if err != nil {
 		return err
 	}
-	if len(extOpts) > 0 {
-		opts = append(opts, extOpts...)
-	}
-
-	return mp.Proxy.Create(node, mp.getDriver(md).GetGlobalOptions(), opts)
+	return mp.Proxy.Create(node, driver.GetGlobalOptions(), opts)
 }
 
+// the options generated from the description of the machine group, none for the drivers without an options driver.
 func (mp *MachineClusterProxy) GetOptionByDescription(md dcluster.MachineDescription) ([]string, error) {
-	driver := mp.getDriverName(md)
-	return dopts.GetOptions(driver, md)
+	driver, err := mp.getDriver(md)
+	if err != nil {
+		return []string{}, err
+	}
+	name, _ := mp.getDriverName(md)
+	if !dopts.Supports(name) {
+		return []string{}, nil
+	}
+	return dopts.GetOptions(name, md, driver.GetOptions())
 }
 
 func (mp *MachineClusterProxy) Start(names ...string) ([]string, error) {
 	return mp.Proxy.Start(names...)
 }
 
+func (mp *MachineClusterProxy) Stop(names ...string) ([]string, error) {
+	return mp.Proxy.Stop(names...)
+}
+
 func (mp *MachineClusterProxy) ExecCmd(machine, command string) error {
 	return mp.Proxy.ExecCmd(machine, command)
 }
 
-func (mp *MachineClusterProxy) Config() (string, error) {
+func (mp *MachineClusterProxy) ExecCmdOutput(machine, command string, timeout time.Duration) (string, error) {
+	return mp.Proxy.ExecCmdOutput(machine, command, timeout)
+}
+
+// Config is how the swarm master of the cluster is reached.
+func (mp *MachineClusterProxy) Config() (*MachineConfig, error) {
 	return mp.Proxy.Config(mp.Master, mp.ClusterBy)
 }
 
-func (mp *MachineClusterProxy) ConfigNode(node string) (string, error) {
+// ConfigNode is how the docker daemon of the machine is reached.
+func (mp *MachineClusterProxy) ConfigNode(node string) (*MachineConfig, error) {
 	return mp.Proxy.Config(node, "")
 }
 
+// Refresh expires the machines cached, for the changes made by the others.
+func (mp *MachineClusterProxy) Refresh() {
+	mp.Proxy.Refresh()
+}
+
 func (mp *MachineClusterProxy) Destroy(names ...string) error {
 	return mp.Proxy.Destroy(names...)
 }
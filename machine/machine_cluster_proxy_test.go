@@ -0,0 +1,44 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func TestGetStoreOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		drivers  dcluster.CloudDrivers
+		expected []string
+	}{
+		{"no driver", dcluster.CloudDrivers{}, []string{}},
+		{
+			name: "default driver",
+			drivers: dcluster.CloudDrivers{
+				"aliyun":     {GlobalOptions: "-s /data/aliyun"},
+				"virtualbox": {Default: true, GlobalOptions: "-s /data/local --native-ssh"},
+			},
+			expected: []string{"-s", "/data/local", "--native-ssh"},
+		},
+		{
+			name: "first driver by name",
+			drivers: dcluster.CloudDrivers{
+				"virtualbox": {GlobalOptions: "-s /data/local"},
+				"aliyun":     {GlobalOptions: "-s /data/aliyun"},
+			},
+			expected: []string{"-s", "/data/aliyun"},
+		},
+		{
+			name:     "no global options",
+			drivers:  dcluster.CloudDrivers{"aliyun": {Default: true}},
+			expected: []string{},
+		},
+	}
+	for _, test := range tests {
+		if options := getStoreOptions(test.drivers); !reflect.DeepEqual(options, test.expected) {
+			t.Errorf("%s: expected the store options %q, but got %q", test.name, test.expected, options)
+		}
+	}
+}
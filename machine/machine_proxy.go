@@ -1,28 +1,81 @@
 package machine
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/url"
-	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/ssh"
+	"github.com/docker/machine/utils"
 	dutils "github.com/weibocom/dockerf/dlog"
+	"github.com/weibocom/dockerf/options"
+	gossh "golang.org/x/crypto/ssh"
 )
 
+const (
+	// the machines listed are reused in the ttl, unless a machine is created, started, stopped or destroyed.
+	LIST_CACHE_TTL = 10 * time.Second
+)
+
+// MachineNotFoundError is returned if no machine of the name is in the machine store.
+type MachineNotFoundError struct {
+	Name string
+}
+
+func (e *MachineNotFoundError) Error() string {
+	return fmt.Sprintf("Machine '%s' is not found", e.Name)
+}
+
+// MachineNotRunningError is returned if the machine is asked for its ip or config, but it is not running.
+type MachineNotRunningError struct {
+	Name  string
+	State string
+}
+
+func (e *MachineNotRunningError) Error() string {
+	return fmt.Sprintf("Machine '%s' is not running, its state is '%s'", e.Name, e.State)
+}
+
+// MachineConfig is how the docker daemon of a machine, or the swarm master on it, is reached with tls.
+type MachineConfig struct {
+	Name           string
+	URL            string
+	CaCertPath     string
+	ClientCertPath string
+	ClientKeyPath  string
+}
+
+// MachineProxy manages the machines in the machine store in process. The machines are created by the
+// machine commands, which parse the driver options.
 type MachineProxy struct {
-	App *cli.App
+	App     *cli.App
+	lock    sync.Mutex
+	cluster *Cluster
+	loaded  time.Time
+	// the global options of the machine commands, such as '--storage-path', which the store is built with.
+	globalOptions []string
 }
 
-func NewMachineProxy(name string) *MachineProxy {
-	app := NewMachineApp(name)
+// NewMachineProxy manages the machines of the machine store, named after this program in the messages. The store is
+// the one the machine commands use with the global options.
+func NewMachineProxy(globalOptions []string) *MachineProxy {
+	app := NewMachineApp("")
 	proxy := &MachineProxy{
-		App: app,
+		App:           app,
+		globalOptions: globalOptions,
 	}
 	return proxy
 }
@@ -33,47 +86,154 @@ func (mp *MachineProxy) Run(args ...string) error {
 	return mp.App.Run(rArgs)
 }
 
+// the machines in the store, which are listed again once the cache expires or is invalidated. The storage path
+// and the certs are configured by the same global options and environments as the machine commands.
+func (mp *MachineProxy) load() (*Cluster, error) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	if mp.cluster == nil {
+		gopt, err := parseGlobalOptions(mp.App.Flags, mp.globalOptions)
+		if err != nil {
+			return nil, err
+		}
+		c, err := NewCluster(gopt)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load the machines: %s", err.Error())
+		}
+		mp.cluster = c
+		mp.loaded = time.Now()
+	} else if time.Since(mp.loaded) > LIST_CACHE_TTL {
+		if err := mp.cluster.Reload(); err != nil {
+			return nil, fmt.Errorf("Failed to load the machines: %s", err.Error())
+		}
+		mp.loaded = time.Now()
+	}
+	return mp.cluster, nil
+}
+
+// the global options given to the machine commands, with the values of all the names of a flag, such as 's' and
+// 'storage-path'. The options not given are read from the environments or the defaults of the flags.
+func parseGlobalOptions(flags []cli.Flag, args []string) (*options.Options, error) {
+	set := flag.NewFlagSet("global", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+	given := []string{}
+	for _, arg := range args {
+		if arg != "" {
+			given = append(given, arg)
+		}
+	}
+	if err := set.Parse(given); err != nil {
+		return nil, fmt.Errorf("Invalid global options '%s': %s", strings.Join(given, " "), err.Error())
+	}
+	if set.NArg() > 0 {
+		return nil, fmt.Errorf("Invalid global options '%s': '%s' is not an option", strings.Join(given, " "), set.Arg(0))
+	}
+	visited := map[string]string{}
+	set.Visit(func(f *flag.Flag) {
+		visited[f.Name] = f.Value.String()
+	})
+	values := map[string]string{}
+	for _, f := range flags {
+		names := strings.Split(reflect.ValueOf(f).FieldByName("Name").String(), ",")
+		for _, name := range names {
+			if v, ok := visited[strings.TrimSpace(name)]; ok {
+				for _, n := range names {
+					values[strings.TrimSpace(n)] = v
+				}
+			}
+		}
+	}
+	return &options.Options{Values: values, Flags: flags}, nil
+}
+
+// Refresh expires the cached machines, which are listed again in the next call.
+func (mp *MachineProxy) Refresh() {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	mp.loaded = time.Time{}
+}
+
+func (mp *MachineProxy) getMachine(name string) (*Machine, error) {
+	c, err := mp.load()
+	if err != nil {
+		return nil, err
+	}
+	m, found := c.Get(name)
+	if !found {
+		return nil, &MachineNotFoundError{Name: name}
+	}
+	return m, nil
+}
+
 func (mp *MachineProxy) Destroy(names ...string) error {
 	if len(names) == 0 {
 		return nil
 	}
-	args := []string{
-		"rm",
+	defer mp.Refresh()
+	c, err := mp.load()
+	if err != nil {
+		return err
 	}
-	args = append(args, names...)
-	return mp.Run(args...)
+	errs := []string{}
+	for _, name := range names {
+		var err error
+		if m, found := c.Get(name); !found {
+			err = &MachineNotFoundError{Name: name}
+		} else {
+			err = c.Remove(m)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Failed to remove machine '%s': %s", name, err.Error()))
+			continue
+		}
+		dutils.Printf("Machine(%s) removed.\n", name)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "---"))
+	}
+	return nil
 }
 
 func (mp *MachineProxy) Create(name string, globalOptions []string, options []string) error {
+	defer mp.Refresh()
 	args := []string{}
 	args = append(args, globalOptions...)
 	args = append(args, "create")
 	args = append(args, options...)
 	args = append(args, name)
-	fmt.Printf("Create machine. name:%s, args:%+v\n", name, args)
+	dutils.Printf("Create machine. name:%s, args:%+v\n", name, args)
 	return mp.Run(args...)
 }
 
-func (mp *MachineProxy) Start(names ...string) ([]string, error) {
-	l := len(names)
-	if l == 0 {
+// operate the machines in parallel, and return the names of the ones succeeded.
+func (mp *MachineProxy) operate(op string, names []string, operate func(m *Machine) error) ([]string, error) {
+	if len(names) == 0 {
 		return []string{}, nil
 	}
+	defer mp.Refresh()
 	successMachineNames := []string{}
 	errs := []string{}
+	var lock sync.Mutex
 	var wg sync.WaitGroup
-	wg.Add(l)
 	for _, name := range names {
+		wg.Add(1)
 		go func(nm string) {
 			defer wg.Done()
-			args := []string{"start", nm}
-			err := mp.Run(args...)
+			m, err := mp.getMachine(nm)
+			if err == nil {
+				err = operate(m)
+			}
+			lock.Lock()
+			defer lock.Unlock()
 			if err != nil {
-				errs = append(errs, err.Error())
-				fmt.Printf("Machine(%s) start failed:%s\n", name, err.Error())
+				errs = append(errs, fmt.Sprintf("Machine(%s) %s failed: %s", nm, op, err.Error()))
+				dutils.Printf("Machine(%s) %s failed:%s\n", nm, op, err.Error())
 			} else {
 				successMachineNames = append(successMachineNames, nm)
-				fmt.Printf("Machine(%s) Started.\n", nm)
+				dutils.Printf("Machine(%s) %s complete.\n", nm, op)
 			}
 		}(name)
 	}
@@ -85,29 +245,136 @@ func (mp *MachineProxy) Start(names ...string) ([]string, error) {
 	return successMachineNames, err
 }
 
+func (mp *MachineProxy) Start(names ...string) ([]string, error) {
+	return mp.operate("start", names, func(m *Machine) error {
+		return m.Start()
+	})
+}
+
+func (mp *MachineProxy) Stop(names ...string) ([]string, error) {
+	return mp.operate("stop", names, func(m *Machine) error {
+		return m.Stop()
+	})
+}
+
+// run the command on the machine by ssh. The ssh session and connection are closed once cancel is closed, and the
+// command running on the machine is killed or hung up then.
+func (mp *MachineProxy) runSSHCommand(machine, command string, cancel <-chan struct{}) (string, error) {
+	m, err := mp.getMachine(machine)
+	if err != nil {
+		return "", err
+	}
+	client, err := drivers.GetSSHClientFromDriver(m.Host.Driver)
+	if err != nil {
+		return "", fmt.Errorf("Failed to ssh to machine '%s': %s", machine, err.Error())
+	}
+	switch c := client.(type) {
+	case ssh.ExternalClient:
+		return runExternalSSHCommand(c, command, cancel)
+	case ssh.NativeClient:
+		return runNativeSSHCommand(c, command, cancel)
+	default:
+		return client.Output(command)
+	}
+}
+
+func runExternalSSHCommand(client ssh.ExternalClient, command string, cancel <-chan struct{}) (string, error) {
+	args := append(append([]string{}, client.BaseArgs...), command)
+	cmd := exec.Command(client.BinaryPath, args...)
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return out.String(), err
+	case <-cancel:
+		// the remote command is hung up once the connection is closed.
+		cmd.Process.Kill()
+		<-done
+		return out.String(), fmt.Errorf("Command '%s' is cancelled", command)
+	}
+}
+
+func runNativeSSHCommand(client ssh.NativeClient, command string, cancel <-chan struct{}) (string, error) {
+	conn, err := gossh.Dial("tcp", fmt.Sprintf("%s:%d", client.Hostname, client.Port), &client.Config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	session, err := conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	out := &bytes.Buffer{}
+	session.Stdout = out
+	session.Stderr = out
+	if err := session.Start(command); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err := <-done:
+		return out.String(), err
+	case <-cancel:
+		session.Signal(gossh.SIGKILL)
+		session.Close()
+		conn.Close()
+		<-done
+		return out.String(), fmt.Errorf("Command '%s' is cancelled", command)
+	}
+}
+
 func (mp *MachineProxy) ExecCmd(machine, command string) error {
-	args := []string{
-		"ssh",
-		machine,
-		command,
+	out, err := mp.runSSHCommand(machine, command, nil)
+	dutils.Print(out)
+	return err
+}
+
+// ExecCmdOutput executes the command on the machine, and returns its stdout and stderr. The command is cancelled
+// if it does not finish in the timeout.
+func (mp *MachineProxy) ExecCmdOutput(machine, command string, timeout time.Duration) (string, error) {
+	type result struct {
+		out string
+		err error
+	}
+	cancel := make(chan struct{})
+	done := make(chan result, 1)
+	go func() {
+		out, err := mp.runSSHCommand(machine, command, cancel)
+		done <- result{out, err}
+	}()
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-time.After(timeout):
+		close(cancel)
+		return "", fmt.Errorf("Command '%s' on '%s' timed out after %s", command, machine, timeout)
 	}
-	return mp.Run(args...)
 }
 
 func (mp *MachineProxy) IP(machine string) (string, error) {
-	cmd := os.Args[0]
-	args := []string{"machine", "ip", machine}
-	data, err := exec.Command(cmd, args...).Output()
+	m, err := mp.getMachine(machine)
 	if err != nil {
-		fmt.Printf("Failed to load ip for '%s'\n", machine)
 		return "", err
 	}
-	lines := strings.Split(string(data), "\n")
-	l := len(lines)
-	if l < 2 {
-		return "", errors.New(fmt.Sprintf("Not a valid ip '%s'", string(data)))
+	if ip := m.GetCachedIp(); ip != "" && IsRunning(m.GetCachedState()) {
+		return ip, nil
+	}
+	ip, err := m.LoadIp()
+	if err != nil {
+		return "", fmt.Errorf("Failed to load ip for '%s': %s", machine, err.Error())
 	}
-	ip := lines[l-2]
 	return ip, nil
 }
 
@@ -123,122 +390,120 @@ func (mp *MachineProxy) IPs(nodes []string) ([]string, error) {
 	return ips, nil
 }
 
-func (mp *MachineProxy) Config(node string, cluster string) (string, error) {
+// Config is how the docker daemon of the machine is reached, or the swarm master on it if cluster is 'swarm'.
+// The certs of the machine are regenerated if they are not valid for its current address.
+func (mp *MachineProxy) Config(node string, cluster string) (*MachineConfig, error) {
 	if cluster != "" && cluster != "swarm" {
-		panic("Cluster is not supported by '" + cluster + "'")
+		return nil, fmt.Errorf("Cluster is not supported by '%s'", cluster)
 	}
-	cmd := os.Args[0]
-	args := []string{"machine", "config"}
-	if cluster != "" {
-		args = append(args, "--swarm")
+	m, err := mp.getMachine(node)
+	if err != nil {
+		return nil, err
 	}
-	args = append(args, node)
-
-	data, err := exec.Command(cmd, args...).Output()
+	if !IsRunning(m.GetCachedState()) {
+		return nil, &MachineNotRunningError{Name: node, State: m.GetCachedState().String()}
+	}
+	dockerHost, err := m.LoadURL()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the url of machine '%s': %s", node, err.Error())
+	}
+	u, err := url.Parse(dockerHost)
 	if err != nil {
-		log.Errorf("Fail to get machine config, name: %s, error: %s", node, err.Error())
-	}
-	log.Debugf("load tls config. data:\n", string(data))
-	sr := strings.NewReader(string(data))
-	br := bufio.NewReader(sr)
-
-	for {
-		if bline, _, err := br.ReadLine(); err == nil {
-			line := string(bline)
-			// TODO tell this line is a configuration info, other than logs
-			if strings.HasPrefix(line, "--tlsverify") && strings.Contains(line, "--tlscacert") {
-				return line, nil
+		return nil, fmt.Errorf("Invalid url of machine '%s': %s", node, err.Error())
+	}
+
+	machineDir := filepath.Join(utils.GetMachineDir(), m.Name())
+	config := &MachineConfig{
+		Name:           node,
+		URL:            dockerHost,
+		CaCertPath:     filepath.Join(machineDir, "ca.pem"),
+		ClientCertPath: filepath.Join(machineDir, "cert.pem"),
+		ClientKeyPath:  filepath.Join(machineDir, "key.pem"),
+	}
+	if u.Scheme != "unix" {
+		valid, err := utils.ValidateCertificate(u.Host, config.CaCertPath, filepath.Join(machineDir, "server.pem"), filepath.Join(machineDir, "server-key.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to validate the certs of machine '%s': %s", node, err.Error())
+		}
+		if !valid {
+			log.Infof("Invalid certs of machine '%s', regenerating them.", node)
+			if err := m.Host.ConfigureAuth(); err != nil {
+				return nil, fmt.Errorf("Failed to regenerate the certs of machine '%s': %s", node, err.Error())
 			}
-		} else {
-			return "", errors.New("fail to get configuration info. try to exec shell '" + cmd + " " + strings.Join(args, " ") + "' to check: " + err.Error())
 		}
 	}
-	return "", errors.New("Can not get configuration info. try to exec shell '" + cmd + " " + strings.Join(args, " ") + "' to check.")
+
+	if cluster != "" {
+		swarmOptions := m.Host.HostOptions.SwarmOptions
+		if swarmOptions == nil || !swarmOptions.Master {
+			return nil, fmt.Errorf("Machine '%s' is not a swarm master", node)
+		}
+		su, err := url.Parse(swarmOptions.Host)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid swarm host of machine '%s': %s", node, err.Error())
+		}
+		parts := strings.Split(su.Host, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("No port in the swarm host '%s' of machine '%s'", swarmOptions.Host, node)
+		}
+		// the swarm host may be 0.0.0.0, so it is reached by the ip of the machine.
+		config.URL = fmt.Sprintf("tcp://%s:%s", strings.Split(u.Host, ":")[0], parts[1])
+	}
+	log.Debugf("Machine config loaded. %+v", config)
+	return config, nil
 }
 
+// List the machines, with their states. The master of a machine is the swarm master of its discovery.
 func (mp *MachineProxy) List(filter func(mi *MachineInfo) bool) ([]MachineInfo, error) {
-	mis := []MachineInfo{}
-	cmd := os.Args[0]
-	args := []string{"machine", "ls"}
-	bytes, err := exec.Command(cmd, args...).Output()
+	c, err := mp.load()
 	if err != nil {
-		fmt.Printf("Cannot list the machine info.\n")
-		return mis, err
-	}
-	br := bufio.NewReaderSize(strings.NewReader(string(bytes)), 64*1024)
-	validate := false
-	for {
-		bLine, _, err := br.ReadLine()
-		if err == nil {
-			line := string(bLine)
-			if !validate {
-				if strings.HasPrefix(line, "NAME") {
-					validate = true
-				}
-				continue
-			}
-			fields := strings.Fields(line)
-			fl := len(fields)
-			idx := 0
-			// fields to machine info
-			// name
-			mi := MachineInfo{}
-			if fl > idx {
-				mi.Name = fields[idx]
-				idx++
-			}
-			// active
-			if fl > idx {
-				if fields[idx] == "*" {
-					mi.Active = "*"
-					idx++
-				}
-			}
-			// driver
-			if fl > idx {
-				mi.Driver = fields[idx]
-				idx++
-			}
-			// state
-			if fl > idx {
-				mi.State = fields[idx]
-				idx++
-			}
-			// last fields
-			idx = fl - 1
-			if idx >= 0 {
-				lastField := fields[idx]
-				if lastField == "(master)" {
-					idx--
-				}
-				if !isUrl(fields[idx]) {
-					mi.Master = fields[idx]
-					idx--
-				}
-			}
-			if idx >= 0 { // idx may be -1 where there are some error machines in the cluster.
-				// url
-				if mi.State != fields[idx] {
-					mi.URL = fields[idx]
-					ip, _ := parseMachineIpFromUrl(mi.URL)
-					mi.IP = ip
-				}
-			}
-			mi.parseName()
-			if filter(&mi) {
-				mis = append(mis, mi)
-			}
-		} else if err.Error() == "EOF" {
-			break
-		} else {
-			fmt.Printf("Error to Read from machine 'ls' output: ", err.Error())
-			return []MachineInfo{}, err
+		return []MachineInfo{}, err
+	}
+	machines := c.ListAll()
+	swarmMasters := map[string]string{}
+	for _, m := range machines {
+		if so := m.Host.HostOptions.SwarmOptions; so != nil && so.Master {
+			swarmMasters[so.Discovery] = m.Name()
+		}
+	}
+	sort.Sort(sortMachine(machines))
+
+	mis := []MachineInfo{}
+	for _, m := range machines {
+		mi := MachineInfo{
+			Name:   m.Name(),
+			Driver: m.Host.DriverName,
+			State:  m.GetCachedState().String(),
+			Host:   m.Host,
+		}
+		if so := m.Host.HostOptions.SwarmOptions; so != nil && so.Discovery != "" {
+			mi.Master = swarmMasters[so.Discovery]
+		}
+		if IsRunning(m.GetCachedState()) {
+			mi.URL = m.CachedURL
+			mi.IP = m.GetCachedIp()
+		}
+		mi.parseName()
+		if filter(&mi) {
+			mis = append(mis, mi)
 		}
 	}
 	return mis, nil
 }
 
-//解析machine ip，machine url格式：tcp://192.168.99.100:2376
+type sortMachine []*Machine
+
+func (s sortMachine) Len() int {
+	return len(s)
+}
+func (s sortMachine) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortMachine) Less(i, j int) bool {
+	return s[i].Name() < s[j].Name()
+}
+
+// 解析machine ip，machine url格式：tcp://192.168.99.100:2376
 func parseMachineIpFromUrl(machineUrl string) (string, error) {
 	u, err := url.Parse(machineUrl)
 	if err != nil {
@@ -247,7 +512,3 @@ func parseMachineIpFromUrl(machineUrl string) (string, error) {
 	}
 	return strings.Split(u.Host, ":")[0], nil
 }
-
-func isUrl(url string) bool {
-	return strings.Contains(url, "://")
-}
@@ -0,0 +1,50 @@
+package machine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/machine/utils"
+)
+
+func TestParseGlobalOptions(t *testing.T) {
+	if env, exists := os.LookupEnv("MACHINE_STORAGE_PATH"); exists {
+		os.Unsetenv("MACHINE_STORAGE_PATH")
+		defer os.Setenv("MACHINE_STORAGE_PATH", env)
+	}
+	flags := NewMachineApp("").Flags
+	tests := []struct {
+		args        []string
+		storagePath string
+		caCert      string
+		nativeSSH   bool
+		valid       bool
+	}{
+		{nil, utils.GetBaseDir(), "", false, true},
+		{[]string{"-s", "/data/machine"}, "/data/machine", "", false, true},
+		{[]string{"--storage-path=/data/machine", "--native-ssh"}, "/data/machine", "", true, true},
+		{[]string{"", "--tls-ca-cert", "/certs/ca.pem", ""}, utils.GetBaseDir(), "/certs/ca.pem", false, true},
+		{[]string{"--driver", "aliyun"}, "", "", false, false},
+		{[]string{"-s", "/data/machine", "ls"}, "", "", false, false},
+	}
+	for _, test := range tests {
+		gopt, err := parseGlobalOptions(flags, test.args)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, but got error %v", test.args, test.valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		// all the names of a flag have the value given by any of them.
+		if s, storagePath := gopt.String("s"), gopt.String("storage-path"); s != test.storagePath || storagePath != test.storagePath {
+			t.Errorf("%q: expected the storage path %s, but got '%s' by 's' and '%s' by 'storage-path'", test.args, test.storagePath, s, storagePath)
+		}
+		if caCert := gopt.String("tls-ca-cert"); caCert != test.caCert {
+			t.Errorf("%q: expected the ca cert '%s', but got '%s'", test.args, test.caCert, caCert)
+		}
+		if nativeSSH := gopt.Bool("native-ssh"); nativeSSH != test.nativeSSH {
+			t.Errorf("%q: expected native ssh %v, but got %v", test.args, test.nativeSSH, nativeSSH)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package opts
+
+import (
+	"fmt"
+	"strings"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+const (
+	ALIYUN_INSTANCE_TYPE_OPTION = "--aliyun-instance-type-id"
+	ALIYUN_REGION_OPTION        = "--aliyun-region-id"
+	gb                          = 1024 * 1024 * 1024
+)
+
+type aliyunInstanceType struct {
+	id      string
+	cpu     int
+	memInGB float64
+}
+
+func (it *aliyunInstanceType) String() string {
+	return fmt.Sprintf("%d cpu %gg(%s)", it.cpu, it.memInGB, it.id)
+}
+
+var (
+	instanceTypes []aliyunInstanceType
+)
+
+func init() {
+	instanceTypes = []aliyunInstanceType{
+		{"ecs.t1.xsmall", 1, 0.5},
+		{"ecs.t1.small", 1, 1.0},
+		{"ecs.s1.small", 1, 2.0},
+		{"ecs.s1.medium", 1, 4.0},
+		{"ecs.s1.large", 1, 8.0},
+		{"ecs.s2.small", 2, 2.0},
+		{"ecs.s2.large", 2, 4.0},
+		{"ecs.s2.xlarge", 2, 8.0},
+		{"ecs.s2.2xlarge", 2, 16.0},
+		{"ecs.s3.medium", 4, 4.0},
+		{"ecs.s3.large", 4, 8.0},
+		{"ecs.m1.medium", 4, 16.0},
+		{"ecs.m2.medium", 4, 32.0},
+		{"ecs.c1.small", 8, 8.0},
+		{"ecs.c1.large", 8, 16.0},
+		{"ecs.m1.xlarge", 8, 32.0},
+		{"ecs.c2.xlarge", 16, 64.0},
+	}
+}
+
+// the instance type and the region of the machine group, unless they are hand-written in 'cloud.aliyun.options'.
+func (od *OptsDriver) GetAliyunOptions(md dcluster.MachineDescription, given []string) ([]string, error) {
+	options := []string{}
+	if _, exists := optionValue(given, ALIYUN_INSTANCE_TYPE_OPTION); !exists {
+		instanceType, err := GetAliyunInstanceType(md)
+		if err != nil {
+			return []string{}, err
+		}
+		options = append(options, ALIYUN_INSTANCE_TYPE_OPTION, instanceType)
+	}
+	if _, exists := optionValue(given, ALIYUN_REGION_OPTION); !exists {
+		if md.Region == "" {
+			return []string{}, fmt.Errorf("Aliyun region of machine group '%s' must be provided.", md.Group)
+		}
+		options = append(options, ALIYUN_REGION_OPTION, md.Region)
+	}
+	return options, nil
+}
+
+// GetAliyunInstanceType is the aliyun instance type with exactly the cpu and the memory of the machine group.
+// See 'https://gist.github.com/Lax/3a2037a11c49df1aa1e7' for detail.
+func GetAliyunInstanceType(md dcluster.MachineDescription) (string, error) {
+	memInBytes, err := md.GetMemInBytes()
+	if err != nil {
+		return "", err
+	}
+	memory := md.Memory
+	if memory == "" {
+		memory = "512m" // the default of the machine group
+	}
+	cpu := md.GetCpu()
+	for _, it := range instanceTypes {
+		if it.cpu == cpu && int64(it.memInGB*gb) == memInBytes {
+			return it.id, nil
+		}
+	}
+	supported := []string{}
+	for _, it := range instanceTypes {
+		supported = append(supported, it.String())
+	}
+	return "", fmt.Errorf("No aliyun instance type matched for cpu:%d, mem:%s of machine group '%s'. The supported are: %s.", cpu, memory, md.Group, strings.Join(supported, ", "))
+}
@@ -0,0 +1,111 @@
+package opts
+
+import (
+	"reflect"
+	"testing"
+
+	dcluster "github.com/weibocom/dockerf/cluster"
+)
+
+func TestGetAliyunInstanceType(t *testing.T) {
+	tests := []struct {
+		cpu      int
+		memory   string
+		expected string
+	}{
+		{0, "", "ecs.t1.xsmall"},
+		{1, "512m", "ecs.t1.xsmall"},
+		{1, "1g", "ecs.t1.small"},
+		{1, "1024m", "ecs.t1.small"},
+		{2, "4g", "ecs.s2.large"},
+		{4, "16g", "ecs.m1.medium"},
+		{16, "64g", "ecs.c2.xlarge"},
+		{2, "3g", ""},
+		{3, "4g", ""},
+		{2, "4x", ""},
+	}
+	for _, test := range tests {
+		md := dcluster.MachineDescription{Group: "web", Cpu: test.cpu, Memory: test.memory}
+		instanceType, err := GetAliyunInstanceType(md)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("cpu %d, memory '%s': expected no instance type, but got %s", test.cpu, test.memory, instanceType)
+			}
+			continue
+		}
+		if err != nil || instanceType != test.expected {
+			t.Errorf("cpu %d, memory '%s': expected instance type %s, but got '%s', %v", test.cpu, test.memory, test.expected, instanceType, err)
+		}
+	}
+}
+
+func TestGetAliyunOptions(t *testing.T) {
+	md := dcluster.MachineDescription{Group: "web", Cpu: 2, Memory: "4g", Region: "cn-beijing"}
+	tests := []struct {
+		name     string
+		md       dcluster.MachineDescription
+		given    []string
+		expected []string
+		valid    bool
+	}{
+		{
+			name:     "generated",
+			md:       md,
+			expected: []string{ALIYUN_INSTANCE_TYPE_OPTION, "ecs.s2.large", ALIYUN_REGION_OPTION, "cn-beijing"},
+			valid:    true,
+		},
+		{
+			name:     "instance type given",
+			md:       dcluster.MachineDescription{Group: "web", Cpu: 3, Region: "cn-beijing"},
+			given:    []string{ALIYUN_INSTANCE_TYPE_OPTION, "ecs.n1.small"},
+			expected: []string{ALIYUN_REGION_OPTION, "cn-beijing"},
+			valid:    true,
+		},
+		{
+			name:     "all given",
+			md:       dcluster.MachineDescription{Group: "web", Cpu: 3},
+			given:    []string{ALIYUN_INSTANCE_TYPE_OPTION + "=ecs.n1.small", ALIYUN_REGION_OPTION, "cn-hangzhou"},
+			expected: []string{},
+			valid:    true,
+		},
+		{
+			name:  "no region",
+			md:    dcluster.MachineDescription{Group: "web", Cpu: 2, Memory: "4g"},
+			valid: false,
+		},
+		{
+			name:  "no instance type",
+			md:    dcluster.MachineDescription{Group: "web", Cpu: 3, Region: "cn-beijing"},
+			valid: false,
+		},
+	}
+	for _, test := range tests {
+		options, err := GetOptions("aliyun", test.md, test.given)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, but got error %v", test.name, test.valid, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(options, test.expected) {
+			t.Errorf("%s: expected options %v, but got %v", test.name, test.expected, options)
+		}
+	}
+}
+
+func TestGetInstanceType(t *testing.T) {
+	md := dcluster.MachineDescription{Group: "web", Cpu: 2, Memory: "4g"}
+	tests := []struct {
+		driver   string
+		given    []string
+		expected string
+	}{
+		{"aliyun", nil, "ecs.s2.large"},
+		{"aliyun", []string{ALIYUN_INSTANCE_TYPE_OPTION, "ecs.n1.small"}, "ecs.n1.small"},
+		{"virtualbox", nil, ""},
+	}
+	for _, test := range tests {
+		instanceType, err := GetInstanceType(test.driver, md, test.given)
+		if err != nil || instanceType != test.expected {
+			t.Errorf("driver %s, options %v: expected instance type '%s', but got '%s', %v", test.driver, test.given, test.expected, instanceType, err)
+		}
+	}
+}
@@ -12,20 +12,58 @@ import (
 type OptsDriver struct {
 }
 
-func GetOptions(driver string, md dcluster.MachineDescription) ([]string, error) {
+// the options generated from the machine description. The given options are hand-written for the driver, which
+// are not generated again.
+func GetOptions(driver string, md dcluster.MachineDescription, given []string) ([]string, error) {
 	od := &OptsDriver{}
 	method, exists := od.getDriverFunction(driver)
 	if !exists {
 		return []string{}, errors.New(fmt.Sprintf("Options driver '%s' is not supported.", driver))
 	}
-	return method(md)
+	return method(md, given)
 }
 
-func (od *OptsDriver) getDriverFunction(driverName string) (func(dcluster.MachineDescription) ([]string, error), bool) {
+// Supports tells whether the options of the driver are generated from the machine description.
+func Supports(driver string) bool {
+	_, exists := (&OptsDriver{}).getDriverFunction(driver)
+	return exists
+}
+
+func (od *OptsDriver) getDriverFunction(driverName string) (func(dcluster.MachineDescription, []string) ([]string, error), bool) {
 	methodName := "Get" + strings.ToUpper(driverName[:1]) + strings.ToLower(driverName[1:]) + "Options"
 	method := reflect.ValueOf(od).MethodByName(methodName)
 	if !method.IsValid() {
 		return nil, false
 	}
-	return method.Interface().(func(dcluster.MachineDescription) ([]string, error)), true
+	return method.Interface().(func(dcluster.MachineDescription, []string) ([]string, error)), true
+}
+
+// GetInstanceType is the instance type the machines of the group are created with, the hand-written one of the
+// given options first. Empty for the drivers without instance types.
+func GetInstanceType(driver string, md dcluster.MachineDescription, given []string) (string, error) {
+	switch strings.ToLower(driver) {
+	case "aliyun":
+		if instanceType, exists := optionValue(given, ALIYUN_INSTANCE_TYPE_OPTION); exists {
+			return instanceType, nil
+		}
+		return GetAliyunInstanceType(md)
+	default:
+		return "", nil
+	}
+}
+
+// the value of the option, given as '--name value' or '--name=value'.
+func optionValue(opts []string, name string) (string, bool) {
+	for i, opt := range opts {
+		if opt == name {
+			if i+1 < len(opts) {
+				return opts[i+1], true
+			}
+			return "", true
+		}
+		if strings.HasPrefix(opt, name+"=") {
+			return strings.TrimPrefix(opt, name+"="), true
+		}
+	}
+	return "", false
 }
@@ -26,11 +26,15 @@ func (c *Cluster) LoadStates() {
 			func() {
 				s := tm.LoadState()
 				logrus.Debugf("loading machine state complete. %s:%s", tm.Name(), s.String())
-				_, err := tm.LoadIp()
+				// the stopped machines have no url.
+				if !IsRunning(s) {
+					return
+				}
+				_, err := tm.LoadURL()
 				if err != nil {
-					logrus.Errorf("loading machine '%s' ip failed:%s", tm.Name(), err.Error())
+					logrus.Errorf("loading machine '%s' url failed:%s", tm.Name(), err.Error())
 				} else {
-					logrus.Debugf("loading machine ip complete. '%s':%s", tm.Name(), tm.GetCachedIp())
+					logrus.Debugf("loading machine url complete. '%s':%s", tm.Name(), tm.CachedURL)
 				}
 			},
 			func() {
@@ -1,14 +1,18 @@
 package utils
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 )
 
 // 512m 1gb etc...
 func ParseCapacity(str string) (int, error) {
-	ustr := strings.ToUpper(str)
+	ustr := strings.ToUpper(strings.TrimSpace(str))
 	end := len(ustr)
+	if end == 0 {
+		return -1, errors.New("empty capacity")
+	}
 	if ustr[end-1] == 'B' {
 		end = end - 1
 	}
@@ -26,6 +30,9 @@ func ParseCapacity(str string) (int, error) {
 	default:
 	}
 	ustr = ustr[0:end]
+	if ustr == "" {
+		return -1, errors.New("no number in capacity " + str)
+	}
 
 	num, err := strconv.ParseInt(ustr, 10, 64)
 	if err != nil {
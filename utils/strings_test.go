@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"num", "num", 0},
+		{"", "num", 3},
+		{"num", "", 3},
+		{"maxnmu", "maxnum", 2},
+		{"volums", "volumes", 1},
+		{"imgae", "image", 2},
+		{"port", "ports", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, test := range tests {
+		if d := EditDistance(test.a, test.b); d != test.expected {
+			t.Errorf("The edit distance of '%s' and '%s' is expected to be %d, but got %d", test.a, test.b, test.expected, d)
+		}
+	}
+}